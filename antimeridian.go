@@ -0,0 +1,425 @@
+package tiles
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+	"math"
+	"sort"
+)
+
+// CrossesAntimeridian returns true if any line or ring in 'geom' (which is expected to be in EPSG:4326 coordinates)
+// has a segment whose longitudes differ by more than 180 degrees, which is assumed to mean the segment crosses the
+// antimeridian rather than wrapping around the world, or if any longitude in 'geom' is outside of -180 to 180.
+func CrossesAntimeridian(geom orb.Geometry) bool {
+
+	switch g := geom.(type) {
+	case orb.Point:
+		return !validLongitude(g.Lon())
+	case orb.MultiPoint:
+
+		for _, pt := range g {
+
+			if !validLongitude(pt.Lon()) {
+				return true
+			}
+		}
+
+		return false
+
+	case orb.LineString:
+		return crossesAntimeridian(g)
+	case orb.Ring:
+		return crossesAntimeridian(g)
+	case orb.MultiLineString:
+
+		for _, ls := range g {
+
+			if crossesAntimeridian(ls) {
+				return true
+			}
+		}
+
+		return false
+
+	case orb.Polygon:
+
+		for _, r := range g {
+
+			if crossesAntimeridian(r) {
+				return true
+			}
+		}
+
+		return false
+
+	case orb.MultiPolygon:
+
+		for _, p := range g {
+
+			if CrossesAntimeridian(p) {
+				return true
+			}
+		}
+
+		return false
+
+	case orb.Collection:
+
+		for _, cg := range g {
+
+			if CrossesAntimeridian(cg) {
+				return true
+			}
+		}
+
+		return false
+
+	case orb.Bound:
+		return !validLongitude(g.Min.Lon()) || !validLongitude(g.Max.Lon())
+	default:
+		return false
+	}
+}
+
+// SplitAntimeridian returns a copy of 'geom' (which is expected to be in EPSG:4326 coordinates) where any lines or
+// polygons that cross the antimeridian have been split in to parts on either side of it and all longitudes have been
+// normalized to -180 to 180. Lines and polygons that cross the antimeridian are returned as MultiLineString and
+// MultiPolygon geometries respectively. Rings that encircle a pole can not be split and are returned unchanged. If
+// 'geom' does not cross the antimeridian then it is returned as-is.
+func SplitAntimeridian(geom orb.Geometry) orb.Geometry {
+
+	if !CrossesAntimeridian(geom) {
+		return geom
+	}
+
+	switch g := geom.(type) {
+	case orb.Point:
+		return normalizePoint(g)
+	case orb.MultiPoint:
+
+		mp := make(orb.MultiPoint, len(g))
+
+		for i, pt := range g {
+			mp[i] = normalizePoint(pt)
+		}
+
+		return mp
+
+	case orb.LineString:
+		return splitLineStrings(orb.MultiLineString{g})
+	case orb.MultiLineString:
+		return splitLineStrings(g)
+	case orb.Ring:
+		return splitPolygons(orb.MultiPolygon{orb.Polygon{g}})
+	case orb.Polygon:
+		return splitPolygons(orb.MultiPolygon{g})
+	case orb.MultiPolygon:
+		return splitPolygons(g)
+	case orb.Collection:
+
+		c := make(orb.Collection, len(g))
+
+		for i, cg := range g {
+			c[i] = SplitAntimeridian(cg)
+		}
+
+		return c
+
+	case orb.Bound:
+
+		bounds := AntimeridianBounds(orb.MultiPoint{g.Min, g.Max})
+
+		if len(bounds) == 1 {
+			return bounds[0]
+		}
+
+		mp := make(orb.MultiPolygon, len(bounds))
+
+		for i, b := range bounds {
+			mp[i] = b.ToPolygon()
+		}
+
+		return mp
+
+	default:
+		return geom
+	}
+}
+
+// AntimeridianBounds returns the smallest bounding box, measured in degrees of longitude, for 'geom' (which is expected
+// to be in EPSG:4326 coordinates and will be split using the SplitAntimeridian method). If that bounding box crosses the
+// antimeridian it is returned as two bounding boxes, one either side of it. For example a feature with parts at
+// longitudes 177 to 180 and -180 to -179 yields bounding boxes from 177 to 180 and from -180 to -179 rather than a
+// single bounding box spanning (almost) the entire world.
+func AntimeridianBounds(geom orb.Geometry) []orb.Bound {
+
+	geom = SplitAntimeridian(geom)
+	full_b := geom.Bound()
+
+	parts := geometryParts(geom)
+
+	if len(parts) < 2 {
+		return []orb.Bound{full_b}
+	}
+
+	// Merge the longitude intervals for each part and then look for the largest gap between them.
+	// If that gap is not the one that wraps around the antimeridian then the smallest bounding box
+	// crosses the antimeridian.
+
+	intervals := make([][2]float64, len(parts))
+
+	for i, p := range parts {
+		b := p.Bound()
+		intervals[i] = [2]float64{b.Min.Lon(), b.Max.Lon()}
+	}
+
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i][0] < intervals[j][0]
+	})
+
+	merged := [][2]float64{intervals[0]}
+
+	for _, iv := range intervals[1:] {
+
+		last := len(merged) - 1
+
+		if iv[0] <= merged[last][1] {
+			merged[last][1] = math.Max(merged[last][1], iv[1])
+			continue
+		}
+
+		merged = append(merged, iv)
+	}
+
+	last := len(merged) - 1
+
+	max_gap := (merged[0][0] + 360.0) - merged[last][1]
+	split_idx := -1
+
+	for i := 0; i < last; i++ {
+
+		gap := merged[i+1][0] - merged[i][1]
+
+		if gap > max_gap {
+			max_gap = gap
+			split_idx = i
+		}
+	}
+
+	if split_idx == -1 {
+		return []orb.Bound{full_b}
+	}
+
+	east := orb.Bound{
+		Min: orb.Point{merged[split_idx+1][0], full_b.Min.Lat()},
+		Max: orb.Point{180.0, full_b.Max.Lat()},
+	}
+
+	west := orb.Bound{
+		Min: orb.Point{-180.0, full_b.Min.Lat()},
+		Max: orb.Point{merged[split_idx][1], full_b.Max.Lat()},
+	}
+
+	return []orb.Bound{east, west}
+}
+
+func validLongitude(lon float64) bool {
+	return lon >= -180.0 && lon <= 180.0
+}
+
+func crossesAntimeridian(ls []orb.Point) bool {
+
+	for i, pt := range ls {
+
+		if !validLongitude(pt.Lon()) {
+			return true
+		}
+
+		if i > 0 && math.Abs(pt.Lon()-ls[i-1].Lon()) > 180.0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizePoint returns a copy of 'pt' with its longitude normalized to -180 to 180.
+func normalizePoint(pt orb.Point) orb.Point {
+
+	lon := math.Mod(pt.Lon()+180.0, 360.0)
+
+	if lon < 0 {
+		lon += 360.0
+	}
+
+	return orb.Point{lon - 180.0, pt.Lat()}
+}
+
+// unwrap returns a copy of 'pts' where each longitude has been shifted by a multiple of 360 degrees so that it is
+// within 180 degrees of the previous longitude, making the sequence continuous across the antimeridian.
+func unwrap(pts []orb.Point) []orb.Point {
+
+	out := make([]orb.Point, len(pts))
+
+	for i, pt := range pts {
+
+		if i == 0 {
+			out[i] = pt
+			continue
+		}
+
+		prev := out[i-1].Lon()
+		lon := pt.Lon() - 360.0*math.Round((pt.Lon()-prev)/360.0)
+
+		out[i] = orb.Point{lon, pt.Lat()}
+	}
+
+	return out
+}
+
+// shift returns a copy of 'pts' with 'dx' degrees added to each longitude.
+func shift(pts []orb.Point, dx float64) []orb.Point {
+
+	out := make([]orb.Point, len(pts))
+
+	for i, pt := range pts {
+		out[i] = orb.Point{pt.Lon() + dx, pt.Lat()}
+	}
+
+	return out
+}
+
+// bands returns the range of multiples of 360 degrees spanned by the longitudes in 'b'.
+func bands(b orb.Bound) (int, int) {
+	min_k := int(math.Floor((b.Min.Lon() + 180.0) / 360.0))
+	max_k := int(math.Ceil((b.Max.Lon()+180.0)/360.0)) - 1
+	return min_k, max_k
+}
+
+// bandBound returns the bounding box for the 'k'th multiple of 360 degrees of longitude.
+func bandBound(k int) orb.Bound {
+
+	dx := float64(k) * 360.0
+
+	return orb.Bound{
+		Min: orb.Point{-180.0 + dx, -90.0},
+		Max: orb.Point{180.0 + dx, 90.0},
+	}
+}
+
+func splitLineStrings(mls orb.MultiLineString) orb.MultiLineString {
+
+	out := make(orb.MultiLineString, 0)
+
+	for _, ls := range mls {
+
+		u := orb.LineString(unwrap(ls))
+		min_k, max_k := bands(u.Bound())
+
+		for k := min_k; k <= max_k; k++ {
+
+			clipped := clip.LineString(bandBound(k), orb.Clone(u).(orb.LineString))
+
+			for _, part := range clipped {
+
+				if len(part) < 2 {
+					continue
+				}
+
+				out = append(out, orb.LineString(shift(part, float64(-k)*360.0)))
+			}
+		}
+	}
+
+	return out
+}
+
+func splitPolygons(mp orb.MultiPolygon) orb.MultiPolygon {
+
+	out := make(orb.MultiPolygon, 0)
+
+	for _, p := range mp {
+
+		if len(p) == 0 {
+			continue
+		}
+
+		outer := orb.Ring(unwrap(p[0]))
+
+		// Rings that encircle a pole do not close once unwrapped and can not be split.
+
+		if len(outer) > 1 && math.Abs(outer[len(outer)-1].Lon()-outer[0].Lon()) > 180.0 {
+			out = append(out, p)
+			continue
+		}
+
+		u := orb.Polygon{outer}
+		center := outer.Bound().Center().Lon()
+
+		for _, r := range p[1:] {
+
+			inner := orb.Ring(unwrap(r))
+			dx := 360.0 * math.Round((center-inner.Bound().Center().Lon())/360.0)
+
+			u = append(u, orb.Ring(shift(inner, dx)))
+		}
+
+		min_k, max_k := bands(outer.Bound())
+
+		for k := min_k; k <= max_k; k++ {
+
+			clipped := clip.Polygon(bandBound(k), orb.Clone(u).(orb.Polygon))
+
+			if len(clipped) == 0 || len(clipped[0]) == 0 {
+				continue
+			}
+
+			part := make(orb.Polygon, len(clipped))
+
+			for i, r := range clipped {
+				part[i] = orb.Ring(shift(r, float64(-k)*360.0))
+			}
+
+			out = append(out, part)
+		}
+	}
+
+	return out
+}
+
+// geometryParts returns the individual points, lines and polygons in 'geom'.
+func geometryParts(geom orb.Geometry) []orb.Geometry {
+
+	parts := make([]orb.Geometry, 0)
+
+	switch g := geom.(type) {
+	case orb.MultiPoint:
+
+		for _, pt := range g {
+			parts = append(parts, pt)
+		}
+
+	case orb.MultiLineString:
+
+		for _, ls := range g {
+			parts = append(parts, ls)
+		}
+
+	case orb.MultiPolygon:
+
+		for _, p := range g {
+			parts = append(parts, p)
+		}
+
+	case orb.Collection:
+
+		for _, cg := range g {
+			parts = append(parts, geometryParts(cg)...)
+		}
+
+	default:
+		parts = append(parts, geom)
+	}
+
+	return parts
+}
@@ -0,0 +1,247 @@
+package tiles
+
+import (
+	"github.com/paulmach/orb"
+	"math"
+	"testing"
+)
+
+func TestSplitAntimeridian(t *testing.T) {
+
+	fiji := orb.Ring{{177, -18}, {-179, -18}, {-179, -16}, {177, -16}, {177, -18}}
+	fiji_unwrapped := orb.Ring{{177, -18}, {181, -18}, {181, -16}, {177, -16}, {177, -18}}
+
+	outer := orb.Ring{{170, -10}, {-170, -10}, {-170, 10}, {170, 10}, {170, -10}}
+
+	tests := []struct {
+		Name     string
+		Geometry orb.Geometry
+		Parts    int
+		Area     float64
+		Length   float64
+		Bounds   []orb.Bound
+	}{
+		{
+			Name:     "fiji ring",
+			Geometry: orb.Polygon{fiji},
+			Parts:    2,
+			Area:     8,
+			Bounds:   []orb.Bound{{Min: orb.Point{177, -18}, Max: orb.Point{180, -16}}, {Min: orb.Point{-180, -18}, Max: orb.Point{-179, -16}}},
+		},
+		{
+			Name:     "fiji ring beyond 180",
+			Geometry: orb.Polygon{fiji_unwrapped},
+			Parts:    2,
+			Area:     8,
+			Bounds:   []orb.Bound{{Min: orb.Point{177, -18}, Max: orb.Point{180, -16}}, {Min: orb.Point{-180, -18}, Max: orb.Point{-179, -16}}},
+		},
+		{
+			Name:     "hole on one side",
+			Geometry: orb.Polygon{outer, orb.Ring{{172, -2}, {172, 2}, {174, 2}, {174, -2}, {172, -2}}},
+			Parts:    2,
+			Area:     392,
+		},
+		{
+			Name:     "hole crossing the antimeridian",
+			Geometry: orb.Polygon{outer, orb.Ring{{178, -2}, {178, 2}, {-178, 2}, {-178, -2}, {178, -2}}},
+			Parts:    2,
+			Area:     384,
+		},
+		{
+			Name:     "polar ring",
+			Geometry: orb.Polygon{orb.Ring{{0, -80}, {90, -80}, {180, -80}, {-90, -80}, {0, -80}}},
+			Parts:    1,
+		},
+		{
+			Name:     "line",
+			Geometry: orb.LineString{{170, 0}, {-170, 0}},
+			Parts:    2,
+			Length:   20,
+			Bounds:   []orb.Bound{{Min: orb.Point{170, 0}, Max: orb.Point{180, 0}}, {Min: orb.Point{-180, 0}, Max: orb.Point{-170, 0}}},
+		},
+		{
+			Name:     "points",
+			Geometry: orb.MultiPoint{{179, 1}, {181, 2}},
+			Parts:    2,
+			Bounds:   []orb.Bound{{Min: orb.Point{179, 1}, Max: orb.Point{180, 2}}, {Min: orb.Point{-180, 1}, Max: orb.Point{-179, 2}}},
+		},
+		{
+			Name:     "no crossing",
+			Geometry: orb.Polygon{orb.Ring{{-10, 0}, {10, 0}, {10, 10}, {-10, 10}, {-10, 0}}},
+			Parts:    1,
+			Area:     200,
+			Bounds:   []orb.Bound{{Min: orb.Point{-10, 0}, Max: orb.Point{10, 10}}},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			split := SplitAntimeridian(test.Geometry)
+
+			parts := geometryParts(split)
+
+			if len(parts) != test.Parts {
+				t.Fatalf("Expected %d parts, got %d", test.Parts, len(parts))
+			}
+
+			for _, p := range parts {
+
+				b := p.Bound()
+
+				if !validLongitude(b.Min.Lon()) || !validLongitude(b.Max.Lon()) {
+					t.Fatalf("Part has longitudes outside of -180 to 180 (%v)", b)
+				}
+			}
+
+			if test.Area > 0 && math.Abs(polygonalArea(split)-test.Area) > 1e-9 {
+				t.Fatalf("Expected area of %f, got %f", test.Area, polygonalArea(split))
+			}
+
+			if test.Length > 0 && math.Abs(lineLength(split)-test.Length) > 1e-9 {
+				t.Fatalf("Expected length of %f, got %f", test.Length, lineLength(split))
+			}
+
+			if test.Bounds == nil {
+				return
+			}
+
+			bounds := AntimeridianBounds(test.Geometry)
+
+			if len(bounds) != len(test.Bounds) {
+				t.Fatalf("Expected %d bounds, got %d (%v)", len(test.Bounds), len(bounds), bounds)
+			}
+
+			for i, b := range test.Bounds {
+
+				if !b.Equal(bounds[i]) {
+					t.Fatalf("Expected bounds %d to be %v, got %v", i, b, bounds[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSplitAntimeridianPolarRing(t *testing.T) {
+
+	p := orb.Polygon{orb.Ring{{0, -80}, {90, -80}, {180, -80}, {-90, -80}, {0, -80}}}
+
+	split, ok := SplitAntimeridian(p).(orb.MultiPolygon)
+
+	if !ok || len(split) != 1 {
+		t.Fatalf("Expected a single polygon")
+	}
+
+	if !orb.Equal(split[0], p) {
+		t.Fatalf("Expected polar ring to be returned unchanged, got %v", split[0])
+	}
+}
+
+func TestAntimeridianBounds(t *testing.T) {
+
+	tests := []struct {
+		Name     string
+		Geometry orb.Geometry
+		Bounds   []orb.Bound
+	}{
+		{
+			Name: "parts either side of the antimeridian",
+			Geometry: orb.MultiPolygon{
+				orb.Polygon{orb.Ring{{177, -18}, {180, -18}, {180, -16}, {177, -16}, {177, -18}}},
+				orb.Polygon{orb.Ring{{-180, -17}, {-179, -17}, {-179, -15}, {-180, -15}, {-180, -17}}},
+			},
+			Bounds: []orb.Bound{{Min: orb.Point{177, -18}, Max: orb.Point{180, -15}}, {Min: orb.Point{-180, -18}, Max: orb.Point{-179, -15}}},
+		},
+		{
+			Name: "parts either side of the prime meridian",
+			Geometry: orb.MultiPolygon{
+				orb.Polygon{orb.Ring{{-10, 0}, {-5, 0}, {-5, 5}, {-10, 5}, {-10, 0}}},
+				orb.Polygon{orb.Ring{{10, 0}, {20, 0}, {20, 5}, {10, 5}, {10, 0}}},
+			},
+			Bounds: []orb.Bound{{Min: orb.Point{-10, 0}, Max: orb.Point{20, 5}}},
+		},
+		{
+			Name:     "points far apart",
+			Geometry: orb.MultiPoint{{-170, 0}, {170, 10}},
+			Bounds:   []orb.Bound{{Min: orb.Point{170, 0}, Max: orb.Point{180, 10}}, {Min: orb.Point{-180, 0}, Max: orb.Point{-170, 10}}},
+		},
+		{
+			Name:     "points close together",
+			Geometry: orb.MultiPoint{{-10, 0}, {10, 10}},
+			Bounds:   []orb.Bound{{Min: orb.Point{-10, 0}, Max: orb.Point{10, 10}}},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			bounds := AntimeridianBounds(test.Geometry)
+
+			if len(bounds) != len(test.Bounds) {
+				t.Fatalf("Expected %d bounds, got %d (%v)", len(test.Bounds), len(bounds), bounds)
+			}
+
+			for i, b := range test.Bounds {
+
+				if !b.Equal(bounds[i]) {
+					t.Fatalf("Expected bounds %d to be %v, got %v", i, b, bounds[i])
+				}
+			}
+		})
+	}
+}
+
+// polygonalArea returns the planar area, in square degrees, of the polygons in 'geom' less their interior rings.
+func polygonalArea(geom orb.Geometry) float64 {
+
+	area := 0.0
+
+	for _, part := range geometryParts(geom) {
+
+		p, ok := part.(orb.Polygon)
+
+		if !ok {
+			continue
+		}
+
+		for i, r := range p {
+
+			a := 0.0
+
+			for j := 1; j < len(r); j++ {
+				a += r[j-1].Lon()*r[j].Lat() - r[j].Lon()*r[j-1].Lat()
+			}
+
+			if i == 0 {
+				area += math.Abs(a / 2.0)
+			} else {
+				area -= math.Abs(a / 2.0)
+			}
+		}
+	}
+
+	return area
+}
+
+// lineLength returns the planar length, in degrees, of the lines in 'geom'.
+func lineLength(geom orb.Geometry) float64 {
+
+	length := 0.0
+
+	for _, part := range geometryParts(geom) {
+
+		ls, ok := part.(orb.LineString)
+
+		if !ok {
+			continue
+		}
+
+		for i := 1; i < len(ls); i++ {
+			length += math.Hypot(ls[i].Lon()-ls[i-1].Lon(), ls[i].Lat()-ls[i-1].Lat())
+		}
+	}
+
+	return length
+}
@@ -1,39 +1,55 @@
-// list will emit tile coverage information as CSV-encoded rows for one or more Who's On First records.
+// list will emit tile coverage information for one or more Who's On First records as CSV-encoded rows,
+// newline-delimited JSON, a GeoJSON FeatureCollection of tile polygons or quadkeys, or a report of coverage statistics.
+// Output is written to STDOUT or to any gocloud.dev/blob URI.
 package main
 
+import (
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/memblob"
+)
+
 import (
 	"context"
-	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/go-spatial/geom/slippy"
 	"github.com/sfomuseum/go-whosonfirst-tiles"
 	"github.com/sfomuseum/go-whosonfirst-tiles/coverage"
+	"github.com/sfomuseum/go-whosonfirst-tiles/list"
+	"github.com/sfomuseum/go-whosonfirst-tiles/stats"
 	"github.com/whosonfirst/go-whosonfirst-iterate/iterator"
 	"io"
 	"log"
 	"os"
-	"strconv"
-	"sync"
+	"runtime"
 )
 
 func main() {
 
 	iter_uri := flag.String("iterator-uri", "repo://", "A valid whosonfirst/go-whosonfirst-iterate/emitter URI.")
 	zoom_str := flag.String("zoom-levels", "10-18", "Comma-separated list of zoom levels or a '{MIN_ZOOM}-{MAX_ZOOM}' range string.")
+	coverage_method := flag.String("coverage-method", string(coverage.GEOMETRY_COVERAGE), "The method used to determine tile coverage. Valid options are: geometry, bounds.")
+	srid := flag.Uint("srid", tiles.SRID_WEB_MERCATOR, "The SRID of the tile grid to use. Valid options are: 3857, 4326.")
+	tms_path := flag.String("tile-matrix-set", "", "The path to an optional OGC Tile Matrix Set JSON document defining the tile grid to use. The document's coordinate reference system must be EPSG:3857, EPSG:4326 or OGC:CRS84; other systems are only supported by code using the tiles.NewTileMatrixSetWithProjection method. If present the -srid flag is ignored.")
+	relations := flag.Bool("relations", false, "If true each tile will include its relationship to the record's geometry (inside, partial, bounds) and the fraction of the tile covered by it. This flag is ignored if -compact is set.")
+	buffer := flag.Float64("buffer", 0, "An optional buffer used to also assign point and line features to the neighbouring tiles that their symbols overlap when rendered.")
+	buffer_unit := flag.String("buffer-unit", string(coverage.PIXEL_BUFFER), "The unit that -buffer is measured in. Valid options are: pixels, meters.")
+	buffer_tile_size := flag.Uint("buffer-tile-size", tiles.DEFAULT_TILE_SIZE, "The size, in pixels, of rendered tiles used to measure -buffer when -buffer-unit is pixels.")
+	compact := flag.String("compact", "", "Emit compact coverage information rather than individual tiles. Valid options are: ranges (emits {ID},{ZOOM},{MIN_X},{MIN_Y},{MAX_X},{MAX_Y} rows), quadtree (emits {ID},{ZOOM},{Z},{X},{Y} rows where a tile at a lower zoom level stands in for all its descendants at {ZOOM}).")
+	format := flag.String("format", string(list.CSV_FORMAT), "The format to emit coverage information in. Valid options are: csv, ndjson, geojson, quadkey.")
+	header := flag.Bool("header", false, "If true a header row will be written before the first row of csv or quadkey output.")
+	stats_mode := flag.Bool("stats", false, "If true emit a JSON-encoded report of coverage statistics, per zoom level and per placetype, including the estimated number and size of the tiles that would be produced rather than coverage information. The -format, -header, -relations and -compact flags are ignored.")
+	tile_overhead := flag.Int64("stats-tile-overhead", stats.DEFAULT_TILE_OVERHEAD, "The estimated size, in bytes, of an empty tile. This flag is only used if -stats is true.")
+	feature_size := flag.Int64("stats-feature-size", stats.DEFAULT_FEATURE_SIZE, "The estimated size, in bytes, of a single (cropped) record in a tile. This flag is only used if -stats is true.")
+	workers := flag.Int("workers", runtime.NumCPU(), "The maximum number of records to derive coverage for concurrently.")
+	output_uri := flag.String("output-uri", "", "An optional gocloud.dev/blob URI, whose path is the key of the object to write, for writing coverage information. If empty coverage information is written to STDOUT.")
 
 	flag.Parse()
 
 	uris := flag.Args()
 	ctx := context.Background()
 
-	writers := []io.Writer{
-		os.Stdout,
-	}
-
-	mw := io.MultiWriter(writers...)
-	csv_wr := csv.NewWriter(mw)
-	mu := new(sync.RWMutex)
-
 	coverage_opts, err := coverage.DefaultCoverageOptions()
 
 	if err != nil {
@@ -47,28 +63,110 @@ func main() {
 	}
 
 	coverage_opts.ZoomLevels = zoom_levels
+	var grid slippy.Grid
+
+	if *tms_path != "" {
+		grid, err = tiles.NewTileMatrixSetFromFile(*tms_path)
+	} else {
+		grid, err = tiles.NewGrid(*srid)
+	}
 
-	tile_cb := func(ctx context.Context, rsp *coverage.Coverage) error {
+	if err != nil {
+		log.Fatalf("Failed to create new grid, %v", err)
+	}
+
+	coverage_opts.Grid = grid
+	coverage_opts.Method = coverage.CoverageMethod(*coverage_method)
+	coverage_opts.Relations = *relations
+	coverage_opts.Buffer = *buffer
+	coverage_opts.BufferUnit = coverage.BufferUnit(*buffer_unit)
+	coverage_opts.TileSize = *buffer_tile_size
+
+	switch *compact {
+	case "", "ranges", "quadtree":
+		// pass
+	default:
+		log.Fatalf("Invalid -compact option '%s'", *compact)
+	}
 
-		// log.Printf("List tiles for %d at Z%d : %d\n", rsp.Id, rsp.Zoom, len(rsp.Tiles))
+	list_format := list.Format(*format)
+	content_type := list_format.ContentType()
 
-		mu.Lock()
-		defer mu.Unlock()
+	if *stats_mode {
+		content_type = "application/json"
+	}
 
-		for t, _ := range rsp.Tiles {
+	var wr io.WriteCloser
 
-			out := []string{
-				strconv.FormatInt(rsp.Id, 10),
-				strconv.Itoa(int(t.Z)),
-				strconv.Itoa(int(t.X)),
-				strconv.Itoa(int(t.Y)),
-			}
+	if *output_uri != "" {
 
-			csv_wr.Write(out)
+		wr, err = list.NewBlobOutput(ctx, *output_uri, content_type)
+
+		if err != nil {
+			log.Fatalf("Failed to create new output, %v", err)
 		}
 
-		csv_wr.Flush()
-		return nil
+	} else {
+		wr = os.Stdout
+	}
+
+	if *stats_mode {
+
+		stats_opts := &stats.StatsOptions{
+			CoverageOptions: coverage_opts,
+			TileOverhead:    *tile_overhead,
+			FeatureSize:     *feature_size,
+			Workers:         *workers,
+		}
+
+		s, err := stats.StatsWithIterator(ctx, stats_opts, *iter_uri, uris...)
+
+		if err != nil {
+			log.Fatalf("Failed to derive stats, %v", err)
+		}
+
+		enc := json.NewEncoder(wr)
+		enc.SetIndent("", "  ")
+
+		err = enc.Encode(s)
+
+		if err != nil {
+			log.Fatalf("Failed to encode stats, %v", err)
+		}
+
+		if *output_uri != "" {
+
+			err = wr.Close()
+
+			if err != nil {
+				log.Fatalf("Failed to close output, %v", err)
+			}
+		}
+
+		return
+	}
+
+	list_opts := &list.WriterOptions{
+		Format: list_format,
+		Header: *header,
+		Grid:   grid,
+	}
+
+	list_wr, err := list.NewWriter(ctx, wr, list_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create new list writer, %v", err)
+	}
+
+	batch_opts := &coverage.BatchOptions{
+		CoverageOptions: coverage_opts,
+		Workers:         *workers,
+	}
+
+	batch, err := coverage.NewBatch(ctx, batch_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create new coverage batch, %v", err)
 	}
 
 	iter_cb := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
@@ -79,7 +177,14 @@ func main() {
 			return fmt.Errorf("Failed to read record, %v", err)
 		}
 
-		return coverage.CoverageWithFeatureAndCallback(ctx, coverage_opts, body, tile_cb)
+		switch *compact {
+		case "ranges":
+			return batch.AddRanges(ctx, body, list_wr.WriteRangeCoverage)
+		case "quadtree":
+			return batch.AddQuadtree(ctx, body, list_wr.WriteQuadtreeCoverage)
+		default:
+			return batch.Add(ctx, body, list_wr.WriteCoverage)
+		}
 	}
 
 	iter, err := iterator.NewIterator(ctx, *iter_uri, iter_cb)
@@ -94,5 +199,24 @@ func main() {
 		log.Fatalf("Failed to iterator URIs, %v", err)
 	}
 
-	csv_wr.Flush()
+	err = batch.Wait()
+
+	if err != nil {
+		log.Fatalf("Failed to derive coverage, %v", err)
+	}
+
+	err = list_wr.Close(ctx)
+
+	if err != nil {
+		log.Fatalf("Failed to close list writer, %v", err)
+	}
+
+	if *output_uri != "" {
+
+		err = wr.Close()
+
+		if err != nil {
+			log.Fatalf("Failed to close output, %v", err)
+		}
+	}
 }
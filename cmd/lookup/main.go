@@ -0,0 +1,111 @@
+// lookup will build an inverted index mapping map tiles to the Who's On First records that cover them, along with
+// each record's placetype and the fraction of the tile it covers, for one or more Who's On First records. The index
+// is written to a SQLite database (sqlite://{PATH}) or as per-tile {Z}/{X}/{Y}.json documents to any gocloud.dev/blob
+// bucket. All of the heavy lifting is done by the lookup package.
+package main
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/memblob"
+)
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+	"github.com/sfomuseum/go-whosonfirst-tiles/coverage"
+	"github.com/sfomuseum/go-whosonfirst-tiles/lookup"
+	"log"
+	"strings"
+)
+
+func main() {
+
+	writer_uri := flag.String("writer-uri", "", fmt.Sprintf("A valid lookup.Writer URI for writing the lookup index. Valid schemes are: %s or any gocloud.dev/blob URI. Entries written to a gocloud.dev/blob URI are staged in a temporary SQLite database, in the default directory for temporary files, until all the records have been processed so that directory needs enough free space for the entire index.", strings.Join(lookup.Schemes(), ", ")))
+
+	iter_uri := flag.String("iterator-uri", "repo://", "A valid whosonfirst/go-whosonfirst-iterate/emitter URI.")
+	zoom_str := flag.String("zoom-levels", "10-18", "Comma-separated list of zoom levels or a '{MIN_ZOOM}-{MAX_ZOOM}' range string.")
+
+	coverage_method := flag.String("coverage-method", string(coverage.GEOMETRY_COVERAGE), "The method used to determine tile coverage. Valid options are: geometry, bounds.")
+	srid := flag.Uint("srid", tiles.SRID_WEB_MERCATOR, "The SRID of the tile grid to use. Valid options are: 3857, 4326.")
+	tms_path := flag.String("tile-matrix-set", "", "The path to an optional OGC Tile Matrix Set JSON document defining the tile grid to use. The document's coordinate reference system must be EPSG:3857, EPSG:4326 or OGC:CRS84; other systems are only supported by code using the tiles.NewTileMatrixSetWithProjection method. If present the -srid flag is ignored.")
+	buffer := flag.Float64("buffer", 0, "An optional buffer used to also assign point and line features to the neighbouring tiles that their symbols overlap when rendered.")
+	buffer_unit := flag.String("buffer-unit", string(coverage.PIXEL_BUFFER), "The unit that -buffer is measured in. Valid options are: pixels, meters.")
+	buffer_tile_size := flag.Uint("buffer-tile-size", tiles.DEFAULT_TILE_SIZE, "The size, in pixels, of rendered tiles used to measure -buffer when -buffer-unit is pixels.")
+
+	flag.Parse()
+
+	uris := flag.Args()
+	ctx := context.Background()
+
+	if *writer_uri == "" {
+		log.Fatalf("Missing -writer-uri flag")
+	}
+
+	lookup_writer, err := lookup.NewWriter(ctx, *writer_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to create new lookup writer, %v", err)
+	}
+
+	coverage_opts, err := coverage.DefaultCoverageOptions()
+
+	if err != nil {
+		log.Fatalf("Failed to create new optsion, %v", err)
+	}
+
+	zoom_levels, err := tiles.ZoomLevelsFromString(*zoom_str)
+
+	if err != nil {
+		log.Fatalf("Failed to derive zoom levels, %v", err)
+	}
+
+	coverage_opts.ZoomLevels = zoom_levels
+	var grid slippy.Grid
+
+	if *tms_path != "" {
+		grid, err = tiles.NewTileMatrixSetFromFile(*tms_path)
+	} else {
+		grid, err = tiles.NewGrid(*srid)
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to create new grid, %v", err)
+	}
+
+	coverage_opts.Grid = grid
+	coverage_opts.Method = coverage.CoverageMethod(*coverage_method)
+	coverage_opts.Buffer = *buffer
+	coverage_opts.BufferUnit = coverage.BufferUnit(*buffer_unit)
+	coverage_opts.TileSize = *buffer_tile_size
+
+	builder_opts := &lookup.BuilderOptions{
+		IteratorURI:     *iter_uri,
+		CoverageOptions: coverage_opts,
+		Writer:          lookup_writer,
+		Logger:          log.Default(),
+	}
+
+	b, err := lookup.NewBuilder(ctx, builder_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create new builder, %v", err)
+	}
+
+	summary, err := b.Build(ctx, uris...)
+
+	if err != nil {
+		log.Fatalf("Failed to build lookup index, %v", err)
+	}
+
+	err = lookup_writer.Close(ctx)
+
+	if err != nil {
+		log.Fatalf("Failed to close lookup writer, %v", err)
+	}
+
+	log.Printf("Processed %d records and wrote %d entries in %v\n", summary.Records, summary.Entries, summary.Duration)
+}
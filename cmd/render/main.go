@@ -1,10 +1,12 @@
 // render will generate tiles for one or more Who's On First records. This tool uses a two-pass approach. The first
-// pass collects all the cropped features associated with the map tiles for a given record and stores them as a GeoJSON
-// FeatureCollection. The second pass will iterate over those FeatureCollection records (associated with a map tile) and
-// generate a corresponding SVG file.
+// pass writes the cropped feature for each of the map tiles associated with a given record as a line-delimited GeoJSON
+// fragment keyed by tile ({Z}/{X}/{Y}/{WOF_ID}-{SEQUENCE}.geojsonl). The second pass will iterate over those fragments
+// (grouped by map tile) and generate a corresponding tile using a render.Renderer instance (for example SVG, PNG or
+// Mapbox Vector Tile data). All of the heavy lifting is done by the pipeline package.
 package main
 
 import (
+	_ "github.com/mattn/go-sqlite3"
 	_ "gocloud.dev/blob/fileblob"
 	_ "gocloud.dev/blob/memblob"
 )
@@ -14,35 +16,53 @@ import (
 	"flag"
 	"fmt"
 	"github.com/go-spatial/geom/slippy"
-	"github.com/paulmach/orb/geojson"
 	"github.com/sfomuseum/go-whosonfirst-tiles"
 	"github.com/sfomuseum/go-whosonfirst-tiles/coverage"
 	"github.com/sfomuseum/go-whosonfirst-tiles/crop"
+	"github.com/sfomuseum/go-whosonfirst-tiles/pipeline"
 	"github.com/sfomuseum/go-whosonfirst-tiles/render"
-	"github.com/whosonfirst/go-whosonfirst-iterate/iterator"
+	"github.com/sfomuseum/go-whosonfirst-tiles/writer"
 	"gocloud.dev/blob"
-	"io"
 	"log"
-	_ "os"
-	"regexp"
-	"strconv"
-	"sync"
+	"os"
+	"runtime"
+	"strings"
 )
 
 func main() {
 
 	data_bucket_uri := flag.String("data-bucket-uri", "mem://", "A valid gocloud.dev/blob URI for writing intermediate data records.")
-	tile_bucket_uri := flag.String("tile-bucket-uri", "mem://", "A valid gocloud.dev/blob URI for writing tile data.")
+	tile_bucket_uri := flag.String("tile-bucket-uri", "mem://", "A valid gocloud.dev/blob URI for writing tile data. This flag is ignored if -tile-writer-uri is set.")
+	tile_writer_uri := flag.String("tile-writer-uri", "", fmt.Sprintf("A valid writer.Writer URI for writing tile data. Valid schemes are: %s or any gocloud.dev/blob URI.", strings.Join(writer.Schemes(), ", ")))
 
 	iter_uri := flag.String("iterator-uri", "repo://", "A valid whosonfirst/go-whosonfirst-iterate/emitter URI.")
 
 	zoom_str := flag.String("zoom-levels", "10-18", "Comma-separated list of zoom levels or a '{MIN_ZOOM}-{MAX_ZOOM}' range string.")
+	renderer_uri := flag.String("renderer-uri", "svg://", fmt.Sprintf("A valid render.Renderer URI. Valid schemes are: %s.", strings.Join(render.Schemes(), ", ")))
+
+	gather_workers := flag.Int("gather-workers", 0, "The maximum number of records to process concurrently. If 0 the iterator's default is used.")
+	workers := flag.Int("workers", runtime.NumCPU(), "The maximum number of tiles to render concurrently.")
+
+	coverage_method := flag.String("coverage-method", string(coverage.GEOMETRY_COVERAGE), "The method used to determine tile coverage. Valid options are: geometry, bounds.")
+	srid := flag.Uint("srid", tiles.SRID_WEB_MERCATOR, "The SRID of the tile grid to use. Valid options are: 3857, 4326. The mbtiles:// and pmtiles:// writers only support 3857.")
+	tms_path := flag.String("tile-matrix-set", "", "The path to an optional OGC Tile Matrix Set JSON document defining the tile grid to use. The document's coordinate reference system must be EPSG:3857, EPSG:4326 or OGC:CRS84; other systems are only supported by code using the tiles.NewTileMatrixSetWithProjection method. If present the -srid flag is ignored.")
+	mask_path := flag.String("mask", "", "The path to an optional GeoJSON Feature, FeatureCollection or Geometry whose polygons all tiles will be restricted to. Records are cropped to the mask and records outside of it are skipped.")
+	fill_interior := flag.Bool("fill-interior-tiles", false, "If true tiles that are entirely covered by a record are filled with the tile's extent rather than cropping the record's geometry. This has no effect if tiles are buffered, either by -buffer or by the renderer (for example mvt://).")
+	buffer := flag.Float64("buffer", 0, "An optional buffer used to also assign point and line features to the neighbouring tiles that their symbols overlap when rendered.")
+	buffer_unit := flag.String("buffer-unit", string(coverage.PIXEL_BUFFER), "The unit that -buffer is measured in. Valid options are: pixels, meters.")
+	buffer_tile_size := flag.Uint("buffer-tile-size", 0, fmt.Sprintf("The size, in pixels, of rendered tiles used to measure -buffer when -buffer-unit is pixels. If 0 the tile size of the renderer (for example the ?tile_size= parameter of svg:// or the ?extent= parameter of mvt://) is used, or %d if the renderer does not define one.", tiles.DEFAULT_TILE_SIZE))
 
 	flag.Parse()
 
 	uris := flag.Args()
 	ctx := context.Background()
 
+	r, err := render.NewRenderer(ctx, *renderer_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to create new renderer, %v", err)
+	}
+
 	data_bucket, err := blob.OpenBucket(ctx, *data_bucket_uri)
 
 	if err != nil {
@@ -51,14 +71,16 @@ func main() {
 
 	defer data_bucket.Close()
 
-	tile_bucket, err := blob.OpenBucket(ctx, *tile_bucket_uri)
+	if *tile_writer_uri == "" {
+		*tile_writer_uri = *tile_bucket_uri
+	}
+
+	tile_writer, err := writer.NewWriter(ctx, *tile_writer_uri)
 
 	if err != nil {
-		log.Fatalf("Failed to open bucket, %v", err)
+		log.Fatalf("Failed to create new tile writer, %v", err)
 	}
 
-	defer tile_bucket.Close()
-
 	coverage_opts, err := coverage.DefaultCoverageOptions()
 
 	if err != nil {
@@ -72,248 +94,78 @@ func main() {
 	}
 
 	coverage_opts.ZoomLevels = zoom_levels
+	var grid slippy.Grid
 
-	// Step 1: Gather all the tile data to render
-
-	mu := new(sync.RWMutex)
-
-	iter_cb := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
-
-		body, err := io.ReadAll(fh)
-
-		if err != nil {
-			return fmt.Errorf("Failed to read record, %v", err)
-		}
-
-		tile_cb := func(ctx context.Context, rsp *coverage.Coverage) error {
-
-			for t, _ := range rsp.Tiles {
-
-				path := fmt.Sprintf("%d/%d/%d.geojson", t.Z, t.X, t.Y)
-				// log.Println(path)
-
-				cropped, err := crop.CropFeatureWithTile(ctx, body, t)
-
-				// This seems to be rooted in the orb/clip/clip.go ring()
-				// method which keeps returning nil but I don't know why
-				// yet...
-
-				if err != nil {
-					log.Printf("Failed to crop feature '%s', %v", path, err)
-					continue
-
-					// return fmt.Errorf("Failed to crop feature, %w", err)
-				}
-
-				cropped_f, err := geojson.UnmarshalFeature(cropped)
-
-				if err != nil {
-					return fmt.Errorf("Failed to unmarshal cropped feature for '%s', %w", path, err)
-				}
-
-				mu.Lock()
-				defer mu.Unlock()
-
-				exists, err := data_bucket.Exists(ctx, path)
-
-				if err != nil {
-					return fmt.Errorf("Failed to determine whether '%s' exists, %w", path, err)
-				}
-
-				var fc *geojson.FeatureCollection
-
-				if exists {
-
-					fh, err := data_bucket.NewReader(ctx, path, nil)
-
-					if err != nil {
-						return fmt.Errorf("Failed to open '%s', %w", path, err)
-					}
-
-					defer fh.Close()
-
-					body, err := io.ReadAll(fh)
-
-					if err != nil {
-						return fmt.Errorf("Failed to read '%s', %w", path, err)
-					}
-
-					doc, err := geojson.UnmarshalFeatureCollection(body)
-
-					if err != nil {
-						return fmt.Errorf("Failed to unmarshal '%s', %w", path, err)
-					}
-
-					fc = doc
-				} else {
-					fc = geojson.NewFeatureCollection()
-				}
-
-				fc.Append(cropped_f)
-
-				enc_fc, err := fc.MarshalJSON()
-
-				if err != nil {
-					return fmt.Errorf("Failed to marshal '%s', %w", path, err)
-				}
-
-				wr, err := data_bucket.NewWriter(ctx, path, nil)
-
-				if err != nil {
-					return fmt.Errorf("Failed to create new writer for '%s', %v", path, err)
-				}
-
-				_, err = wr.Write(enc_fc)
-
-				if err != nil {
-					return fmt.Errorf("Failed to write '%s', %w", path, err)
-				}
-
-				return wr.Close()
-			}
-
-			return nil
-		}
-
-		return coverage.CoverageWithFeatureAndCallback(ctx, coverage_opts, body, tile_cb)
+	if *tms_path != "" {
+		grid, err = tiles.NewTileMatrixSetFromFile(*tms_path)
+	} else {
+		grid, err = tiles.NewGrid(*srid)
 	}
 
-	iter, err := iterator.NewIterator(ctx, *iter_uri, iter_cb)
-
 	if err != nil {
-		log.Fatalf("Failed to create new iterator, %v", err)
+		log.Fatalf("Failed to create new grid, %v", err)
 	}
 
-	err = iter.IterateURIs(ctx, uris...)
+	// MBTiles and PMTiles databases can only store web mercator tiles.
 
-	if err != nil {
-		log.Fatalf("Failed to iterator URIs, %v", err)
+	if !writer.SupportsGrid(tile_writer, grid) {
+		log.Fatalf("Tile writer '%s' does not support the tile grid, only web mercator (EPSG:3857) tiles are supported", *tile_writer_uri)
 	}
 
-	// Step 1: Render the tile data
-
-	re, err := regexp.Compile(`(\d+)\/(\d+)\/(\d+)\.geojson$`)
-
-	if err != nil {
-		log.Fatalf("Failed to compile tile regular expression, %v", err)
+	coverage_opts.Grid = grid
+	coverage_opts.Method = coverage.CoverageMethod(*coverage_method)
+	coverage_opts.Relations = *fill_interior
+	coverage_opts.Buffer = *buffer
+	coverage_opts.BufferUnit = coverage.BufferUnit(*buffer_unit)
+	coverage_opts.TileSize = *buffer_tile_size
+
+	pipeline_opts := &pipeline.PipelineOptions{
+		IteratorURI:     *iter_uri,
+		CoverageOptions: coverage_opts,
+		Renderer:        r,
+		DataBucket:      data_bucket,
+		TileWriter:      tile_writer,
+		GatherWorkers:   *gather_workers,
+		RenderWorkers:   *workers,
+		Logger:          log.Default(),
 	}
 
-	var list func(context.Context, *blob.Bucket, string) error
-
-	list = func(ctx context.Context, data_bucket *blob.Bucket, prefix string) error {
-
-		iter := data_bucket.List(&blob.ListOptions{
-			Delimiter: "/",
-			Prefix:    prefix,
-		})
-
-		for {
-			obj, err := iter.Next(ctx)
-
-			if err == io.EOF {
-				break
-			}
-
-			if err != nil {
-				return err
-			}
-
-			path := obj.Key
-
-			if obj.IsDir {
-
-				err := list(ctx, data_bucket, path)
-
-				if err != nil {
-					return err
-				}
-
-				continue
-			}
-
-			//
-
-			m := re.FindStringSubmatch(path)
-
-			if len(m) == 0 {
-				continue
-			}
-
-			fh, err := data_bucket.NewReader(ctx, path, nil)
+	if *mask_path != "" {
 
-			if err != nil {
-				return fmt.Errorf("Failed to open '%s', %v", path, err)
-			}
+		mask_fh, err := os.Open(*mask_path)
 
-			defer fh.Close()
-
-			body, err := io.ReadAll(fh)
-
-			if err != nil {
-				return fmt.Errorf("Failed to read '%s', %v", path, err)
-			}
-
-			fc, err := geojson.UnmarshalFeatureCollection(body)
-
-			if err != nil {
-				return fmt.Errorf("Failed to unmarshal '%s', %v", path, err)
-			}
-
-			str_z := m[1]
-			str_x := m[2]
-			str_y := m[3]
-
-			z, _ := strconv.Atoi(str_z)
-			x, _ := strconv.Atoi(str_x)
-			y, _ := strconv.Atoi(str_y)
-
-			t_path := fmt.Sprintf("%d/%d/%d.svg", z, x, y)
-
-			// replace with maptile.Tile?
-			t := slippy.NewTile(uint(z), uint(x), uint(y))
-
-			wr, err := tile_bucket.NewWriter(ctx, t_path, nil)
-
-			if err != nil {
-				return fmt.Errorf("Failed to create new writer for '%s', %v", t_path, err)
-			}
-
-			extent := tiles.Extent4326(t)
-
-			svg_opts := render.DefaultSVGOptions()
-			svg_opts.TileExtent = extent
-			svg_opts.Writer = wr
-
-			err = render.RenderSVGWithFeatures(ctx, svg_opts, fc.Features...)
+		if err != nil {
+			log.Fatalf("Failed to open mask, %v", err)
+		}
 
-			if err != nil {
-				return fmt.Errorf("Failed to render '%s', %v", t_path, err)
-			}
+		mask, err := crop.MaskFromReader(mask_fh)
 
-			err = wr.Close()
+		mask_fh.Close()
 
-			if err != nil {
-				return fmt.Errorf("Failed to close '%s', %v", t_path, err)
-			}
+		if err != nil {
+			log.Fatalf("Failed to load mask, %v", err)
+		}
 
-			log.Println("Wrote", t_path)
+		pipeline_opts.Mask = mask
+	}
 
-			//
+	p, err := pipeline.NewPipeline(ctx, pipeline_opts)
 
-			err = data_bucket.Delete(ctx, path)
+	if err != nil {
+		log.Fatalf("Failed to create new pipeline, %v", err)
+	}
 
-			if err != nil {
-				log.Printf("Failed to delete '%s', %v", path, err)
-			}
-		}
+	summary, err := p.Run(ctx, uris...)
 
-		return nil
+	if err != nil {
+		log.Fatalf("Failed to run pipeline, %v", err)
 	}
 
-	err = list(ctx, data_bucket, "")
+	err = tile_writer.Close(ctx)
 
 	if err != nil {
-		log.Fatalf("Failed to list data bucket, %v", err)
+		log.Fatalf("Failed to close tile writer, %v", err)
 	}
 
+	log.Printf("Processed %d records and rendered %d tiles (%d fragments, %d skipped, %d empty, %d masked) in %v\n", summary.Records, summary.Tiles, summary.Fragments, summary.Skipped, summary.Empty, summary.Masked, summary.Duration)
 }
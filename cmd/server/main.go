@@ -0,0 +1,136 @@
+// server will render tiles for Who's On First records on demand. Records are loaded in to memory at start-up and
+// tiles are served from /{Z}/{X}/{Y}.{EXTENSION} where {EXTENSION} is the scheme of one of the -renderer-uri flags.
+package main
+
+import (
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/memblob"
+)
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+	"github.com/sfomuseum/go-whosonfirst-tiles/index"
+	"github.com/sfomuseum/go-whosonfirst-tiles/render"
+	"github.com/sfomuseum/go-whosonfirst-tiles/server"
+	"gocloud.dev/blob"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// multiString is a flag.Value for flags that can be assigned more than once.
+type multiString []string
+
+func (m *multiString) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *multiString) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+func main() {
+
+	var renderer_uris multiString
+
+	iter_uri := flag.String("iterator-uri", "repo://", "A valid whosonfirst/go-whosonfirst-iterate/emitter URI.")
+	flag.Var(&renderer_uris, "renderer-uri", fmt.Sprintf("One or more render.Renderer URIs. Each renderer is served using the URI's scheme as the tile extension. Valid schemes are: %s. Default is to enable all of them.", strings.Join(render.Schemes(), ", ")))
+	cache_uri := flag.String("cache-uri", "", "An optional gocloud.dev/blob URI for caching rendered tiles.")
+	srid := flag.Uint("srid", tiles.SRID_WEB_MERCATOR, "The SRID of the tile grid to use. Valid options are: 3857, 4326.")
+	tms_path := flag.String("tile-matrix-set", "", "The path to an optional OGC Tile Matrix Set JSON document defining the tile grid to use. The document's coordinate reference system must be EPSG:3857, EPSG:4326 or OGC:CRS84; other systems are only supported by code using the tiles.NewTileMatrixSetWithProjection method. If present the -srid flag is ignored.")
+
+	host := flag.String("host", "localhost", "The host name to listen for requests on.")
+	port := flag.Int("port", 8080, "The port number to listen for requests on.")
+
+	flag.Parse()
+
+	uris := flag.Args()
+	ctx := context.Background()
+
+	if len(renderer_uris) == 0 {
+		renderer_uris = render.Schemes()
+	}
+
+	renderers := make(map[string]render.Renderer)
+
+	for _, uri := range renderer_uris {
+
+		u, err := url.Parse(uri)
+
+		if err != nil {
+			log.Fatalf("Failed to parse renderer URI '%s', %v", uri, err)
+		}
+
+		r, err := render.NewRenderer(ctx, uri)
+
+		if err != nil {
+			log.Fatalf("Failed to create new renderer for '%s', %v", uri, err)
+		}
+
+		renderers[u.Scheme] = r
+	}
+
+	idx, err := index.NewIndexWithIterator(ctx, *iter_uri, uris...)
+
+	if err != nil {
+		log.Fatalf("Failed to index features, %v", err)
+	}
+
+	log.Printf("Indexed %d features\n", idx.Count())
+
+	var grid slippy.Grid
+
+	if *tms_path != "" {
+		grid, err = tiles.NewTileMatrixSetFromFile(*tms_path)
+	} else {
+		grid, err = tiles.NewGrid(*srid)
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to create new grid, %v", err)
+	}
+
+	handler_opts := &server.TileHandlerOptions{
+		Index:     idx,
+		Grid:      grid,
+		Renderers: renderers,
+		Logger:    log.Default(),
+	}
+
+	if *cache_uri != "" {
+
+		cache, err := blob.OpenBucket(ctx, *cache_uri)
+
+		if err != nil {
+			log.Fatalf("Failed to open cache, %v", err)
+		}
+
+		defer cache.Close()
+
+		handler_opts.Cache = cache
+	}
+
+	tile_handler, err := server.TileHandler(handler_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create tile handler, %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", tile_handler)
+
+	addr := fmt.Sprintf("%s:%d", *host, *port)
+	log.Printf("Listening for requests on %s\n", addr)
+
+	err = http.ListenAndServe(addr, mux)
+
+	if err != nil {
+		log.Fatalf("Failed to serve requests, %v", err)
+	}
+}
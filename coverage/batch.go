@@ -0,0 +1,259 @@
+package coverage
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// BatchOptions defines configuration options for a Batch instance.
+type BatchOptions struct {
+	// The CoverageOptions used to derive coverage for each record. Its Workers property is ignored since the zoom
+	// levels for each record are processed, in order, by a single worker.
+	CoverageOptions *CoverageOptions
+	// The maximum number of records to derive coverage for concurrently. If 0 then runtime.NumCPU() is used.
+	Workers int
+}
+
+// Batch derives coverage for a stream of Who's On First records using a fixed pool of workers shared by all the
+// records, rather than spawning goroutines for each record and zoom level. For example:
+//
+//	b, _ := coverage.NewBatch(ctx, opts)
+//
+//	iter_cb := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
+//		body, _ := io.ReadAll(fh)
+//		return b.Add(ctx, body, cb)
+//	}
+//
+//	...
+//
+//	err := b.Wait()
+type Batch struct {
+	options   *CoverageOptions
+	ctx       context.Context
+	cancel    context.CancelFunc
+	queue     chan *batchItem
+	wg        *sync.WaitGroup
+	mu        *sync.RWMutex
+	closed    bool
+	err_mu    *sync.Mutex
+	err       error
+	wait_once *sync.Once
+	wait_err  error
+}
+
+// batchItem is a single record waiting to be processed by a Batch worker.
+type batchItem struct {
+	body    []byte
+	process batchFunc
+}
+
+// batchFunc derives coverage, configured by 'opts', for the Who's On First record defined by 'body'.
+type batchFunc func(ctx context.Context, opts *CoverageOptions, body []byte) error
+
+// NewBatch returns a new Batch instance configured by 'opts' whose workers are started immediately. Cancelling 'ctx'
+// stops the workers.
+func NewBatch(ctx context.Context, opts *BatchOptions) (*Batch, error) {
+
+	if opts.CoverageOptions == nil {
+		return nil, fmt.Errorf("Missing coverage options")
+	}
+
+	if opts.Workers < 0 {
+		return nil, fmt.Errorf("Invalid number of workers")
+	}
+
+	workers := opts.Workers
+
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+
+	cover_opts := *opts.CoverageOptions
+	cover_opts.Workers = 1
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	b := &Batch{
+		options:   &cover_opts,
+		ctx:       ctx,
+		cancel:    cancel,
+		queue:     make(chan *batchItem),
+		wg:        new(sync.WaitGroup),
+		mu:        new(sync.RWMutex),
+		err_mu:    new(sync.Mutex),
+		wait_once: new(sync.Once),
+	}
+
+	for i := 0; i < workers; i++ {
+		b.wg.Add(1)
+		go b.work()
+	}
+
+	return b, nil
+}
+
+// CoverageWithFeatures derives coverage, configured by 'opts', for each of the Who's On First records read from
+// 'features' until it is closed. Coverage information for each record is dispatched to 'cb'. Coverage for a given
+// record is dispatched in the same order as the zoom levels defined in 'opts' but 'cb' may be invoked concurrently
+// for different records.
+func CoverageWithFeatures(ctx context.Context, opts *BatchOptions, features <-chan []byte, cb CoverageCallbackFunc) error {
+
+	b, err := NewBatch(ctx, opts)
+
+	if err != nil {
+		return err
+	}
+
+	for body := range features {
+
+		err := b.Add(ctx, body, cb)
+
+		if err != nil {
+			b.Wait()
+			return err
+		}
+	}
+
+	return b.Wait()
+}
+
+// Add queues the Who's On First record defined by 'body', blocking until a worker is available to process it.
+// Coverage information for the record is dispatched to 'cb' in the same order as the zoom levels defined in the
+// batch's CoverageOptions. 'cb' may be invoked concurrently for different records. If a previous record has failed
+// then its error is returned and the record is not queued.
+func (b *Batch) Add(ctx context.Context, body []byte, cb CoverageCallbackFunc) error {
+
+	process := func(ctx context.Context, opts *CoverageOptions, body []byte) error {
+		return CoverageWithFeatureAndCallback(ctx, opts, body, cb)
+	}
+
+	return b.add(ctx, body, process)
+}
+
+// AddRanges queues the Who's On First record defined by 'body' in the same way as Add but dispatches compact,
+// range-based coverage information for the record to 'cb'. See RangeCoverageWithFeatureAndCallback for details.
+func (b *Batch) AddRanges(ctx context.Context, body []byte, cb RangeCoverageCallbackFunc) error {
+
+	process := func(ctx context.Context, opts *CoverageOptions, body []byte) error {
+		return RangeCoverageWithFeatureAndCallback(ctx, opts, body, cb)
+	}
+
+	return b.add(ctx, body, process)
+}
+
+// AddQuadtree queues the Who's On First record defined by 'body' in the same way as Add but dispatches minimal,
+// mixed-zoom quadtree coverage information for the record to 'cb'. See QuadtreeCoverageWithFeatureAndCallback for
+// details.
+func (b *Batch) AddQuadtree(ctx context.Context, body []byte, cb QuadtreeCoverageCallbackFunc) error {
+
+	process := func(ctx context.Context, opts *CoverageOptions, body []byte) error {
+		return QuadtreeCoverageWithFeatureAndCallback(ctx, opts, body, cb)
+	}
+
+	return b.add(ctx, body, process)
+}
+
+// add queues the Who's On First record defined by 'body' to be processed by 'process'.
+func (b *Batch) add(ctx context.Context, body []byte, process batchFunc) error {
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return fmt.Errorf("Batch has been closed")
+	}
+
+	// An idle worker would otherwise race the batch's context in the select statement below and records could
+	// still be queued after the batch has failed or been cancelled.
+
+	if b.ctx.Err() != nil {
+		return b.contextError()
+	}
+
+	item := &batchItem{
+		body:    body,
+		process: process,
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.ctx.Done():
+		return b.contextError()
+	case b.queue <- item:
+		return nil
+	}
+}
+
+// Wait stops accepting new records, waits for all the queued records to be processed and returns the first error
+// encountered, if any. It is safe to call Wait more than once and subsequent calls return the same result as the first.
+func (b *Batch) Wait() error {
+
+	b.mu.Lock()
+
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+
+	b.mu.Unlock()
+
+	b.wg.Wait()
+
+	// The batch's context is cancelled once it is done so the result is recorded first, otherwise later calls would
+	// report context.Canceled.
+
+	b.wait_once.Do(func() {
+		b.wait_err = b.contextError()
+		b.cancel()
+	})
+
+	return b.wait_err
+}
+
+// work processes queued records until the queue is closed. Once a record fails the remaining records are drained
+// without being processed.
+func (b *Batch) work() {
+
+	defer b.wg.Done()
+
+	for item := range b.queue {
+
+		if b.ctx.Err() != nil {
+			continue
+		}
+
+		err := item.process(b.ctx, b.options, item.body)
+
+		if err != nil {
+			b.setError(err)
+		}
+	}
+}
+
+// setError records 'err' if it is the first error encountered and stops any further records from being processed.
+func (b *Batch) setError(err error) {
+
+	b.err_mu.Lock()
+	defer b.err_mu.Unlock()
+
+	if b.err == nil {
+		b.err = err
+		b.cancel()
+	}
+}
+
+// contextError returns the first error encountered by a worker or, failing that, the error of the batch's context.
+func (b *Batch) contextError() error {
+
+	b.err_mu.Lock()
+	defer b.err_mu.Unlock()
+
+	if b.err != nil {
+		return b.err
+	}
+
+	return b.ctx.Err()
+}
@@ -0,0 +1,338 @@
+package coverage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestBatchZoomOrder(t *testing.T) {
+
+	cover_opts, err := DefaultCoverageOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to create coverage options, %v", err)
+	}
+
+	cover_opts.ZoomLevels = []uint{12, 3, 8, 0, 14}
+
+	opts := &BatchOptions{
+		CoverageOptions: cover_opts,
+		Workers:         4,
+	}
+
+	ctx := context.Background()
+
+	b, err := NewBatch(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create batch, %v", err)
+	}
+
+	mu := new(sync.Mutex)
+	zooms := make(map[int64][]uint)
+
+	cb := func(ctx context.Context, c *Coverage) error {
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		zooms[c.Id] = append(zooms[c.Id], c.Zoom)
+		return nil
+	}
+
+	count := 50
+
+	for i := 0; i < count; i++ {
+
+		err := b.Add(ctx, pointFeature(int64(i), -122.0+float64(i)*0.01, 37.0+float64(i)*0.01), cb)
+
+		if err != nil {
+			t.Fatalf("Failed to add record %d, %v", i, err)
+		}
+	}
+
+	err = b.Wait()
+
+	if err != nil {
+		t.Fatalf("Batch failed, %v", err)
+	}
+
+	if len(zooms) != count {
+		t.Fatalf("Expected coverage for %d records, got %d", count, len(zooms))
+	}
+
+	for id, z := range zooms {
+
+		if fmt.Sprintf("%v", z) != fmt.Sprintf("%v", cover_opts.ZoomLevels) {
+			t.Fatalf("Expected zoom levels %v for record %d, got %v", cover_opts.ZoomLevels, id, z)
+		}
+	}
+
+	err = b.Add(ctx, pointFeature(int64(count), 0, 0), cb)
+
+	if err == nil {
+		t.Fatalf("Expected adding a record to a closed batch to fail")
+	}
+}
+
+func TestBatchCompact(t *testing.T) {
+
+	cover_opts, err := DefaultCoverageOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to create coverage options, %v", err)
+	}
+
+	cover_opts.ZoomLevels = []uint{4, 8}
+
+	opts := &BatchOptions{
+		CoverageOptions: cover_opts,
+		Workers:         4,
+	}
+
+	ctx := context.Background()
+
+	b, err := NewBatch(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create batch, %v", err)
+	}
+
+	mu := new(sync.Mutex)
+	ranges := 0
+	quadtrees := 0
+
+	range_cb := func(ctx context.Context, c *RangeCoverage) error {
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		ranges += 1
+		return nil
+	}
+
+	quadtree_cb := func(ctx context.Context, c *QuadtreeCoverage) error {
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		quadtrees += 1
+		return nil
+	}
+
+	count := 10
+
+	for i := 0; i < count; i++ {
+
+		body := pointFeature(int64(i), float64(i), float64(i))
+
+		err := b.AddRanges(ctx, body, range_cb)
+
+		if err != nil {
+			t.Fatalf("Failed to add record %d for ranges, %v", i, err)
+		}
+
+		err = b.AddQuadtree(ctx, body, quadtree_cb)
+
+		if err != nil {
+			t.Fatalf("Failed to add record %d for quadtree, %v", i, err)
+		}
+	}
+
+	err = b.Wait()
+
+	if err != nil {
+		t.Fatalf("Batch failed, %v", err)
+	}
+
+	expected := count * len(cover_opts.ZoomLevels)
+
+	if ranges != expected {
+		t.Fatalf("Expected %d range coverage results, got %d", expected, ranges)
+	}
+
+	if quadtrees != expected {
+		t.Fatalf("Expected %d quadtree coverage results, got %d", expected, quadtrees)
+	}
+}
+
+func TestBatchFirstError(t *testing.T) {
+
+	cover_opts, err := DefaultCoverageOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to create coverage options, %v", err)
+	}
+
+	cover_opts.ZoomLevels = []uint{1, 2, 3}
+
+	// A single worker processes records in the order they were added so the first failure is deterministic.
+
+	opts := &BatchOptions{
+		CoverageOptions: cover_opts,
+		Workers:         1,
+	}
+
+	ctx := context.Background()
+
+	b, err := NewBatch(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create batch, %v", err)
+	}
+
+	err_first := errors.New("first")
+	err_second := errors.New("second")
+
+	mu := new(sync.Mutex)
+	processed := make([]int64, 0)
+
+	cb := func(ctx context.Context, c *Coverage) error {
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		processed = append(processed, c.Id)
+
+		switch c.Id {
+		case 2:
+			return err_first
+		case 3:
+			return err_second
+		default:
+			return nil
+		}
+	}
+
+	for i := 1; i <= 5; i++ {
+
+		err := b.Add(ctx, pointFeature(int64(i), 0, 0), cb)
+
+		if err != nil {
+
+			if !errors.Is(err, err_first) {
+				t.Fatalf("Expected adding record %d to return the first error, got %v", i, err)
+			}
+
+			break
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+
+		err = b.Wait()
+
+		if !errors.Is(err, err_first) {
+			t.Fatalf("Expected call %d to Wait to return the first error, got %v", i+1, err)
+		}
+	}
+
+	for _, id := range processed {
+
+		if id > 2 {
+			t.Fatalf("Record %d was processed after record 2 failed", id)
+		}
+	}
+}
+
+func TestBatchCancel(t *testing.T) {
+
+	cover_opts, err := DefaultCoverageOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to create coverage options, %v", err)
+	}
+
+	cover_opts.ZoomLevels = []uint{1, 2, 3}
+
+	opts := &BatchOptions{
+		CoverageOptions: cover_opts,
+		Workers:         2,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b, err := NewBatch(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create batch, %v", err)
+	}
+
+	cb := func(ctx context.Context, c *Coverage) error {
+		return nil
+	}
+
+	err = b.Add(ctx, pointFeature(1, 0, 0), cb)
+
+	if err != nil {
+		t.Fatalf("Failed to add record, %v", err)
+	}
+
+	cancel()
+
+	err = b.Add(context.Background(), pointFeature(2, 0, 0), cb)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected adding a record to a cancelled batch to return context.Canceled, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+
+		err = b.Wait()
+
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected call %d to Wait to return context.Canceled, got %v", i+1, err)
+		}
+	}
+}
+
+func TestCoverageWithFeatures(t *testing.T) {
+
+	cover_opts, err := DefaultCoverageOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to create coverage options, %v", err)
+	}
+
+	cover_opts.ZoomLevels = []uint{4, 8}
+
+	opts := &BatchOptions{
+		CoverageOptions: cover_opts,
+	}
+
+	features := make(chan []byte)
+
+	go func() {
+
+		defer close(features)
+
+		for i := 0; i < 20; i++ {
+			features <- pointFeature(int64(i), float64(i), float64(i))
+		}
+	}()
+
+	mu := new(sync.Mutex)
+	count := 0
+
+	cb := func(ctx context.Context, c *Coverage) error {
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		count += 1
+		return nil
+	}
+
+	err = CoverageWithFeatures(context.Background(), opts, features, cb)
+
+	if err != nil {
+		t.Fatalf("Failed to derive coverage, %v", err)
+	}
+
+	if count != 40 {
+		t.Fatalf("Expected 40 coverage results, got %d", count)
+	}
+}
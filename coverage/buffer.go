@@ -0,0 +1,264 @@
+package coverage
+
+import (
+	"fmt"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/project"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+	"math"
+)
+
+// BufferUnit defines the units that a coverage buffer is measured in.
+type BufferUnit string
+
+// PIXEL_BUFFER signals that a coverage buffer is measured in pixels for tiles rendered at CoverageOptions.TileSize.
+// The size of the buffer on the ground changes with each zoom level so that a symbol of a fixed size (for example a
+// marker for a point) is always assigned to the tiles it would be drawn on.
+const PIXEL_BUFFER BufferUnit = "pixels"
+
+// METER_BUFFER signals that a coverage buffer is measured in metres on the ground.
+const METER_BUFFER BufferUnit = "meters"
+
+// The (approximate) number of metres in one degree of latitude.
+const meters_per_degree float64 = 2 * math.Pi * 6378137.0 / 360.0
+
+// BufferedTileBound returns the geographic (EPSG:4326) bounds of 't', in the grid defined by 'opts', expanded by the
+// buffer defined in 'opts'. This is the area that features assigned to 't' by a buffer are expected to be cropped to.
+// If 'opts' does not define a buffer then this is the same as calling tiles.TileBound.
+func BufferedTileBound(opts *CoverageOptions, t maptile.Tile) (orb.Bound, error) {
+
+	if opts.Buffer <= 0 {
+		return tiles.TileBound(opts.Grid, t)
+	}
+
+	ext, err := tiles.TileExtent(opts.Grid, t)
+
+	if err != nil {
+		return orb.Bound{}, err
+	}
+
+	dx, dy, err := bufferDistance(opts, ext)
+
+	if err != nil {
+		return orb.Bound{}, err
+	}
+
+	return tiles.BufferedTileBound(opts.Grid, t, dx, dy)
+}
+
+// bufferCover returns the set of tiles at zoom level 'z', in the grid defined by 'opts', whose extent expanded by the
+// buffer defined in 'opts' intersects the points and lines in 'geom'. Polygons are not buffered since they are already
+// assigned to every tile they intersect. If 'opts' does not define a buffer then an empty set is returned. Buffers are
+// not wrapped around the antimeridian.
+func bufferCover(opts *CoverageOptions, geom orb.Geometry, z maptile.Zoom) (maptile.Set, error) {
+
+	buffered := make(maptile.Set)
+
+	if opts.Buffer <= 0 {
+		return buffered, nil
+	}
+
+	lines := nonPolygonal(geom)
+
+	if lines == nil {
+		return buffered, nil
+	}
+
+	cover, err := gridCover(opts.Grid, lines, z)
+
+	if err != nil {
+		return nil, err
+	}
+
+	proj, err := tiles.ToNativeProjection(opts.Grid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	native_lines := project.Geometry(orb.Clone(lines), proj)
+
+	tested := make(maptile.Set)
+
+	for t, _ := range cover {
+
+		buffered[t] = true
+
+		ext, err := tiles.TileExtent(opts.Grid, t)
+
+		if err != nil {
+			return nil, err
+		}
+
+		dx, dy, err := bufferDistance(opts, ext)
+
+		if err != nil {
+			return nil, err
+		}
+
+		min, max, ok := extentRange(opts.Grid, growBound(ext, dx, dy), z)
+
+		if !ok {
+			continue
+		}
+
+		for x := min.X; x <= max.X; x++ {
+			for y := min.Y; y <= max.Y; y++ {
+
+				c := maptile.New(x, y, z)
+
+				if cover[c] || tested[c] {
+					continue
+				}
+
+				tested[c] = true
+
+				c_ext, err := tiles.TileExtent(opts.Grid, c)
+
+				if err != nil {
+					return nil, err
+				}
+
+				c_dx, c_dy, err := bufferDistance(opts, c_ext)
+
+				if err != nil {
+					return nil, err
+				}
+
+				clipped := clip.Geometry(growBound(c_ext, c_dx, c_dy), orb.Clone(native_lines))
+
+				if !isEmpty(clipped) {
+					buffered[c] = true
+				}
+			}
+		}
+	}
+
+	return buffered, nil
+}
+
+// bufferDistance returns the horizontal and vertical size of the buffer defined in 'opts', in the native coordinates
+// of the grid defined in 'opts', for the tile whose extent is 'ext'. METER_BUFFER buffers are measured at the centre
+// of 'ext'.
+func bufferDistance(opts *CoverageOptions, ext orb.Bound) (float64, float64, error) {
+
+	switch opts.BufferUnit {
+	case PIXEL_BUFFER, "":
+
+		tile_size := opts.TileSize
+
+		if tile_size == 0 {
+			tile_size = tiles.DEFAULT_TILE_SIZE
+		}
+
+		dx := (ext.Max.X() - ext.Min.X()) / float64(tile_size) * opts.Buffer
+		dy := (ext.Max.Y() - ext.Min.Y()) / float64(tile_size) * opts.Buffer
+
+		return dx, dy, nil
+
+	case METER_BUFFER:
+
+		to_native, err := tiles.ToNativeProjection(opts.Grid)
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		from_native, err := tiles.FromNativeProjection(opts.Grid)
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		center := from_native(ext.Center())
+
+		lon := center.Lon()
+		lat := math.Max(math.Min(center.Lat(), 85.0), -85.0)
+
+		dlat := math.Min(opts.Buffer/meters_per_degree, 85.0)
+		dlon := dlat / math.Cos(lat*math.Pi/180.0)
+
+		// Measure the vertical distance towards the equator so that it never crosses a pole.
+
+		if lat > 0 {
+			dlat = -dlat
+		}
+
+		pt := to_native(orb.Point{lon, lat})
+		east := to_native(orb.Point{lon + dlon, lat})
+		north := to_native(orb.Point{lon, lat + dlat})
+
+		dx := math.Abs(east.X() - pt.X())
+		dy := math.Abs(north.Y() - pt.Y())
+
+		return dx, dy, nil
+
+	default:
+		return 0, 0, fmt.Errorf("Invalid buffer unit '%s'", opts.BufferUnit)
+	}
+}
+
+// extentRange returns the range of tiles at zoom level 'z' in 'g' that intersect 'ext', which is expected to be in
+// the native coordinates of 'g'. The range is clamped to the tiles in the grid.
+func extentRange(g slippy.Grid, ext orb.Bound, z maptile.Zoom) (maptile.Tile, maptile.Tile, bool) {
+
+	if !tiles.IsWebMercator(g) {
+		return tileRange(g, ext, z)
+	}
+
+	n := float64(uint64(1) << uint32(z))
+
+	clamp := func(v float64) uint32 {
+		return uint32(math.Max(math.Min(math.Floor(v), n-1), 0))
+	}
+
+	tl := maptile.Fraction(project.Mercator.ToWGS84(orb.Point{ext.Min.X(), ext.Max.Y()}), z)
+	br := maptile.Fraction(project.Mercator.ToWGS84(orb.Point{ext.Max.X(), ext.Min.Y()}), z)
+
+	min := maptile.New(clamp(tl.X()), clamp(tl.Y()), z)
+	max := maptile.New(clamp(br.X()), clamp(br.Y()), z)
+
+	return min, max, true
+}
+
+// growBound returns a copy of 'b' expanded by 'dx' horizontally and 'dy' vertically on each side.
+func growBound(b orb.Bound, dx float64, dy float64) orb.Bound {
+
+	return orb.Bound{
+		Min: orb.Point{b.Min.X() - dx, b.Min.Y() - dy},
+		Max: orb.Point{b.Max.X() + dx, b.Max.Y() + dy},
+	}
+}
+
+// nonPolygonal returns the points and lines in 'geom' or nil if there are none.
+func nonPolygonal(geom orb.Geometry) orb.Geometry {
+
+	switch g := geom.(type) {
+	case orb.Point, orb.MultiPoint, orb.LineString, orb.MultiLineString:
+		return g
+	case orb.Collection:
+
+		c := make(orb.Collection, 0)
+
+		for _, cg := range g {
+
+			ng := nonPolygonal(cg)
+
+			if ng != nil {
+				c = append(c, ng)
+			}
+		}
+
+		if len(c) == 0 {
+			return nil
+		}
+
+		return c
+
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,688 @@
+package coverage
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"sort"
+)
+
+// TileRange is a rectangular range of tiles, inclusive of its minimum and maximum tiles, at a single zoom level.
+type TileRange struct {
+	// The zoom level of the tiles in the range.
+	Zoom maptile.Zoom `json:"zoom"`
+	// The smallest X (column) value in the range.
+	MinX uint32 `json:"min_x"`
+	// The smallest Y (row) value in the range.
+	MinY uint32 `json:"min_y"`
+	// The largest X (column) value in the range.
+	MaxX uint32 `json:"max_x"`
+	// The largest Y (row) value in the range.
+	MaxY uint32 `json:"max_y"`
+}
+
+// TileCallbackFunc is a user-defined callback function invoked for each individual tile when expanding a compact
+// coverage result.
+type TileCallbackFunc func(context.Context, maptile.Tile) error
+
+// RangeCoverage is a compact alternative to Coverage where the tiles that cover a feature at a given zoom level
+// are expressed as a list of merged, non-overlapping rectangular tile ranges.
+type RangeCoverage struct {
+	// The Who's On First ID of the record being processed.
+	Id int64
+	// The zoom level being processed.
+	Zoom uint
+	// The list of tile ranges that cover feature 'Id' at zoom level 'Zoom', ordered by row and then column.
+	Ranges []TileRange
+}
+
+// QuadtreeCoverage is a compact alternative to Coverage where the tiles that cover a feature at a given zoom level
+// are expressed as a minimal, mixed-zoom quadtree cover. A tile at a zoom level lower than 'Zoom' stands in for all
+// of its descendants at zoom level 'Zoom'.
+type QuadtreeCoverage struct {
+	// The Who's On First ID of the record being processed.
+	Id int64
+	// The zoom level being processed.
+	Zoom uint
+	// The list of (mixed-zoom) tiles that cover feature 'Id' at zoom level 'Zoom', ordered by zoom level, column
+	// and then row.
+	Tiles maptile.Tiles
+}
+
+// RangeCoverageCallbackFunc is a user-defined callback function invoked by RangeCoverageWithFeatureAndCallback method.
+type RangeCoverageCallbackFunc func(context.Context, *RangeCoverage) error
+
+// QuadtreeCoverageCallbackFunc is a user-defined callback function invoked by QuadtreeCoverageWithFeatureAndCallback method.
+type QuadtreeCoverageCallbackFunc func(context.Context, *QuadtreeCoverage) error
+
+// interval is an inclusive range of columns in a single row of tiles.
+type interval struct {
+	min uint32
+	max uint32
+}
+
+// Count returns the number of tiles in 'r'.
+func (r TileRange) Count() uint64 {
+	return uint64(r.MaxX-r.MinX+1) * uint64(r.MaxY-r.MinY+1)
+}
+
+// Contains returns true if 't' is contained by 'r'.
+func (r TileRange) Contains(t maptile.Tile) bool {
+	return t.Z == r.Zoom && t.X >= r.MinX && t.X <= r.MaxX && t.Y >= r.MinY && t.Y <= r.MaxY
+}
+
+// Iterate invokes 'cb' for each individual tile in 'r'.
+func (r TileRange) Iterate(ctx context.Context, cb TileCallbackFunc) error {
+
+	for y := r.MinY; y <= r.MaxY; y++ {
+
+		for x := r.MinX; x <= r.MaxX; x++ {
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+				// pass
+			}
+
+			err := cb(ctx, maptile.New(x, y, r.Zoom))
+
+			if err != nil {
+				return err
+			}
+
+			if x == r.MaxX {
+				break
+			}
+		}
+
+		if y == r.MaxY {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Count returns the number of individual tiles in 'c'.
+func (c *RangeCoverage) Count() uint64 {
+
+	count := uint64(0)
+
+	for _, r := range c.Ranges {
+		count += r.Count()
+	}
+
+	return count
+}
+
+// Iterate invokes 'cb' for each individual tile in 'c'.
+func (c *RangeCoverage) Iterate(ctx context.Context, cb TileCallbackFunc) error {
+
+	for _, r := range c.Ranges {
+
+		err := r.Iterate(ctx, cb)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Coverage expands 'c' in to a Coverage instance containing each individual tile.
+func (c *RangeCoverage) Coverage() *Coverage {
+
+	cover := make(maptile.Set)
+
+	for _, r := range c.Ranges {
+
+		r.Iterate(context.Background(), func(ctx context.Context, t maptile.Tile) error {
+			cover[t] = true
+			return nil
+		})
+	}
+
+	return &Coverage{
+		Id:    c.Id,
+		Zoom:  c.Zoom,
+		Tiles: cover,
+	}
+}
+
+// Count returns the number of individual tiles at zoom level 'c.Zoom' in 'c'.
+func (c *QuadtreeCoverage) Count() uint64 {
+
+	count := uint64(0)
+
+	for _, t := range c.Tiles {
+		count += uint64(1) << (2 * (uint32(c.Zoom) - uint32(t.Z)))
+	}
+
+	return count
+}
+
+// Iterate invokes 'cb' for each individual tile at zoom level 'c.Zoom' in 'c'.
+func (c *QuadtreeCoverage) Iterate(ctx context.Context, cb TileCallbackFunc) error {
+
+	for _, r := range c.tileRanges() {
+
+		err := r.Iterate(ctx, cb)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ranges returns the tiles in 'c' as a list of merged, non-overlapping rectangular tile ranges at zoom level 'c.Zoom'.
+func (c *QuadtreeCoverage) Ranges() []TileRange {
+	return MergeTileRanges(c.tileRanges()...)
+}
+
+// Coverage expands 'c' in to a Coverage instance containing each individual tile at zoom level 'c.Zoom'.
+func (c *QuadtreeCoverage) Coverage() *Coverage {
+
+	rc := &RangeCoverage{
+		Id:     c.Id,
+		Zoom:   c.Zoom,
+		Ranges: c.tileRanges(),
+	}
+
+	return rc.Coverage()
+}
+
+// tileRanges returns the range of tiles at zoom level 'c.Zoom' for each of the tiles in 'c'.
+func (c *QuadtreeCoverage) tileRanges() []TileRange {
+
+	z := maptile.Zoom(uint32(c.Zoom))
+	ranges := make([]TileRange, len(c.Tiles))
+
+	for i, t := range c.Tiles {
+		ranges[i] = tileRangeForTile(t, z)
+	}
+
+	return ranges
+}
+
+// MergeTiles returns the tiles in 'set' as a list of merged, non-overlapping rectangular tile ranges. Tiles are
+// merged in to runs of consecutive columns for each row and then runs with the same columns in consecutive rows are
+// merged in to a single range. Ranges are ordered by zoom level, row and then column.
+func MergeTiles(set maptile.Set) []TileRange {
+
+	by_zoom := make(map[maptile.Zoom]map[uint32][]interval)
+
+	for t, _ := range set {
+
+		rows, ok := by_zoom[t.Z]
+
+		if !ok {
+			rows = make(map[uint32][]interval)
+			by_zoom[t.Z] = rows
+		}
+
+		rows[t.Y] = append(rows[t.Y], interval{t.X, t.X})
+	}
+
+	return mergeRows(by_zoom)
+}
+
+// MergeTileRanges returns the union of 'ranges' as a list of merged, non-overlapping rectangular tile ranges ordered
+// by zoom level, row and then column.
+func MergeTileRanges(ranges ...TileRange) []TileRange {
+
+	by_zoom := make(map[maptile.Zoom]map[uint32][]interval)
+
+	for _, r := range ranges {
+
+		rows, ok := by_zoom[r.Zoom]
+
+		if !ok {
+			rows = make(map[uint32][]interval)
+			by_zoom[r.Zoom] = rows
+		}
+
+		for y := r.MinY; y <= r.MaxY; y++ {
+
+			rows[y] = append(rows[y], interval{r.MinX, r.MaxX})
+
+			if y == r.MaxY {
+				break
+			}
+		}
+	}
+
+	return mergeRows(by_zoom)
+}
+
+// CollapseTiles returns a minimal, mixed-zoom quadtree cover for the tiles in 'set' where any four sibling tiles
+// are replaced by their parent tile, recursively. This assumes that each zoom level of the grid that 'set' is
+// addressed in is a quadtree subdivision of the zoom level before it. Tiles are ordered by zoom level, column and
+// then row.
+func CollapseTiles(set maptile.Set) maptile.Tiles {
+
+	cover := make(maptile.Set)
+	max_z := maptile.Zoom(0)
+
+	for t, _ := range set {
+
+		cover[t] = true
+
+		if t.Z > max_z {
+			max_z = t.Z
+		}
+	}
+
+	for z := max_z; z > 0; z-- {
+
+		siblings := make(map[maptile.Tile]int)
+
+		for t, _ := range cover {
+
+			if t.Z == z {
+				siblings[t.Parent()] += 1
+			}
+		}
+
+		for p, count := range siblings {
+
+			if count != 4 {
+				continue
+			}
+
+			for _, t := range p.Children() {
+				delete(cover, t)
+			}
+
+			cover[p] = true
+		}
+	}
+
+	return sortedTiles(cover)
+}
+
+// RangeCoverageWithFeature returns a list of RangeCoverage instances, one for each zoom level defined in 'opts', for a Who's On First record.
+func RangeCoverageWithFeature(ctx context.Context, opts *CoverageOptions, body []byte) ([]*RangeCoverage, error) {
+
+	results := make([]*RangeCoverage, 0)
+
+	cb := func(ctx context.Context, rsp *RangeCoverage) error {
+		results = append(results, rsp)
+		return nil
+	}
+
+	err := RangeCoverageWithFeatureAndCallback(ctx, opts, body, cb)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// RangeCoverageWithFeatureAndCallback will dispatch compact, range-based coverage information for each zoom level
+// defined in 'opts' to a callback function defined in 'cb'. For grids that are quadtree subdivisions of themselves
+// the individual tiles at each zoom level are never held in memory.
+func RangeCoverageWithFeatureAndCallback(ctx context.Context, opts *CoverageOptions, body []byte, cb RangeCoverageCallbackFunc) error {
+
+	id, geom, cover_geom, err := coverageGeometry(opts, body)
+
+	if err != nil {
+		return err
+	}
+
+	for _, z := range opts.ZoomLevels {
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// pass
+		}
+
+		mz := maptile.Zoom(uint32(z))
+
+		buffered, err := bufferCover(opts, geom, mz)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive buffered coverage at zoom level %d, %w", z, err)
+		}
+
+		var ranges []TileRange
+
+		if isQuadtree(opts.Grid, mz) {
+
+			cover, err := quadtreeCover(opts.Grid, cover_geom, mz)
+
+			if err != nil {
+				return fmt.Errorf("Failed to derive coverage at zoom level %d, %w", z, err)
+			}
+
+			tile_ranges := make([]TileRange, len(cover))
+
+			for i, t := range cover {
+				tile_ranges[i] = tileRangeForTile(t, mz)
+			}
+
+			for t, _ := range buffered {
+				tile_ranges = append(tile_ranges, tileRangeForTile(t, mz))
+			}
+
+			ranges = MergeTileRanges(tile_ranges...)
+
+		} else {
+
+			cover, err := gridCover(opts.Grid, cover_geom, mz)
+
+			if err != nil {
+				return fmt.Errorf("Failed to derive coverage at zoom level %d, %w", z, err)
+			}
+
+			for t, _ := range buffered {
+				cover[t] = true
+			}
+
+			ranges = MergeTiles(cover)
+		}
+
+		rsp := &RangeCoverage{
+			Id:     id,
+			Zoom:   z,
+			Ranges: ranges,
+		}
+
+		err = cb(ctx, rsp)
+
+		if err != nil {
+			return fmt.Errorf("Callback function failed, %w", err)
+		}
+	}
+
+	return nil
+}
+
+// QuadtreeCoverageWithFeature returns a list of QuadtreeCoverage instances, one for each zoom level defined in 'opts', for a Who's On First record.
+func QuadtreeCoverageWithFeature(ctx context.Context, opts *CoverageOptions, body []byte) ([]*QuadtreeCoverage, error) {
+
+	results := make([]*QuadtreeCoverage, 0)
+
+	cb := func(ctx context.Context, rsp *QuadtreeCoverage) error {
+		results = append(results, rsp)
+		return nil
+	}
+
+	err := QuadtreeCoverageWithFeatureAndCallback(ctx, opts, body, cb)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// QuadtreeCoverageWithFeatureAndCallback will dispatch minimal, mixed-zoom quadtree coverage information for each
+// zoom level defined in 'opts' to a callback function defined in 'cb'. The individual tiles at each zoom level are
+// never held in memory. It is an error to use this method with a grid whose zoom levels are not quadtree subdivisions
+// of one another.
+func QuadtreeCoverageWithFeatureAndCallback(ctx context.Context, opts *CoverageOptions, body []byte, cb QuadtreeCoverageCallbackFunc) error {
+
+	id, geom, cover_geom, err := coverageGeometry(opts, body)
+
+	if err != nil {
+		return err
+	}
+
+	for _, z := range opts.ZoomLevels {
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// pass
+		}
+
+		mz := maptile.Zoom(uint32(z))
+
+		if !isQuadtree(opts.Grid, mz) {
+			return fmt.Errorf("Grid is not a quadtree at zoom level %d", z)
+		}
+
+		cover, err := quadtreeCover(opts.Grid, cover_geom, mz)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive coverage at zoom level %d, %w", z, err)
+		}
+
+		buffered, err := bufferCover(opts, geom, mz)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive buffered coverage at zoom level %d, %w", z, err)
+		}
+
+		if len(buffered) > 0 {
+			cover = mergeQuadtreeTiles(cover, buffered)
+		}
+
+		rsp := &QuadtreeCoverage{
+			Id:    id,
+			Zoom:  z,
+			Tiles: cover,
+		}
+
+		err = cb(ctx, rsp)
+
+		if err != nil {
+			return fmt.Errorf("Callback function failed, %w", err)
+		}
+	}
+
+	return nil
+}
+
+// quadtreeCover returns a minimal, mixed-zoom quadtree cover of 'geom' in 'g' at zoom level 'z'. Tiles entirely
+// covered by 'geom' are emitted as-is rather than being subdivided and any remaining sets of four sibling tiles are
+// then collapsed in to their parent.
+func quadtreeCover(g slippy.Grid, geom orb.Geometry, z maptile.Zoom) (maptile.Tiles, error) {
+
+	cover := make(maptile.Set)
+
+	walk_cb := func(t maptile.Tile, ext orb.Bound, clipped orb.Geometry, full bool) error {
+		cover[t] = true
+		return nil
+	}
+
+	err := walkGrid(g, geom, z, walk_cb)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return CollapseTiles(cover), nil
+}
+
+// mergeQuadtreeTiles returns a minimal, mixed-zoom quadtree cover for the union of 'cover', which is expected to be
+// a minimal quadtree cover, and 'set'. Tiles in 'set' that are already contained by a tile in 'cover' are ignored.
+func mergeQuadtreeTiles(cover maptile.Tiles, set maptile.Set) maptile.Tiles {
+
+	merged := make(maptile.Set)
+
+	for _, t := range cover {
+		merged[t] = true
+	}
+
+	for t, _ := range set {
+
+		contained := false
+
+		for p := t; ; p = p.Parent() {
+
+			if merged[p] {
+				contained = true
+				break
+			}
+
+			if p.Z == 0 {
+				break
+			}
+		}
+
+		if !contained {
+			merged[t] = true
+		}
+	}
+
+	return CollapseTiles(merged)
+}
+
+// tileRangeForTile returns the range of tiles at zoom level 'z' contained by 't'.
+func tileRangeForTile(t maptile.Tile, z maptile.Zoom) TileRange {
+
+	min, max := t.Range(z)
+
+	return TileRange{
+		Zoom: z,
+		MinX: min.X,
+		MinY: min.Y,
+		MaxX: max.X,
+		MaxY: max.Y,
+	}
+}
+
+// mergeRows merges the column intervals for each row, for each zoom level, in to a list of non-overlapping
+// rectangular tile ranges.
+func mergeRows(by_zoom map[maptile.Zoom]map[uint32][]interval) []TileRange {
+
+	zooms := make([]int, 0, len(by_zoom))
+
+	for z, _ := range by_zoom {
+		zooms = append(zooms, int(z))
+	}
+
+	sort.Ints(zooms)
+
+	ranges := make([]TileRange, 0)
+
+	for _, iz := range zooms {
+
+		z := maptile.Zoom(uint32(iz))
+		rows := by_zoom[z]
+
+		ys := make([]uint32, 0, len(rows))
+
+		for y, _ := range rows {
+			ys = append(ys, y)
+		}
+
+		sort.Slice(ys, func(i, j int) bool {
+			return ys[i] < ys[j]
+		})
+
+		// Ranges that ended on the previous row, keyed by their columns, which may be extended by the current row.
+		open := make(map[interval]int)
+
+		for _, y := range ys {
+
+			next := make(map[interval]int)
+
+			for _, iv := range mergeIntervals(rows[y]) {
+
+				idx, ok := open[iv]
+
+				if ok && ranges[idx].MaxY == y-1 {
+					ranges[idx].MaxY = y
+				} else {
+
+					ranges = append(ranges, TileRange{
+						Zoom: z,
+						MinX: iv.min,
+						MinY: y,
+						MaxX: iv.max,
+						MaxY: y,
+					})
+
+					idx = len(ranges) - 1
+				}
+
+				next[iv] = idx
+			}
+
+			open = next
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+
+		if ranges[i].Zoom != ranges[j].Zoom {
+			return ranges[i].Zoom < ranges[j].Zoom
+		}
+
+		if ranges[i].MinY != ranges[j].MinY {
+			return ranges[i].MinY < ranges[j].MinY
+		}
+
+		return ranges[i].MinX < ranges[j].MinX
+	})
+
+	return ranges
+}
+
+// mergeIntervals returns 'intervals' sorted with any overlapping or adjacent intervals merged.
+func mergeIntervals(intervals []interval) []interval {
+
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].min < intervals[j].min
+	})
+
+	merged := make([]interval, 0, len(intervals))
+
+	for _, iv := range intervals {
+
+		last := len(merged) - 1
+
+		if last >= 0 && uint64(iv.min) <= uint64(merged[last].max)+1 {
+
+			if iv.max > merged[last].max {
+				merged[last].max = iv.max
+			}
+
+			continue
+		}
+
+		merged = append(merged, iv)
+	}
+
+	return merged
+}
+
+// sortedTiles returns the tiles in 'set' ordered by zoom level, column and then row.
+func sortedTiles(set maptile.Set) maptile.Tiles {
+
+	tiles_list := make(maptile.Tiles, 0, len(set))
+
+	for t, _ := range set {
+		tiles_list = append(tiles_list, t)
+	}
+
+	sort.Slice(tiles_list, func(i, j int) bool {
+
+		a := tiles_list[i]
+		b := tiles_list[j]
+
+		if a.Z != b.Z {
+			return a.Z < b.Z
+		}
+
+		if a.X != b.X {
+			return a.X < b.X
+		}
+
+		return a.Y < b.Y
+	})
+
+	return tiles_list
+}
@@ -0,0 +1,116 @@
+package coverage
+
+import (
+	"context"
+	"github.com/paulmach/orb/maptile"
+	"testing"
+)
+
+// An L-shaped polygon whose western and southern edges, and some of its interior corners, fall on tile boundaries.
+const l_shaped_feature string = `{"type":"Feature","properties":{"wof:id":1},"geometry":{"type":"Polygon","coordinates":[[[0.0,0.0],[5.625,0.0],[5.625,2.0],[2.8125,2.0],[2.8125,5.0],[0.0,5.0],[0.0,0.0]]]}}`
+
+const line_feature string = `{"type":"Feature","properties":{"wof:id":2},"geometry":{"type":"LineString","coordinates":[[-122.41,37.77],[-122.27,37.80],[-122.22,37.91]]}}`
+
+func TestCompactCoverageMatchesCoverage(t *testing.T) {
+
+	tests := []struct {
+		Name    string
+		Feature string
+		Method  CoverageMethod
+		Buffer  float64
+	}{
+		{Name: "polygon geometry", Feature: l_shaped_feature, Method: GEOMETRY_COVERAGE},
+		{Name: "polygon bounds", Feature: l_shaped_feature, Method: BOUNDS_COVERAGE},
+		{Name: "buffered line", Feature: line_feature, Method: GEOMETRY_COVERAGE, Buffer: 16},
+	}
+
+	ctx := context.Background()
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			opts, err := DefaultCoverageOptions()
+
+			if err != nil {
+				t.Fatalf("Failed to create coverage options, %v", err)
+			}
+
+			opts.ZoomLevels = []uint{0, 8, 12, 14}
+			opts.Method = test.Method
+			opts.Buffer = test.Buffer
+
+			body := []byte(test.Feature)
+
+			expected, err := CoverageWithFeature(ctx, opts, body)
+
+			if err != nil {
+				t.Fatalf("Failed to derive coverage, %v", err)
+			}
+
+			ranges, err := RangeCoverageWithFeature(ctx, opts, body)
+
+			if err != nil {
+				t.Fatalf("Failed to derive range coverage, %v", err)
+			}
+
+			for _, c := range ranges {
+				compareTileSets(t, "range", c.Zoom, iterateTiles(t, c.Iterate), expected[c.Zoom])
+			}
+
+			quadtrees, err := QuadtreeCoverageWithFeature(ctx, opts, body)
+
+			if err != nil {
+				t.Fatalf("Failed to derive quadtree coverage, %v", err)
+			}
+
+			for _, c := range quadtrees {
+				compareTileSets(t, "quadtree", c.Zoom, iterateTiles(t, c.Iterate), expected[c.Zoom])
+			}
+		})
+	}
+}
+
+func iterateTiles(t *testing.T, iterate func(context.Context, TileCallbackFunc) error) maptile.Set {
+
+	set := make(maptile.Set)
+
+	cb := func(ctx context.Context, tile maptile.Tile) error {
+
+		if set[tile] {
+			t.Fatalf("Tile %d/%d/%d was iterated more than once", tile.Z, tile.X, tile.Y)
+		}
+
+		set[tile] = true
+		return nil
+	}
+
+	err := iterate(context.Background(), cb)
+
+	if err != nil {
+		t.Fatalf("Failed to iterate tiles, %v", err)
+	}
+
+	return set
+}
+
+func compareTileSets(t *testing.T, label string, z uint, got maptile.Set, expected maptile.Set) {
+
+	if len(expected) == 0 {
+		t.Fatalf("No %s coverage expected at zoom level %d", label, z)
+	}
+
+	for tile, _ := range expected {
+
+		if !got[tile] {
+			t.Fatalf("Expected tile %d/%d/%d in %s coverage at zoom level %d", tile.Z, tile.X, tile.Y, label, z)
+		}
+	}
+
+	for tile, _ := range got {
+
+		if !expected[tile] {
+			t.Fatalf("Unexpected tile %d/%d/%d in %s coverage at zoom level %d", tile.Z, tile.X, tile.Y, label, z)
+		}
+	}
+}
@@ -5,19 +5,46 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
 	"github.com/paulmach/orb/maptile"
-	"github.com/paulmach/orb/maptile/tilecover"
-	_ "log"
-	"sync"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
 )
 
+// CoverageMethod defines the technique used to determine which tiles cover a feature.
+type CoverageMethod string
+
+// GEOMETRY_COVERAGE signals that tile coverage should be derived from the actual geometry of a feature, including
+// any interior rings (holes) for polygons.
+const GEOMETRY_COVERAGE CoverageMethod = "geometry"
+
+// BOUNDS_COVERAGE signals that tile coverage should be derived from the bounding box of a feature. This is cheaper
+// to calculate than GEOMETRY_COVERAGE but will include tiles that do not intersect the feature's geometry.
+const BOUNDS_COVERAGE CoverageMethod = "bounds"
+
 // CoverageOptions defines common options for the CoverageWithFeature and CoverageWithFeatureAndChannels methods
 type CoverageOptions struct {
-	// A valid go-spatial/geom/slippy.Grid used to generate coverage information.
+	// A valid go-spatial/geom/slippy.Grid used to generate coverage information. Tiles in the resulting Coverage
+	// instances are addressed using this grid. If nil a web mercator (EPSG:3857) grid is assumed.
 	Grid slippy.Grid
 	// A list of zoom levels to determine coverage for.
 	ZoomLevels []uint
+	// The CoverageMethod used to determine which tiles cover a feature. If empty then GEOMETRY_COVERAGE is assumed.
+	Method CoverageMethod
+	// If true then each Coverage instance will also include the relationship of each tile to the feature's geometry
+	// and the fraction of each tile covered by it. This requires clipping the feature's geometry to each tile so it is
+	// disabled by default.
+	Relations bool
+	// An optional buffer used to also assign point and line features to the neighbouring tiles that their symbols
+	// (for example a marker or a stroke) overlap when rendered. Polygons are not buffered. If 0 then no buffer is used.
+	Buffer float64
+	// The BufferUnit that 'Buffer' is measured in. If empty then PIXEL_BUFFER is assumed.
+	BufferUnit BufferUnit
+	// The size, in pixels, of rendered tiles used to measure PIXEL_BUFFER buffers. If 0 then tiles.DEFAULT_TILE_SIZE is
+	// used.
+	TileSize uint
+	// The maximum number of zoom levels to derive coverage for concurrently. If 0 then runtime.NumCPU() is used.
+	Workers int
 }
 
 // Coverage is a struct containing information returned by the CoverageWithFeatureAndChannels.
@@ -28,15 +55,18 @@ type Coverage struct {
 	Zoom uint
 	// The set of tiles that cover feature 'Id' at zoom level 'Zoom'.
 	Tiles maptile.Set
+	// The relationship of each tile in 'Tiles' to the geometry of feature 'Id'. This is only populated if the
+	// CoverageOptions.Relations flag is true.
+	Relations map[maptile.Tile]*TileRelation
 }
 
 // CoverageCallbackFunc is a user-defined callback function invoked by CoverageWithFeatureAndCallback method.
 type CoverageCallbackFunc func(context.Context, *Coverage) error
 
-// DefaultCoverageOptions returns a CoverageOptions instance with a 4326 grid and zoom levels ranging from 1 to 20.
+// DefaultCoverageOptions returns a CoverageOptions instance with a 3857 grid, zoom levels ranging from 1 to 20 and the GEOMETRY_COVERAGE method.
 func DefaultCoverageOptions() (*CoverageOptions, error) {
 
-	grid, err := slippy.NewGrid(4326) // 3857)
+	grid, err := tiles.NewGrid(tiles.SRID_WEB_MERCATOR)
 
 	if err != nil {
 		return nil, err
@@ -51,6 +81,7 @@ func DefaultCoverageOptions() (*CoverageOptions, error) {
 	opts := &CoverageOptions{
 		Grid:       grid,
 		ZoomLevels: zoom_levels,
+		Method:     GEOMETRY_COVERAGE,
 	}
 
 	return opts, nil
@@ -59,118 +90,187 @@ func DefaultCoverageOptions() (*CoverageOptions, error) {
 // CoverageWithFeature returns a map of tiles for a Who's On Feature record. The map is keyed by zoom level and the value of each is a list of tiles that cover the feature.
 func CoverageWithFeature(ctx context.Context, opts *CoverageOptions, body []byte) (map[uint]maptile.Set, error) {
 
-	rsp_ch := make(chan *Coverage)
-	err_ch := make(chan error)
-	done_ch := make(chan bool)
+	it, err := NewCoverageIterator(ctx, opts, body)
 
-	go CoverageWithFeatureAndChannels(ctx, opts, body, rsp_ch, err_ch, done_ch)
+	if err != nil {
+		return nil, err
+	}
+
+	defer it.Close()
 
 	t := make(map[uint]maptile.Set)
 
-	for {
-		select {
-		case <-ctx.Done():
-			return t, nil
-		case <-done_ch:
-			return t, nil
-		case err := <-err_ch:
-			return nil, err
-		case rsp := <-rsp_ch:
-			t[rsp.Zoom] = rsp.Tiles
-		default:
-			// pass
-		}
+	for it.Next() {
+		rsp := it.Coverage()
+		t[rsp.Zoom] = rsp.Tiles
 	}
+
+	err = it.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
 }
 
 // CoverageWithFeatureAndCallback will dispatch coverage information for each zoom level defined in 'opts' to a callback function defined in 'cb'.
+// Coverage information is dispatched in the same order as the zoom levels defined in 'opts'.
 func CoverageWithFeatureAndCallback(ctx context.Context, opts *CoverageOptions, body []byte, cb CoverageCallbackFunc) error {
 
-	rsp_ch := make(chan *Coverage)
-	err_ch := make(chan error)
-	done_ch := make(chan bool)
+	it, err := NewCoverageIterator(ctx, opts, body)
 
-	go CoverageWithFeatureAndChannels(ctx, opts, body, rsp_ch, err_ch, done_ch)
+	if err != nil {
+		return err
+	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case <-done_ch:
-			return nil
-		case err := <-err_ch:
-			return err
-		case rsp := <-rsp_ch:
+	defer it.Close()
 
-			err := cb(ctx, rsp)
+	for it.Next() {
 
-			if err != nil {
-				return fmt.Errorf("Callback function failed, %w", err)
-			}
+		err := cb(ctx, it.Coverage())
 
-		default:
-			// pass
+		if err != nil {
+			return fmt.Errorf("Callback function failed, %w", err)
 		}
 	}
 
+	return it.Err()
 }
 
 // CoverageWithFeatureAndChannels returns coverage information for each zoom level defined in 'opts' as it is determined using channels.
+// Coverage information is sent to 'rsp_ch' in the same order as the zoom levels defined in 'opts'. Any error is sent to 'err_ch'
+// and 'done_ch' is always sent a value once all the coverage information has been sent.
 func CoverageWithFeatureAndChannels(ctx context.Context, opts *CoverageOptions, body []byte, rsp_ch chan *Coverage, err_ch chan error, done_ch chan bool) {
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
 	defer func() {
 		done_ch <- true
 	}()
 
-	f, err := geojson.UnmarshalFeature(body)
+	it, err := NewCoverageIterator(ctx, opts, body)
 
 	if err != nil {
-		err_ch <- fmt.Errorf("Failed to unmarshal feature, %v", err)
+		err_ch <- err
 		return
 	}
 
+	defer it.Close()
+
+	for it.Next() {
+		rsp_ch <- it.Coverage()
+	}
+
+	err = it.Err()
+
+	if err != nil {
+		err_ch <- err
+	}
+}
+
+// zoomCoverage returns the Coverage for the feature 'id', whose geometry is 'geom' and whose coverage is derived from
+// 'cover_geom', at zoom level 'z'.
+func zoomCoverage(opts *CoverageOptions, id int64, geom orb.Geometry, cover_geom orb.Geometry, z uint) (*Coverage, error) {
+
+	mz := maptile.Zoom(uint32(z))
+
+	cover, err := gridCover(opts.Grid, cover_geom, mz)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive coverage at zoom level %d, %w", z, err)
+	}
+
+	buffered, err := bufferCover(opts, geom, mz)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive buffered coverage at zoom level %d, %w", z, err)
+	}
+
+	buffer_only := make(maptile.Set)
+
+	for t, _ := range buffered {
+
+		if !cover[t] {
+			cover[t] = true
+			buffer_only[t] = true
+		}
+	}
+
+	rsp := &Coverage{
+		Id:    id,
+		Zoom:  z,
+		Tiles: cover,
+	}
+
+	if opts.Relations {
+
+		relations, err := tileRelations(opts.Grid, geom, cover, mz)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to derive tile relations at zoom level %d, %w", z, err)
+		}
+
+		for t, _ := range buffer_only {
+			relations[t] = &TileRelation{Relationship: BUFFER_RELATIONSHIP}
+		}
+
+		rsp.Relations = relations
+	}
+
+	return rsp, nil
+}
+
+// coverageGeometry returns the wof:id of the feature defined by 'body', its geometry and the geometry used to derive
+// its coverage given the CoverageMethod defined in 'opts'.
+func coverageGeometry(opts *CoverageOptions, body []byte) (int64, orb.Geometry, orb.Geometry, error) {
+
+	f, err := geojson.UnmarshalFeature(body)
+
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("Failed to unmarshal feature, %v", err)
+	}
+
 	props := f.Properties
 	id_raw, exists := props["wof:id"]
 
 	if !exists {
-		err_ch <- fmt.Errorf("Missing wof:id property")
-		return
+		return 0, nil, nil, fmt.Errorf("Missing wof:id property")
 	}
 
 	id := int64(id_raw.(float64))
 
-	bounds := f.Geometry.Bound()
-
-	wg := new(sync.WaitGroup)
+	if f.Geometry == nil {
+		return 0, nil, nil, fmt.Errorf("Feature is missing geometry")
+	}
 
-	for _, z := range opts.ZoomLevels {
+	// Geometries that cross the antimeridian are split so that they don't cover (almost) the entire world.
 
-		wg.Add(1)
+	geom := tiles.SplitAntimeridian(closeRings(f.Geometry))
 
-		go func(z uint) {
+	var cover_geom orb.Geometry
 
-			defer wg.Done()
+	switch opts.Method {
+	case BOUNDS_COVERAGE:
 
-			// I have no idea why this returns what it does
-			// t := slippy.FromBounds(opts.Grid, extent, z)
+		bounds := tiles.AntimeridianBounds(geom)
 
-			uz := uint32(z)
-			mz := maptile.Zoom(uz)
+		if len(bounds) == 1 {
+			cover_geom = bounds[0]
+		} else {
 
-			tiles := tilecover.Geometry(bounds, mz)
+			mp := make(orb.MultiPolygon, len(bounds))
 
-			rsp := &Coverage{
-				Id:    id,
-				Zoom:  z,
-				Tiles: tiles,
+			for i, b := range bounds {
+				mp[i] = b.ToPolygon()
 			}
 
-			rsp_ch <- rsp
-		}(z)
+			cover_geom = mp
+		}
+
+	case GEOMETRY_COVERAGE, "":
+		cover_geom = geom
+	default:
+		return 0, nil, nil, fmt.Errorf("Invalid coverage method '%s'", opts.Method)
 	}
 
-	wg.Wait()
+	return id, geom, cover_geom, nil
 }
@@ -0,0 +1,69 @@
+package coverage
+
+import (
+	"github.com/paulmach/orb"
+)
+
+// closeRings returns a copy of 'geom' where all the rings in any polygons have been explicitly closed. Rings in
+// Who's On First records should always be closed but in practice they are not always.
+func closeRings(geom orb.Geometry) orb.Geometry {
+
+	switch g := geom.(type) {
+	case orb.Ring:
+		return closeRing(g)
+	case orb.Polygon:
+		return closePolygon(g)
+	case orb.MultiPolygon:
+
+		mp := make(orb.MultiPolygon, len(g))
+
+		for i, p := range g {
+			mp[i] = closePolygon(p)
+		}
+
+		return mp
+
+	case orb.Collection:
+
+		c := make(orb.Collection, len(g))
+
+		for i, cg := range g {
+			c[i] = closeRings(cg)
+		}
+
+		return c
+
+	default:
+		return geom
+	}
+}
+
+func closePolygon(p orb.Polygon) orb.Polygon {
+
+	closed := make(orb.Polygon, 0, len(p))
+
+	for _, r := range p {
+
+		// Skip degenerate rings that have no area
+
+		if len(r) < 3 {
+			continue
+		}
+
+		closed = append(closed, closeRing(r))
+	}
+
+	return closed
+}
+
+func closeRing(r orb.Ring) orb.Ring {
+
+	if len(r) == 0 || r.Closed() {
+		return r
+	}
+
+	closed := make(orb.Ring, len(r), len(r)+1)
+	copy(closed, r)
+
+	return append(closed, r[0])
+}
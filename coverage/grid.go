@@ -0,0 +1,398 @@
+package coverage
+
+import (
+	"fmt"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/project"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+	"math"
+)
+
+// gridCover returns the set of tiles in 'g' at zoom level 'z' that intersect 'geom'. This works for any grid
+// (supported by the tiles.ToNativeProjection method) by projecting 'geom' in to the grid's native coordinates and
+// then recursively subdividing the tiles at zoom level 0 until zoom level 'z' is reached. Only the tiles whose extent
+// intersects the geometry are subdivided, and the geometry is clipped to each tile along the way so the amount of
+// work decreases at each zoom level. Tiles that are entirely covered by a polygon have all their descendants added
+// without any further tests. The tiles at the next zoom level are derived from the grid itself so tile matrices do not
+// need to be quadtree subdivisions of one another. This is used for every grid, including web mercator, so that the
+// tiles it returns are the same as those visited by walkGrid for compact coverage and tile relations.
+func gridCover(g slippy.Grid, geom orb.Geometry, z maptile.Zoom) (maptile.Set, error) {
+
+	cover := make(maptile.Set)
+
+	walk_cb := func(t maptile.Tile, ext orb.Bound, clipped orb.Geometry, full bool) error {
+
+		if !full {
+			cover[t] = true
+			return nil
+		}
+
+		min, max, ok := descendantRange(g, t, ext, z)
+
+		if !ok {
+			return nil
+		}
+
+		for x := min.X; x <= max.X; x++ {
+			for y := min.Y; y <= max.Y; y++ {
+				cover[maptile.New(x, y, z)] = true
+			}
+		}
+
+		return nil
+	}
+
+	err := walkGrid(g, geom, z, walk_cb)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cover, nil
+}
+
+// walkGridFunc is a function invoked by walkGrid for each tile 't', whose extent in the native coordinates of the
+// grid is 'ext', that intersects a geometry. 'clipped' is the geometry, in native coordinates, clipped to 'ext'. If
+// 'full' is true then 't' is entirely covered by the geometry and all its descendants, at the zoom level being
+// walked, are implied.
+type walkGridFunc func(t maptile.Tile, ext orb.Bound, clipped orb.Geometry, full bool) error
+
+// walkGrid projects 'geom' in to the native coordinates of 'g' and recursively subdivides the tiles at zoom level 0
+// until zoom level 'z' is reached, invoking 'cb' for every tile at zoom level 'z' that intersects 'geom' and for
+// every tile at a lower zoom level that is entirely covered by 'geom'. Tiles that are entirely covered are not
+// subdivided any further.
+func walkGrid(g slippy.Grid, geom orb.Geometry, z maptile.Zoom, cb walkGridFunc) error {
+
+	proj, err := tiles.ToNativeProjection(g)
+
+	if err != nil {
+		return err
+	}
+
+	// Bounds with no width or height (for example the bounds of a point) would be treated as empty polygons
+	// so they are converted to an equivalent point or line.
+
+	if b, ok := geom.(orb.Bound); ok {
+
+		switch {
+		case b.Min.Equal(b.Max):
+			geom = b.Min
+		case b.Min.X() == b.Max.X() || b.Min.Y() == b.Max.Y():
+			geom = orb.LineString{b.Min, b.Max}
+		default:
+			geom = b.ToPolygon()
+		}
+	}
+
+	native_geom := project.Geometry(orb.Clone(geom), proj)
+
+	cols, rows, err := tiles.GridSize(g, 0)
+
+	if err != nil {
+		return err
+	}
+
+	var walk func(maptile.Tile, orb.Geometry) error
+
+	walk = func(t maptile.Tile, geom orb.Geometry) error {
+
+		ext, err := tiles.TileExtent(g, t)
+
+		if err != nil {
+			return err
+		}
+
+		clipped := clip.Geometry(ext, orb.Clone(geom))
+
+		if isEmpty(clipped) {
+			return nil
+		}
+
+		if t.Z == z {
+			return cb(t, ext, clipped, false)
+		}
+
+		if isPolygonal(clipped) && geometryArea(clipped) >= boundArea(ext)*(1.0-1e-9) {
+			return cb(t, ext, clipped, true)
+		}
+
+		min, max, ok := descendantRange(g, t, ext, t.Z+1)
+
+		if !ok {
+			return nil
+		}
+
+		for x := min.X; x <= max.X; x++ {
+			for y := min.Y; y <= max.Y; y++ {
+
+				err := walk(maptile.New(x, y, t.Z+1), clipped)
+
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	for x := uint32(0); x < cols; x++ {
+		for y := uint32(0); y < rows; y++ {
+
+			err := walk(maptile.New(x, y, 0), native_geom)
+
+			if err != nil {
+				return fmt.Errorf("Failed to derive tile cover, %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// descendantRange returns the first and last (inclusive) tiles at zoom level 'z' contained by tile 't', whose extent
+// in the native coordinates of 'g' is 'ext', and a boolean flag indicating whether there are any. For grids that are
+// quadtree subdivisions of themselves the range is derived arithmetically, otherwise it is derived from the grid.
+func descendantRange(g slippy.Grid, t maptile.Tile, ext orb.Bound, z maptile.Zoom) (maptile.Tile, maptile.Tile, bool) {
+
+	if isQuadtree(g, z) {
+		min, max := t.Range(z)
+		return min, max, true
+	}
+
+	return tileRange(g, ext, z)
+}
+
+// isQuadtree returns true if every zoom level of 'g', up to and including 'z', is a quadtree subdivision of the zoom
+// level before it. Grids that are not tile matrix sets and which define their own projection are assumed not to be.
+func isQuadtree(g slippy.Grid, z maptile.Zoom) bool {
+
+	tms, ok := g.(*tiles.TileMatrixSet)
+
+	if !ok {
+		_, projected := g.(tiles.ProjectedGrid)
+		return !projected
+	}
+
+	if int(z) >= len(tms.Matrices) {
+		return false
+	}
+
+	for i := 1; i <= int(z); i++ {
+
+		prev := tms.Matrices[i-1]
+		m := tms.Matrices[i]
+
+		switch {
+		case m.MatrixWidth != prev.MatrixWidth*2, m.MatrixHeight != prev.MatrixHeight*2:
+			return false
+		case m.TileWidth != prev.TileWidth, m.TileHeight != prev.TileHeight:
+			return false
+		case m.BottomLeft != prev.BottomLeft, !m.Origin.Equal(prev.Origin):
+			return false
+		case math.Abs(m.CellSize*2-prev.CellSize) > prev.CellSize*1e-9:
+			return false
+		}
+	}
+
+	return true
+}
+
+// tileRange returns the first and last (inclusive) tiles in 'g' at zoom level 'z' that intersect 'ext', which is
+// expected to be in the native coordinates of 'g', and a boolean flag indicating whether there are any.
+func tileRange(g slippy.Grid, ext orb.Bound, z maptile.Zoom) (maptile.Tile, maptile.Tile, bool) {
+
+	var min maptile.Tile
+	var max maptile.Tile
+
+	size, ok := g.Size(uint(z))
+
+	if !ok || size.X == 0 || size.Y == 0 {
+		return min, max, false
+	}
+
+	tl, ok := g.ToNative(slippy.NewTile(uint(z), 0, 0))
+
+	if !ok {
+		return min, max, false
+	}
+
+	br, ok := g.ToNative(slippy.NewTile(uint(z), size.X, size.Y))
+
+	if !ok {
+		return min, max, false
+	}
+
+	grid_b := orb.Bound{Min: orb.Point{tl.X(), tl.Y()}, Max: orb.Point{tl.X(), tl.Y()}}
+	grid_b = grid_b.Extend(orb.Point{br.X(), br.Y()})
+
+	if !grid_b.Intersects(ext) {
+		return min, max, false
+	}
+
+	// Clamp 'ext' to the grid and then shrink it by a tiny fraction of a tile so that tiles which only
+	// share an edge with 'ext' are not included.
+
+	dx := (grid_b.Max.X() - grid_b.Min.X()) / float64(size.X) * 1e-6
+	dy := (grid_b.Max.Y() - grid_b.Min.Y()) / float64(size.Y) * 1e-6
+
+	min_x := math.Max(ext.Min.X(), grid_b.Min.X()) + dx
+	min_y := math.Max(ext.Min.Y(), grid_b.Min.Y()) + dy
+	max_x := math.Min(ext.Max.X(), grid_b.Max.X()) - dx
+	max_y := math.Min(ext.Max.Y(), grid_b.Max.Y()) - dy
+
+	if min_x > max_x {
+		min_x = (min_x + max_x) / 2.0
+		max_x = min_x
+	}
+
+	if min_y > max_y {
+		min_y = (min_y + max_y) / 2.0
+		max_y = min_y
+	}
+
+	t1, ok := g.FromNative(uint(z), geom.Point{min_x, min_y})
+
+	if !ok {
+		return min, max, false
+	}
+
+	t2, ok := g.FromNative(uint(z), geom.Point{max_x, max_y})
+
+	if !ok {
+		return min, max, false
+	}
+
+	min = maptile.New(uint32(minUint(t1.X, t2.X)), uint32(minUint(t1.Y, t2.Y)), z)
+	max = maptile.New(uint32(maxUint(t1.X, t2.X)), uint32(maxUint(t1.Y, t2.Y)), z)
+
+	return min, max, true
+}
+
+func minUint(a uint, b uint) uint {
+
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxUint(a uint, b uint) uint {
+
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+// isEmpty returns true if 'geom' is nil or has no extent. Polygons (and lines) that only touch the edge of a tile
+// when clipped are considered to be empty.
+func isEmpty(geom orb.Geometry) bool {
+
+	if geom == nil {
+		return true
+	}
+
+	switch g := geom.(type) {
+	case orb.Point:
+		return false
+	case orb.MultiPoint:
+		return len(g) == 0
+	case orb.LineString, orb.MultiLineString:
+		b := g.Bound()
+		return b.Max.X()-b.Min.X() == 0 && b.Max.Y()-b.Min.Y() == 0
+	case orb.Collection:
+
+		for _, cg := range g {
+
+			if !isEmpty(cg) {
+				return false
+			}
+		}
+
+		return true
+
+	default:
+		return geometryArea(g) == 0
+	}
+}
+
+func isPolygonal(geom orb.Geometry) bool {
+
+	switch geom.(type) {
+	case orb.Ring, orb.Polygon, orb.MultiPolygon, orb.Bound:
+		return true
+	default:
+		return false
+	}
+}
+
+// geometryArea returns the planar area of 'geom' in its own units, accounting for interior rings.
+func geometryArea(geom orb.Geometry) float64 {
+
+	switch g := geom.(type) {
+	case orb.Ring:
+		return math.Abs(ringArea(g))
+	case orb.Polygon:
+
+		area := 0.0
+
+		for i, r := range g {
+
+			if i == 0 {
+				area += math.Abs(ringArea(r))
+			} else {
+				area -= math.Abs(ringArea(r))
+			}
+		}
+
+		return area
+
+	case orb.MultiPolygon:
+
+		area := 0.0
+
+		for _, p := range g {
+			area += geometryArea(p)
+		}
+
+		return area
+
+	case orb.Collection:
+
+		area := 0.0
+
+		for _, cg := range g {
+			area += geometryArea(cg)
+		}
+
+		return area
+
+	case orb.Bound:
+		return boundArea(g)
+	default:
+		return 0.0
+	}
+}
+
+func boundArea(b orb.Bound) float64 {
+	return (b.Max.X() - b.Min.X()) * (b.Max.Y() - b.Min.Y())
+}
+
+func ringArea(r orb.Ring) float64 {
+
+	area := 0.0
+
+	for i := range r {
+		j := (i + 1) % len(r)
+		area += r[i][0]*r[j][1] - r[j][0]*r[i][1]
+	}
+
+	return area / 2.0
+}
@@ -0,0 +1,198 @@
+package coverage
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// zoomResult is the outcome of deriving the coverage for a single zoom level.
+type zoomResult struct {
+	coverage *Coverage
+	err      error
+}
+
+// CoverageIterator is a pull-style iterator for the coverage information of a Who's On First record at each of the
+// zoom levels defined in a CoverageOptions instance. Coverage is derived for several zoom levels concurrently, using
+// at most CoverageOptions.Workers goroutines, but is always returned in the same order as the zoom levels. For example:
+//
+//	it, _ := coverage.NewCoverageIterator(ctx, opts, body)
+//	defer it.Close()
+//
+//	for it.Next() {
+//		rsp := it.Coverage()
+//		...
+//	}
+//
+//	err := it.Err()
+type CoverageIterator struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	results  []chan *zoomResult
+	idx      int
+	current  *Coverage
+	err      error
+	closed   bool
+	close_mu *sync.Mutex
+}
+
+// NewCoverageIterator returns a new CoverageIterator instance for the Who's On First record defined by 'body'. An
+// error is returned if the record can not be parsed. Errors deriving coverage for individual zoom levels are reported
+// by the iterator's Err method. Cancelling 'ctx' stops the iterator.
+func NewCoverageIterator(ctx context.Context, opts *CoverageOptions, body []byte) (*CoverageIterator, error) {
+
+	id, geom, cover_geom, err := coverageGeometry(opts, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	count := len(opts.ZoomLevels)
+
+	// Each zoom level gets its own buffered channel so that workers never block on a slow consumer and
+	// results can be read back in order.
+
+	results := make([]chan *zoomResult, count)
+
+	for i := 0; i < count; i++ {
+		results[i] = make(chan *zoomResult, 1)
+	}
+
+	workers := opts.Workers
+
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	if workers > count {
+		workers = count
+	}
+
+	// Zoom levels are handed to workers in order so that the zoom level the iterator is waiting on is
+	// always (one of) the first to be processed.
+
+	idx_ch := make(chan int)
+
+	go func() {
+
+		defer close(idx_ch)
+
+		for i := 0; i < count; i++ {
+
+			select {
+			case <-ctx.Done():
+				return
+			case idx_ch <- i:
+				// pass
+			}
+		}
+	}()
+
+	for w := 0; w < workers; w++ {
+
+		go func() {
+
+			for i := range idx_ch {
+
+				if ctx.Err() != nil {
+					results[i] <- &zoomResult{err: ctx.Err()}
+					continue
+				}
+
+				rsp, err := zoomCoverage(opts, id, geom, cover_geom, opts.ZoomLevels[i])
+				results[i] <- &zoomResult{coverage: rsp, err: err}
+			}
+		}()
+	}
+
+	it := &CoverageIterator{
+		ctx:      ctx,
+		cancel:   cancel,
+		results:  results,
+		close_mu: new(sync.Mutex),
+	}
+
+	return it, nil
+}
+
+// Next advances the iterator to the coverage information for the next zoom level, which is then available using the
+// Coverage method. It returns false when there are no more zoom levels, when an error occurs, when the iterator's
+// context is cancelled or when the iterator has been closed.
+func (it *CoverageIterator) Next() bool {
+
+	it.current = nil
+
+	if it.err != nil || it.isClosed() {
+		return false
+	}
+
+	if it.idx >= len(it.results) {
+		it.cancel()
+		return false
+	}
+
+	// Results for later zoom levels may already be waiting so the context is checked first, otherwise the
+	// select statement below might pick one of them at random after the context has been cancelled.
+
+	if it.ctx.Err() != nil {
+		it.err = it.ctx.Err()
+		return false
+	}
+
+	select {
+	case <-it.ctx.Done():
+
+		if !it.isClosed() {
+			it.err = it.ctx.Err()
+		}
+
+		return false
+
+	case r := <-it.results[it.idx]:
+
+		it.idx += 1
+
+		if r.err != nil {
+			it.err = r.err
+			it.cancel()
+			return false
+		}
+
+		it.current = r.coverage
+		return true
+	}
+}
+
+// Coverage returns the coverage information for the current zoom level.
+func (it *CoverageIterator) Coverage() *Coverage {
+	return it.current
+}
+
+// Err returns the first error encountered by the iterator, if any. If the iterator's context was cancelled before all
+// the zoom levels were processed then the context's error is returned.
+func (it *CoverageIterator) Err() error {
+	return it.err
+}
+
+// Close stops the iterator and releases its resources. Any zoom levels still being processed are discarded. It is
+// safe to call Close more than once.
+func (it *CoverageIterator) Close() error {
+
+	it.close_mu.Lock()
+	defer it.close_mu.Unlock()
+
+	it.closed = true
+	it.cancel()
+
+	return nil
+}
+
+func (it *CoverageIterator) isClosed() bool {
+
+	it.close_mu.Lock()
+	defer it.close_mu.Unlock()
+
+	return it.closed
+}
@@ -0,0 +1,153 @@
+package coverage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// pointFeature returns a Who's On First record, with ID 'id', for a point at 'lon', 'lat'.
+func pointFeature(id int64, lon float64, lat float64) []byte {
+	return []byte(fmt.Sprintf(`{"type":"Feature","properties":{"wof:id":%d},"geometry":{"type":"Point","coordinates":[%f,%f]}}`, id, lon, lat))
+}
+
+func TestCoverageIteratorZoomOrder(t *testing.T) {
+
+	opts, err := DefaultCoverageOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to create coverage options, %v", err)
+	}
+
+	opts.ZoomLevels = []uint{14, 2, 10, 0, 16, 6, 12, 1}
+	opts.Workers = 4
+
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+
+		it, err := NewCoverageIterator(ctx, opts, []byte(line_feature))
+
+		if err != nil {
+			t.Fatalf("Failed to create iterator, %v", err)
+		}
+
+		zooms := make([]uint, 0)
+
+		for it.Next() {
+
+			c := it.Coverage()
+
+			if len(c.Tiles) == 0 {
+				t.Fatalf("Expected tiles at zoom level %d", c.Zoom)
+			}
+
+			zooms = append(zooms, c.Zoom)
+		}
+
+		err = it.Err()
+
+		if err != nil {
+			t.Fatalf("Iterator failed, %v", err)
+		}
+
+		it.Close()
+
+		if fmt.Sprintf("%v", zooms) != fmt.Sprintf("%v", opts.ZoomLevels) {
+			t.Fatalf("Expected zoom levels %v, got %v", opts.ZoomLevels, zooms)
+		}
+	}
+}
+
+func TestCoverageIteratorCancel(t *testing.T) {
+
+	opts, err := DefaultCoverageOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to create coverage options, %v", err)
+	}
+
+	opts.ZoomLevels = []uint{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	opts.Workers = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	it, err := NewCoverageIterator(ctx, opts, []byte(l_shaped_feature))
+
+	if err != nil {
+		t.Fatalf("Failed to create iterator, %v", err)
+	}
+
+	defer it.Close()
+
+	if !it.Next() {
+		t.Fatalf("Expected coverage for the first zoom level, %v", it.Err())
+	}
+
+	cancel()
+
+	count := 1
+
+	for it.Next() {
+		count += 1
+	}
+
+	if count == len(opts.ZoomLevels) {
+		t.Fatalf("Expected iterator to stop before the last zoom level")
+	}
+
+	if !errors.Is(it.Err(), context.Canceled) {
+		t.Fatalf("Expected context.Canceled error, got %v", it.Err())
+	}
+}
+
+func TestCoverageIteratorClose(t *testing.T) {
+
+	opts, err := DefaultCoverageOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to create coverage options, %v", err)
+	}
+
+	opts.ZoomLevels = []uint{1, 2, 3, 4}
+
+	it, err := NewCoverageIterator(context.Background(), opts, pointFeature(1, -122.4, 37.8))
+
+	if err != nil {
+		t.Fatalf("Failed to create iterator, %v", err)
+	}
+
+	if !it.Next() {
+		t.Fatalf("Expected coverage for the first zoom level, %v", it.Err())
+	}
+
+	it.Close()
+	it.Close()
+
+	if it.Next() {
+		t.Fatalf("Expected closed iterator to stop")
+	}
+
+	if it.Err() != nil {
+		t.Fatalf("Expected no error after closing iterator, got %v", it.Err())
+	}
+}
+
+func TestCoverageIteratorError(t *testing.T) {
+
+	opts, err := DefaultCoverageOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to create coverage options, %v", err)
+	}
+
+	opts.ZoomLevels = []uint{1, 2, 3, 4}
+	opts.Method = CoverageMethod("invalid")
+
+	_, err = NewCoverageIterator(context.Background(), opts, pointFeature(1, -122.4, 37.8))
+
+	if err == nil {
+		t.Fatalf("Expected invalid coverage method to fail")
+	}
+}
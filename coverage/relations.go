@@ -0,0 +1,115 @@
+package coverage
+
+import (
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"math"
+)
+
+// Relationship defines the relationship between a tile and the geometry of a feature.
+type Relationship string
+
+// INSIDE_RELATIONSHIP signals that a tile is entirely covered by the (polygonal) geometry of a feature. Tiles with
+// this relationship can be treated as "solid" and do not need to be cropped.
+const INSIDE_RELATIONSHIP Relationship = "inside"
+
+// PARTIAL_RELATIONSHIP signals that a tile intersects, but is not entirely covered by, the geometry of a feature.
+const PARTIAL_RELATIONSHIP Relationship = "partial"
+
+// BOUNDS_RELATIONSHIP signals that a tile only intersects the bounding box of a feature and not its geometry. This
+// only happens when coverage is derived using the BOUNDS_COVERAGE method. Tiles that only share an edge with the
+// geometry of a feature are not included in its coverage so they are never assigned this relationship.
+const BOUNDS_RELATIONSHIP Relationship = "bounds"
+
+// BUFFER_RELATIONSHIP signals that a tile does not intersect the geometry of a feature but was assigned to it because
+// the feature's (point or line) geometry is within the buffer defined by CoverageOptions.Buffer of the tile.
+const BUFFER_RELATIONSHIP Relationship = "buffer"
+
+// TileRelation describes the relationship between a single tile and the geometry of a feature.
+type TileRelation struct {
+	// The relationship between the tile and the geometry of a feature.
+	Relationship Relationship `json:"relationship"`
+	// The fraction (0.0 to 1.0) of the tile's area, measured in the native coordinates of the grid, that is covered
+	// by the geometry of a feature. This is always 0.0 for points and lines.
+	Fraction float64 `json:"fraction"`
+}
+
+// tileRelations returns the relationship between each tile in 'cover', at zoom level 'z' in 'g', and 'geom'. Tiles
+// in 'cover' that do not intersect 'geom' are assigned the BOUNDS_RELATIONSHIP relationship.
+func tileRelations(g slippy.Grid, geom orb.Geometry, cover maptile.Set, z maptile.Zoom) (map[maptile.Tile]*TileRelation, error) {
+
+	relations := make(map[maptile.Tile]*TileRelation)
+
+	inside := &TileRelation{
+		Relationship: INSIDE_RELATIONSHIP,
+		Fraction:     1.0,
+	}
+
+	walk_cb := func(t maptile.Tile, ext orb.Bound, clipped orb.Geometry, full bool) error {
+
+		if full {
+
+			min, max, ok := descendantRange(g, t, ext, z)
+
+			if !ok {
+				return nil
+			}
+
+			for x := min.X; x <= max.X; x++ {
+				for y := min.Y; y <= max.Y; y++ {
+
+					d := maptile.New(x, y, z)
+
+					if cover[d] {
+						relations[d] = inside
+					}
+				}
+			}
+
+			return nil
+		}
+
+		if !cover[t] {
+			return nil
+		}
+
+		rel := &TileRelation{
+			Relationship: PARTIAL_RELATIONSHIP,
+		}
+
+		if isPolygonal(clipped) {
+
+			fraction := math.Min(geometryArea(clipped)/boundArea(ext), 1.0)
+
+			if fraction >= 1.0-1e-9 {
+				relations[t] = inside
+				return nil
+			}
+
+			rel.Fraction = fraction
+		}
+
+		relations[t] = rel
+		return nil
+	}
+
+	err := walkGrid(g, geom, z, walk_cb)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for t, _ := range cover {
+
+		_, ok := relations[t]
+
+		if !ok {
+			relations[t] = &TileRelation{
+				Relationship: BOUNDS_RELATIONSHIP,
+			}
+		}
+	}
+
+	return relations, nil
+}
@@ -0,0 +1,107 @@
+package coverage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCoverageRelationsOnTileBoundary(t *testing.T) {
+
+	// A rectangle and a triangle whose western and southern edges fall on the prime meridian and equator, which are
+	// tile boundaries at every zoom level, and whose eastern extent falls on a tile boundary at zoom level 6 and above.
+
+	rectangle := `{"type":"Feature","properties":{"wof:id":1},"geometry":{"type":"Polygon","coordinates":[[[0.0,0.0],[5.625,0.0],[5.625,3.0],[0.0,3.0],[0.0,0.0]]]}}`
+	triangle := `{"type":"Feature","properties":{"wof:id":2},"geometry":{"type":"Polygon","coordinates":[[[0.0,0.0],[5.625,0.0],[0.0,3.0],[0.0,0.0]]]}}`
+
+	tests := []struct {
+		Name    string
+		Feature string
+		Method  CoverageMethod
+		Bounds  bool
+	}{
+		{Name: "rectangle geometry", Feature: rectangle, Method: GEOMETRY_COVERAGE},
+		{Name: "rectangle bounds", Feature: rectangle, Method: BOUNDS_COVERAGE},
+		{Name: "triangle geometry", Feature: triangle, Method: GEOMETRY_COVERAGE},
+		{Name: "triangle bounds", Feature: triangle, Method: BOUNDS_COVERAGE, Bounds: true},
+	}
+
+	ctx := context.Background()
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			opts, err := DefaultCoverageOptions()
+
+			if err != nil {
+				t.Fatalf("Failed to create coverage options, %v", err)
+			}
+
+			opts.ZoomLevels = []uint{1, 6, 10}
+			opts.Method = test.Method
+			opts.Relations = true
+
+			bounds_count := 0
+
+			cb := func(ctx context.Context, c *Coverage) error {
+
+				n := uint32(1) << c.Zoom
+				mid := n / 2
+
+				for tile, _ := range c.Tiles {
+
+					if tile.X < mid || tile.Y >= mid {
+						t.Fatalf("Tile %d/%d/%d only touches the edge of the feature", tile.Z, tile.X, tile.Y)
+					}
+
+					if c.Zoom >= 6 && tile.X >= mid+n/64 {
+						t.Fatalf("Tile %d/%d/%d only touches the edge of the feature", tile.Z, tile.X, tile.Y)
+					}
+
+					rel, ok := c.Relations[tile]
+
+					if !ok {
+						t.Fatalf("Missing relation for tile %d/%d/%d", tile.Z, tile.X, tile.Y)
+					}
+
+					switch rel.Relationship {
+					case INSIDE_RELATIONSHIP:
+
+						if rel.Fraction != 1.0 {
+							t.Fatalf("Unexpected fraction %f for inside tile %d/%d/%d", rel.Fraction, tile.Z, tile.X, tile.Y)
+						}
+
+					case PARTIAL_RELATIONSHIP:
+
+						if rel.Fraction <= 0.0 || rel.Fraction >= 1.0 {
+							t.Fatalf("Unexpected fraction %f for partial tile %d/%d/%d", rel.Fraction, tile.Z, tile.X, tile.Y)
+						}
+
+					case BOUNDS_RELATIONSHIP:
+
+						if !test.Bounds {
+							t.Fatalf("Unexpected bounds relationship for tile %d/%d/%d", tile.Z, tile.X, tile.Y)
+						}
+
+						bounds_count += 1
+
+					default:
+						t.Fatalf("Unexpected relationship '%s' for tile %d/%d/%d", rel.Relationship, tile.Z, tile.X, tile.Y)
+					}
+				}
+
+				return nil
+			}
+
+			err = CoverageWithFeatureAndCallback(ctx, opts, []byte(test.Feature), cb)
+
+			if err != nil {
+				t.Fatalf("Failed to derive coverage, %v", err)
+			}
+
+			if test.Bounds && bounds_count == 0 {
+				t.Fatalf("Expected tiles with a bounds relationship")
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package crop
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+)
+
+// CropOptions defines configuration options for cropping features to a tile.
+type CropOptions struct {
+	// The grid that tiles belong to. If nil a web mercator (EPSG:3857) grid is assumed.
+	Grid slippy.Grid
+	// The number of pixels, relative to TileSize, that the bounds of a tile are expanded by on each side before
+	// features are cropped. This allows renderers to draw strokes across the edges of a tile without gaps or seams.
+	Buffer float64
+	// The size, in pixels, of a rendered tile. If 0 then tiles.DEFAULT_TILE_SIZE is used.
+	TileSize float64
+}
+
+// CropFeatureWithTileAndOptions will crop the geometry of a GeoJSON Feature defined by 'body' to the extent of
+// 'tile' expanded by the buffer defined in 'opts'.
+func CropFeatureWithTileAndOptions(ctx context.Context, body []byte, tile maptile.Tile, opts *CropOptions) ([]byte, error) {
+
+	bounds, err := TileBoundWithOptions(tile, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return CropFeatureWithBounds(ctx, body, bounds)
+}
+
+// CropGeoJSONFeatureWithTileAndOptions will return a copy of 'f' whose geometry has been cropped to the extent of
+// 'tile' expanded by the buffer defined in 'opts'.
+func CropGeoJSONFeatureWithTileAndOptions(ctx context.Context, f *geojson.Feature, tile maptile.Tile, opts *CropOptions) (*geojson.Feature, error) {
+
+	bounds, err := TileBoundWithOptions(tile, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return CropGeoJSONFeatureWithBounds(ctx, f, bounds)
+}
+
+// TileBoundWithOptions returns the geographic (EPSG:4326) bounds of 'tile', in the grid defined by 'opts', expanded
+// on each side by opts.Buffer pixels. The buffer is applied in the native coordinates of the grid so that it is the
+// same size, once rendered, on every side of the tile. If opts.Buffer is 0 this is the same as calling tiles.TileBound.
+func TileBoundWithOptions(tile maptile.Tile, opts *CropOptions) (orb.Bound, error) {
+
+	if opts.Buffer < 0 {
+		return orb.Bound{}, fmt.Errorf("Invalid buffer")
+	}
+
+	if opts.Buffer == 0 {
+		return tiles.TileBound(opts.Grid, tile)
+	}
+
+	tile_size := opts.TileSize
+
+	if tile_size == 0 {
+		tile_size = float64(tiles.DEFAULT_TILE_SIZE)
+	}
+
+	if tile_size < 0 {
+		return orb.Bound{}, fmt.Errorf("Invalid tile size")
+	}
+
+	ext, err := tiles.TileExtent(opts.Grid, tile)
+
+	if err != nil {
+		return orb.Bound{}, err
+	}
+
+	dx := (ext.Max.X() - ext.Min.X()) / tile_size * opts.Buffer
+	dy := (ext.Max.Y() - ext.Min.Y()) / tile_size * opts.Buffer
+
+	return tiles.BufferedTileBound(opts.Grid, tile, dx, dy)
+}
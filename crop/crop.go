@@ -1,18 +1,17 @@
-// package coverage provides methods for cropping the geometry of Who's On First records.
+// package crop provides methods for cropping the geometry of Who's On First records.
 package crop
 
 import (
 	"context"
 	"fmt"
-	_ "github.com/go-spatial/geom/slippy"
 	"github.com/paulmach/orb"
-	"github.com/paulmach/orb/clip"
 	"github.com/paulmach/orb/geojson"
 	"github.com/paulmach/orb/maptile"
-	"log"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
 )
 
-// CropFeatureWithTile will crop the geometry of a GeoJSON Feature defined by 'body' to the extent of 'tile'.
+// CropFeatureWithTile will crop the geometry of a GeoJSON Feature defined by 'body' to the extent of 'tile'. Use the
+// CropFeatureWithTileAndOptions method to crop features to a buffered extent.
 func CropFeatureWithTile(ctx context.Context, body []byte, tile maptile.Tile) ([]byte, error) {
 
 	bounds := tile.Bound()
@@ -28,17 +27,79 @@ func CropFeatureWithBounds(ctx context.Context, body []byte, bounds orb.Bound) (
 		return nil, fmt.Errorf("Failed to unmarshal feature, %w", err)
 	}
 
-	geom := f.Geometry
+	cropped, err := CropGeoJSONFeatureWithBounds(ctx, f, bounds)
 
-	clipped_geom := clip.Geometry(bounds, geom)
+	if err != nil {
+		return nil, err
+	}
 
-	if clipped_geom == nil {
-		log.Println("CROP", bounds.Min.Lon(), bounds.Min.Lat(), bounds.Max.Lon(), bounds.Max.Lat())
-		log.Println("FROM", geom.Bound())
+	return cropped.MarshalJSON()
+}
 
-		return nil, fmt.Errorf("Failed to derive clipped geometry")
+// FillFeatureWithBounds will replace the geometry of a GeoJSON Feature defined by 'body' with a polygon matching the
+// extent of 'bounds'. This is a cheap alternative to CropFeatureWithBounds for tiles that are known to be entirely
+// covered by the feature's geometry (for example tiles with a coverage.INSIDE_RELATIONSHIP relationship).
+func FillFeatureWithBounds(ctx context.Context, body []byte, bounds orb.Bound) ([]byte, error) {
+
+	f, err := geojson.UnmarshalFeature(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal feature, %w", err)
 	}
 
-	f.Geometry = clipped_geom
-	return f.MarshalJSON()
+	filled := geojson.NewFeature(bounds.ToPolygon())
+	filled.ID = f.ID
+	filled.Type = f.Type
+	filled.BBox = f.BBox
+	filled.Properties = f.Properties
+
+	return filled.MarshalJSON()
+}
+
+// CropGeoJSONFeatureWithTile will return a copy of 'f' whose geometry has been cropped to the extent of 'tile'. Use the
+// CropGeoJSONFeatureWithTileAndOptions method to crop features to a buffered extent.
+func CropGeoJSONFeatureWithTile(ctx context.Context, f *geojson.Feature, tile maptile.Tile) (*geojson.Feature, error) {
+
+	bounds := tile.Bound()
+	return CropGeoJSONFeatureWithBounds(ctx, f, bounds)
+}
+
+// CropGeoJSONFeatureWithBounds will return a copy of 'f' whose geometry has been cropped to the extent of 'bounds'.
+// The geometry of 'f' is not modified so it is safe to crop the same feature concurrently. Geometries that cross the
+// antimeridian are split (using the tiles.SplitAntimeridian method) before they are cropped. Polygons are repaired, as
+// they are cropped, so that degenerate rings and slivers are removed and self-intersections are resolved using the
+// even-odd rule. Each member of a GeometryCollection is cropped separately and members that do not intersect 'bounds'
+// are removed. If the feature does not intersect 'bounds' then ErrNoIntersection is returned. Other errors wrap
+// ErrEmptyGeometry, ErrInvalidGeometry or ErrInvalidBounds and can be tested for using errors.Is.
+func CropGeoJSONFeatureWithBounds(ctx context.Context, f *geojson.Feature, bounds orb.Bound) (*geojson.Feature, error) {
+
+	if !isFiniteBound(bounds) || bounds.IsEmpty() {
+		return nil, ErrInvalidBounds
+	}
+
+	err := checkGeometry(f.Geometry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	geom := tiles.SplitAntimeridian(orb.Clone(f.Geometry))
+
+	if !bounds.Intersects(geom.Bound()) {
+		return nil, ErrNoIntersection
+	}
+
+	clipped_geom := cropGeometry(geom, bounds)
+
+	if clipped_geom == nil {
+		return nil, ErrNoIntersection
+	}
+
+	cropped := geojson.NewFeature(clipped_geom)
+	cropped.ID = f.ID
+	cropped.Type = f.Type
+	cropped.BBox = f.BBox
+	cropped.Properties = f.Properties
+
+	return cropped, nil
 }
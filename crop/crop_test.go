@@ -0,0 +1,252 @@
+package crop
+
+import (
+	"context"
+	"errors"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"math"
+	"testing"
+)
+
+// cropSummary describes the parts of a cropped geometry in a way that does not depend on the order or starting point
+// of its rings and lines.
+type cropSummary struct {
+	Parts  int
+	Holes  int
+	Area   float64
+	Length float64
+}
+
+var square_with_hole = orb.Polygon{
+	orb.Ring{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}},
+	orb.Ring{{4, 4}, {4, 6}, {6, 6}, {6, 4}, {4, 4}},
+}
+
+func TestCropGeoJSONFeatureWithBounds(t *testing.T) {
+
+	tests := []struct {
+		Name     string
+		Geometry orb.Geometry
+		Bounds   orb.Bound
+		Error    error
+		Expected cropSummary
+	}{
+		{
+			Name:     "hole preserved",
+			Geometry: square_with_hole,
+			Bounds:   orb.Bound{Min: orb.Point{2, 2}, Max: orb.Point{8, 8}},
+			Expected: cropSummary{Parts: 1, Holes: 1, Area: 32},
+		},
+		{
+			Name:     "hole cut by bounds",
+			Geometry: square_with_hole,
+			Bounds:   orb.Bound{Min: orb.Point{5, -1}, Max: orb.Point{11, 11}},
+			Expected: cropSummary{Parts: 1, Holes: 0, Area: 48},
+		},
+		{
+			Name:     "concave ring split in to parts",
+			Geometry: orb.Polygon{orb.Ring{{0, 0}, {10, 0}, {10, 10}, {7, 10}, {7, 3}, {3, 3}, {3, 10}, {0, 10}, {0, 0}}},
+			Bounds:   orb.Bound{Min: orb.Point{-1, 5}, Max: orb.Point{11, 12}},
+			Expected: cropSummary{Parts: 2, Area: 30},
+		},
+		{
+			Name:     "bowtie",
+			Geometry: orb.Polygon{orb.Ring{{0, 0}, {10, 10}, {10, 0}, {0, 10}, {0, 0}}},
+			Bounds:   orb.Bound{Min: orb.Point{-1, -1}, Max: orb.Point{11, 11}},
+			Expected: cropSummary{Parts: 2, Area: 50},
+		},
+		{
+			Name:     "cropped bowtie",
+			Geometry: orb.Polygon{orb.Ring{{0, 0}, {10, 10}, {10, 0}, {0, 10}, {0, 0}}},
+			Bounds:   orb.Bound{Min: orb.Point{-1, -1}, Max: orb.Point{5, 11}},
+			Expected: cropSummary{Parts: 1, Area: 25},
+		},
+		{
+			Name:     "tile inside hole",
+			Geometry: square_with_hole,
+			Bounds:   orb.Bound{Min: orb.Point{4.5, 4.5}, Max: orb.Point{5.5, 5.5}},
+			Error:    ErrNoIntersection,
+		},
+		{
+			Name:     "line",
+			Geometry: orb.LineString{{-5, 5}, {15, 5}},
+			Bounds:   orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{10, 10}},
+			Expected: cropSummary{Parts: 1, Length: 10},
+		},
+		{
+			Name:     "line crossing antimeridian",
+			Geometry: orb.LineString{{170, 0}, {190, 0}},
+			Bounds:   orb.Bound{Min: orb.Point{-180, -10}, Max: orb.Point{-170, 10}},
+			Expected: cropSummary{Parts: 1, Length: 10},
+		},
+	}
+
+	ctx := context.Background()
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			f := geojson.NewFeature(test.Geometry)
+			cropped, err := CropGeoJSONFeatureWithBounds(ctx, f, test.Bounds)
+
+			if test.Error != nil {
+
+				if !errors.Is(err, test.Error) {
+					t.Fatalf("Expected error '%v', got '%v'", test.Error, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Failed to crop feature, %v", err)
+			}
+
+			compareSummary(t, summarizeGeometry(cropped.Geometry), test.Expected)
+		})
+	}
+}
+
+func TestCropGeoJSONFeatureWithGeometry(t *testing.T) {
+
+	antimeridian_mask := orb.Polygon{orb.Ring{{170, -10}, {-170, -10}, {-170, 10}, {170, 10}, {170, -10}}}
+
+	tests := []struct {
+		Name     string
+		Geometry orb.Geometry
+		Mask     orb.Geometry
+		Error    error
+		Expected cropSummary
+	}{
+		{
+			Name:     "polygon with hole preserved",
+			Geometry: orb.Bound{Min: orb.Point{2, 2}, Max: orb.Point{8, 8}}.ToPolygon(),
+			Mask:     square_with_hole,
+			Expected: cropSummary{Parts: 1, Holes: 1, Area: 32},
+		},
+		{
+			Name:     "polygon inside mask hole",
+			Geometry: orb.Bound{Min: orb.Point{4.5, 4.5}, Max: orb.Point{5.5, 5.5}}.ToPolygon(),
+			Mask:     square_with_hole,
+			Error:    ErrNoIntersection,
+		},
+		{
+			Name:     "line crossing mask with hole",
+			Geometry: orb.LineString{{-5, 5}, {15, 5}},
+			Mask:     square_with_hole,
+			Expected: cropSummary{Parts: 2, Length: 8},
+		},
+		{
+			Name:     "bowtie mask",
+			Geometry: orb.Bound{Min: orb.Point{-1, -1}, Max: orb.Point{11, 11}}.ToPolygon(),
+			Mask:     orb.Polygon{orb.Ring{{0, 0}, {10, 10}, {10, 0}, {0, 10}, {0, 0}}},
+			Expected: cropSummary{Parts: 2, Area: 50},
+		},
+		{
+			Name:     "points in antimeridian mask",
+			Geometry: orb.MultiPoint{{175, 0}, {-175, 0}, {0, 0}},
+			Mask:     antimeridian_mask,
+			Expected: cropSummary{Parts: 2},
+		},
+		{
+			Name:     "polygon in antimeridian mask",
+			Geometry: orb.Bound{Min: orb.Point{160, -5}, Max: orb.Point{200, 5}}.ToPolygon(),
+			Mask:     antimeridian_mask,
+			Expected: cropSummary{Parts: 2, Area: 200},
+		},
+		{
+			Name:     "polygon outside antimeridian mask",
+			Geometry: orb.Bound{Min: orb.Point{-10, -5}, Max: orb.Point{10, 5}}.ToPolygon(),
+			Mask:     antimeridian_mask,
+			Error:    ErrNoIntersection,
+		},
+	}
+
+	ctx := context.Background()
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			f := geojson.NewFeature(test.Geometry)
+			cropped, err := CropGeoJSONFeatureWithGeometry(ctx, f, test.Mask)
+
+			if test.Error != nil {
+
+				if !errors.Is(err, test.Error) {
+					t.Fatalf("Expected error '%v', got '%v'", test.Error, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Failed to crop feature, %v", err)
+			}
+
+			compareSummary(t, summarizeGeometry(cropped.Geometry), test.Expected)
+		})
+	}
+}
+
+func compareSummary(t *testing.T, got cropSummary, expected cropSummary) {
+
+	if got.Parts != expected.Parts || got.Holes != expected.Holes {
+		t.Fatalf("Expected %d parts and %d holes, got %d parts and %d holes", expected.Parts, expected.Holes, got.Parts, got.Holes)
+	}
+
+	if math.Abs(got.Area-expected.Area) > 1e-9 {
+		t.Fatalf("Expected area of %f, got %f", expected.Area, got.Area)
+	}
+
+	if math.Abs(got.Length-expected.Length) > 1e-9 {
+		t.Fatalf("Expected length of %f, got %f", expected.Length, got.Length)
+	}
+}
+
+func summarizeGeometry(g orb.Geometry) cropSummary {
+
+	var s cropSummary
+
+	switch g := g.(type) {
+	case orb.Point:
+		s.Parts = 1
+	case orb.MultiPoint:
+		s.Parts = len(g)
+	case orb.LineString:
+		s = summarizeGeometry(orb.MultiLineString{g})
+	case orb.MultiLineString:
+
+		for _, ls := range g {
+
+			s.Parts += 1
+
+			for i := 1; i < len(ls); i++ {
+				s.Length += math.Hypot(ls[i][0]-ls[i-1][0], ls[i][1]-ls[i-1][1])
+			}
+		}
+
+	case orb.Polygon:
+		s = summarizeGeometry(orb.MultiPolygon{g})
+	case orb.MultiPolygon:
+
+		for _, p := range g {
+
+			s.Parts += 1
+			s.Holes += len(p) - 1
+
+			for i, r := range p {
+
+				if i == 0 {
+					s.Area += math.Abs(signedArea(r))
+				} else {
+					s.Area -= math.Abs(signedArea(r))
+				}
+			}
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,19 @@
+package crop
+
+import (
+	"errors"
+)
+
+// ErrNoIntersection is returned when the geometry of a feature does not intersect the bounds, or mask, it is being
+// cropped to. This is not a failure as such and callers will typically skip the feature.
+var ErrNoIntersection = errors.New("Feature does not intersect crop area")
+
+// ErrEmptyGeometry is returned when a feature has no geometry to crop.
+var ErrEmptyGeometry = errors.New("Feature has no geometry")
+
+// ErrInvalidGeometry is returned when the geometry of a feature can not be cropped, for example because it contains
+// coordinates which are not finite numbers or geometry types that are not supported.
+var ErrInvalidGeometry = errors.New("Invalid geometry")
+
+// ErrInvalidBounds is returned when the bounds a feature is being cropped to are empty or not finite.
+var ErrInvalidBounds = errors.New("Invalid crop bounds")
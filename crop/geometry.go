@@ -0,0 +1,278 @@
+package crop
+
+import (
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+	"math"
+)
+
+// cropGeometry returns the parts of 'g' inside 'b' or nil if there are none. 'g' is modified so it should be cloned
+// first. The type of the geometry returned is the same as 'g' except for LineString and Polygon geometries which become
+// MultiLineString and MultiPolygon geometries, respectively, if they are split in to more than one part.
+func cropGeometry(g orb.Geometry, b orb.Bound) orb.Geometry {
+
+	switch g := g.(type) {
+	case orb.Point:
+
+		if !b.Contains(g) {
+			return nil
+		}
+
+		return g
+
+	case orb.MultiPoint:
+
+		mp := clip.MultiPoint(b, g)
+
+		if len(mp) == 0 {
+			return nil
+		}
+
+		return mp
+
+	case orb.LineString:
+
+		mls := cropLines(b, orb.MultiLineString{g})
+
+		switch len(mls) {
+		case 0:
+			return nil
+		case 1:
+			return mls[0]
+		default:
+			return mls
+		}
+
+	case orb.MultiLineString:
+
+		mls := cropLines(b, g)
+
+		if len(mls) == 0 {
+			return nil
+		}
+
+		return mls
+
+	case orb.Ring:
+		return cropGeometry(orb.Polygon{g}, b)
+	case orb.Polygon:
+
+		mp := cropPolygons(b, orb.MultiPolygon{g})
+
+		switch len(mp) {
+		case 0:
+			return nil
+		case 1:
+			return mp[0]
+		default:
+			return mp
+		}
+
+	case orb.MultiPolygon:
+
+		mp := cropPolygons(b, g)
+
+		if len(mp) == 0 {
+			return nil
+		}
+
+		return mp
+
+	case orb.Bound:
+
+		cropped := clip.Bound(b, g)
+
+		if cropped.Min.X() >= cropped.Max.X() || cropped.Min.Y() >= cropped.Max.Y() {
+			return nil
+		}
+
+		return cropped
+
+	case orb.Collection:
+
+		c := make(orb.Collection, 0)
+
+		for _, cg := range g {
+
+			cropped := cropGeometry(cg, b)
+
+			if cropped != nil {
+				c = append(c, cropped)
+			}
+		}
+
+		if len(c) == 0 {
+			return nil
+		}
+
+		return c
+
+	default:
+		return nil
+	}
+}
+
+// cropLines returns the parts of the lines in 'mls' inside 'b'. Lines with fewer than two distinct points are removed.
+func cropLines(b orb.Bound, mls orb.MultiLineString) orb.MultiLineString {
+
+	cropped := make(orb.MultiLineString, 0)
+
+	for _, ls := range clip.MultiLineString(b, mls) {
+
+		pts := dedupePoints(ls)
+
+		if len(pts) < 2 {
+			continue
+		}
+
+		cropped = append(cropped, orb.LineString(pts))
+	}
+
+	return cropped
+}
+
+// cropPolygons returns the parts of the polygons in 'mp' inside 'b'. The rings of each polygon are clipped to 'b'
+// and the results are then repaired if necessary, since clipping a concave ring leaves zero-width slivers along the
+// edges of 'b' and does not remove interior rings which cover all of 'b'. Rings which do not intersect 'b' are removed.
+func cropPolygons(b orb.Bound, mp orb.MultiPolygon) orb.MultiPolygon {
+
+	cropped := make(orb.MultiPolygon, 0)
+
+	for _, p := range mp {
+
+		clipped := make(orb.Polygon, 0, len(p))
+
+		for _, r := range p {
+
+			rb := r.Bound()
+
+			if !rb.Intersects(b) {
+				continue
+			}
+
+			// Rings entirely inside 'b' are unchanged.
+
+			if b.Contains(rb.Min) && b.Contains(rb.Max) {
+				clipped = append(clipped, r)
+				continue
+			}
+
+			// Clipping can leave consecutive duplicate points, for example where a ring is clipped at a
+			// corner of 'b', which would otherwise cause the (valid) result to be repaired.
+
+			cr := clip.Ring(b, r)
+
+			if cr != nil {
+				clipped = append(clipped, orb.Ring(dedupePoints(cr)))
+			}
+		}
+
+		if len(clipped) == 0 {
+			continue
+		}
+
+		cropped = append(cropped, repairPolygon(clipped)...)
+	}
+
+	return cropped
+}
+
+// checkGeometry returns an error wrapping ErrEmptyGeometry if 'g' is nil or has no coordinates or ErrInvalidGeometry if
+// it contains coordinates which are not finite numbers.
+func checkGeometry(g orb.Geometry) error {
+
+	if g == nil {
+		return ErrEmptyGeometry
+	}
+
+	count := 0
+	finite := true
+
+	var walk func(orb.Geometry) error
+
+	points := func(pts []orb.Point) {
+
+		for _, pt := range pts {
+			finite = finite && isFinitePoint(pt)
+		}
+
+		count += len(pts)
+	}
+
+	walk = func(g orb.Geometry) error {
+
+		switch g := g.(type) {
+		case orb.Point:
+			points([]orb.Point{g})
+		case orb.MultiPoint:
+			points(g)
+		case orb.LineString:
+			points(g)
+		case orb.MultiLineString:
+
+			for _, ls := range g {
+				points(ls)
+			}
+
+		case orb.Ring:
+			points(g)
+		case orb.Polygon:
+
+			for _, r := range g {
+				points(r)
+			}
+
+		case orb.MultiPolygon:
+
+			for _, p := range g {
+
+				for _, r := range p {
+					points(r)
+				}
+			}
+
+		case orb.Bound:
+			points([]orb.Point{g.Min, g.Max})
+		case orb.Collection:
+
+			for _, cg := range g {
+
+				err := walk(cg)
+
+				if err != nil {
+					return err
+				}
+			}
+
+		default:
+			return fmt.Errorf("Unsupported geometry type '%T', %w", g, ErrInvalidGeometry)
+		}
+
+		return nil
+	}
+
+	err := walk(g)
+
+	if err != nil {
+		return err
+	}
+
+	if !finite {
+		return fmt.Errorf("Geometry contains non-finite coordinates, %w", ErrInvalidGeometry)
+	}
+
+	if count == 0 {
+		return ErrEmptyGeometry
+	}
+
+	return nil
+}
+
+func isFinitePoint(pt orb.Point) bool {
+	return !math.IsNaN(pt.X()) && !math.IsNaN(pt.Y()) && !math.IsInf(pt.X(), 0) && !math.IsInf(pt.Y(), 0)
+}
+
+func isFiniteBound(b orb.Bound) bool {
+	return isFinitePoint(b.Min) && isFinitePoint(b.Max)
+}
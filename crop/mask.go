@@ -0,0 +1,259 @@
+package crop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+	"io"
+)
+
+// CropFeatureWithGeometry will crop the geometry of a GeoJSON Feature defined by 'body' to 'mask' which is expected
+// to be a Polygon or MultiPolygon (or a Collection of them) in EPSG:4326 coordinates. If the feature does not
+// intersect 'mask' then ErrNoIntersection is returned.
+func CropFeatureWithGeometry(ctx context.Context, body []byte, mask orb.Geometry) ([]byte, error) {
+
+	f, err := geojson.UnmarshalFeature(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal feature, %w", err)
+	}
+
+	cropped, err := CropGeoJSONFeatureWithGeometry(ctx, f, mask)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cropped.MarshalJSON()
+}
+
+// CropGeoJSONFeatureWithGeometry will return a copy of 'f' whose geometry is the intersection of its geometry and
+// 'mask' which is expected to be a Polygon or MultiPolygon (or a Collection of them) in EPSG:4326 coordinates.
+// Interior rings (holes) in both the feature's geometry and 'mask' are preserved. Lines are cut where they cross the
+// edges of 'mask' and points outside of 'mask' are removed. Geometries that cross the antimeridian are split (using
+// the tiles.SplitAntimeridian method) before they are cropped. Polygons, in both the feature and 'mask', are repaired
+// first so that self-intersections are resolved using the even-odd rule. If the feature does not intersect 'mask' then
+// ErrNoIntersection is returned. Other errors wrap ErrEmptyGeometry or ErrInvalidGeometry and can be tested for using
+// errors.Is. When cropping many features to the same mask use NewMask and CropGeoJSONFeatureWithMask instead so
+// that 'mask' is only repaired once.
+func CropGeoJSONFeatureWithGeometry(ctx context.Context, f *geojson.Feature, mask orb.Geometry) (*geojson.Feature, error) {
+
+	m, err := NewMask(mask)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return CropGeoJSONFeatureWithMask(ctx, f, m)
+}
+
+// Mask is a crop mask whose polygons have been validated and repaired so that it can be used to crop any number of
+// features.
+type Mask struct {
+	polygons orb.MultiPolygon
+	rings    []orb.Ring
+	bound    orb.Bound
+}
+
+// NewMask returns a new Mask derived from the polygons in 'geom'. See MaskPolygons for details.
+func NewMask(geom orb.Geometry) (*Mask, error) {
+
+	mp, err := MaskPolygons(geom)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Mask{
+		polygons: mp,
+		rings:    normalizeRings(mp),
+		bound:    mp.Bound(),
+	}
+
+	return m, nil
+}
+
+// Polygons returns the (repaired) polygons of the mask.
+func (m *Mask) Polygons() orb.MultiPolygon {
+	return m.polygons
+}
+
+// Bound returns the bounds of the mask.
+func (m *Mask) Bound() orb.Bound {
+	return m.bound
+}
+
+// CropFeatureWithMask will crop the geometry of a GeoJSON Feature defined by 'body' to 'm'. If the feature does not
+// intersect 'm' then ErrNoIntersection is returned.
+func CropFeatureWithMask(ctx context.Context, body []byte, m *Mask) ([]byte, error) {
+
+	f, err := geojson.UnmarshalFeature(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal feature, %w", err)
+	}
+
+	cropped, err := CropGeoJSONFeatureWithMask(ctx, f, m)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cropped.MarshalJSON()
+}
+
+// CropGeoJSONFeatureWithMask will return a copy of 'f' whose geometry is the intersection of its geometry and 'm'. See
+// CropGeoJSONFeatureWithGeometry for details.
+func CropGeoJSONFeatureWithMask(ctx context.Context, f *geojson.Feature, m *Mask) (*geojson.Feature, error) {
+
+	err := checkGeometry(f.Geometry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	geom := tiles.SplitAntimeridian(orb.Clone(f.Geometry))
+
+	if len(m.rings) == 0 || !geom.Bound().Intersects(m.bound) {
+		return nil, ErrNoIntersection
+	}
+
+	clipped_geom := intersectGeometry(geom, m.rings)
+
+	if clipped_geom == nil {
+		return nil, ErrNoIntersection
+	}
+
+	cropped := geojson.NewFeature(clipped_geom)
+	cropped.ID = f.ID
+	cropped.Type = f.Type
+	cropped.BBox = f.BBox
+	cropped.Properties = f.Properties
+
+	return cropped, nil
+}
+
+// MaskPolygons returns the polygons in 'geom', which may be a Polygon, MultiPolygon, Bound or a Collection of them, as
+// a MultiPolygon suitable for use as a crop mask. Masks that cross the antimeridian are split (using the
+// tiles.SplitAntimeridian method) and self-intersecting polygons are repaired using the even-odd rule. It is an error
+// for 'geom' to contain any other type of geometry.
+func MaskPolygons(geom orb.Geometry) (orb.MultiPolygon, error) {
+
+	err := checkGeometry(geom)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid mask geometry, %w", err)
+	}
+
+	mp, err := maskPolygons(geom)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mp = repairPolygons(mp)
+
+	if len(mp) == 0 {
+		return nil, fmt.Errorf("Mask geometry has no polygons")
+	}
+
+	return mp, nil
+}
+
+// maskPolygons returns the polygons in 'geom', as they are, or an error if it contains other types of geometry.
+func maskPolygons(geom orb.Geometry) (orb.MultiPolygon, error) {
+
+	mp := make(orb.MultiPolygon, 0)
+
+	switch g := tiles.SplitAntimeridian(geom).(type) {
+	case orb.Polygon:
+		mp = append(mp, g)
+	case orb.MultiPolygon:
+		mp = append(mp, g...)
+	case orb.Bound:
+		mp = append(mp, g.ToPolygon())
+	case orb.Collection:
+
+		for _, cg := range g {
+
+			cg_mp, err := maskPolygons(cg)
+
+			if err != nil {
+				return nil, err
+			}
+
+			mp = append(mp, cg_mp...)
+		}
+
+	default:
+		return nil, fmt.Errorf("Invalid mask geometry type '%s', %w", geom.GeoJSONType(), ErrInvalidGeometry)
+	}
+
+	return mp, nil
+}
+
+// MaskFromReader returns a crop mask derived from the GeoJSON Feature, FeatureCollection or Geometry read from 'r'.
+// The polygons of all the features in a FeatureCollection are combined and are expected not to overlap.
+func MaskFromReader(r io.Reader) (orb.MultiPolygon, error) {
+
+	body, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read mask, %w", err)
+	}
+
+	var doc struct {
+		Type string `json:"type"`
+	}
+
+	err = json.Unmarshal(body, &doc)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal mask, %w", err)
+	}
+
+	var geom orb.Geometry
+
+	switch doc.Type {
+	case "Feature":
+
+		f, err := geojson.UnmarshalFeature(body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal mask feature, %w", err)
+		}
+
+		geom = f.Geometry
+
+	case "FeatureCollection":
+
+		fc, err := geojson.UnmarshalFeatureCollection(body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal mask feature collection, %w", err)
+		}
+
+		c := make(orb.Collection, len(fc.Features))
+
+		for i, f := range fc.Features {
+			c[i] = f.Geometry
+		}
+
+		geom = c
+
+	default:
+
+		g, err := geojson.UnmarshalGeometry(body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal mask geometry, %w", err)
+		}
+
+		geom = g.Geometry()
+	}
+
+	return MaskPolygons(geom)
+}
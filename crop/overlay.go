@@ -0,0 +1,958 @@
+package crop
+
+import (
+	"github.com/paulmach/orb"
+	"math"
+	"sort"
+)
+
+// The distance, in the units of the geometries being compared, below which points are considered to be on a line.
+const overlay_tolerance float64 = 1e-12
+
+// The maximum number of rows, or columns, used to index edges.
+const max_index_cells int = 4096
+
+// segment is a single (directed) edge of a ring or line, along with the points where it is intersected by another
+// geometry.
+type segment struct {
+	a      orb.Point
+	b      orb.Point
+	path   int
+	splits []orb.Point
+}
+
+// piece is a (directed) part of a segment between two consecutive nodes.
+type piece [2]orb.Point
+
+// polygonIndex provides point-in-polygon tests for a set of rings using the even-odd rule. Edges are bucketed in to
+// horizontal rows so that each test only needs to consider the edges that span the row containing the point.
+type polygonIndex struct {
+	edges      []piece
+	rows       [][]int
+	min_y      float64
+	row_height float64
+}
+
+func newPolygonIndex(rings []orb.Ring) *polygonIndex {
+
+	edges := make([]piece, 0)
+	b := orb.Bound{Min: orb.Point{math.Inf(1), math.Inf(1)}, Max: orb.Point{math.Inf(-1), math.Inf(-1)}}
+
+	for _, r := range rings {
+
+		for i := 1; i < len(r); i++ {
+			edges = append(edges, piece{r[i-1], r[i]})
+		}
+
+		if len(r) > 0 {
+			b = b.Union(r.Bound())
+		}
+	}
+
+	count := len(edges)/4 + 1
+
+	if count > max_index_cells {
+		count = max_index_cells
+	}
+
+	height := (b.Max.Y() - b.Min.Y()) / float64(count)
+
+	if height <= 0 {
+		count = 1
+		height = 1
+	}
+
+	idx := &polygonIndex{
+		edges:      edges,
+		rows:       make([][]int, count),
+		min_y:      b.Min.Y(),
+		row_height: height,
+	}
+
+	for i, e := range edges {
+
+		r1 := idx.row(math.Min(e[0].Y(), e[1].Y()))
+		r2 := idx.row(math.Max(e[0].Y(), e[1].Y()))
+
+		for r := r1; r <= r2; r++ {
+			idx.rows[r] = append(idx.rows[r], i)
+		}
+	}
+
+	return idx
+}
+
+func (idx *polygonIndex) row(y float64) int {
+
+	r := int((y - idx.min_y) / idx.row_height)
+
+	if r < 0 {
+		return 0
+	}
+
+	if r >= len(idx.rows) {
+		return len(idx.rows) - 1
+	}
+
+	return r
+}
+
+func (idx *polygonIndex) contains(pt orb.Point) bool {
+
+	if len(idx.edges) == 0 || pt.Y() < idx.min_y || pt.Y() > idx.min_y+idx.row_height*float64(len(idx.rows)) {
+		return false
+	}
+
+	inside := false
+
+	for _, i := range idx.rows[idx.row(pt.Y())] {
+
+		pj := idx.edges[i][0]
+		pk := idx.edges[i][1]
+
+		if (pj.Y() > pt.Y()) != (pk.Y() > pt.Y()) {
+
+			x := pj.X() + (pt.Y()-pj.Y())*(pk.X()-pj.X())/(pk.Y()-pj.Y())
+
+			if pt.X() < x {
+				inside = !inside
+			}
+		}
+	}
+
+	return inside
+}
+
+// intersectGeometry returns the parts of 'geom' that are inside the polygon described by 'mask_rings' (following the
+// even-odd rule) or nil if there are none. Polygons are repaired and then intersected with the mask (preserving any
+// interior rings in either), lines are cut where they cross the edges of the mask and points outside of the mask are
+// removed.
+func intersectGeometry(geom orb.Geometry, mask_rings []orb.Ring) orb.Geometry {
+
+	switch g := geom.(type) {
+	case orb.Point:
+
+		if !newPolygonIndex(mask_rings).contains(g) {
+			return nil
+		}
+
+		return g
+
+	case orb.MultiPoint:
+
+		idx := newPolygonIndex(mask_rings)
+		mp := make(orb.MultiPoint, 0)
+
+		for _, pt := range g {
+
+			if idx.contains(pt) {
+				mp = append(mp, pt)
+			}
+		}
+
+		if len(mp) == 0 {
+			return nil
+		}
+
+		return mp
+
+	case orb.LineString:
+		return intersectLines(orb.MultiLineString{g}, mask_rings)
+	case orb.MultiLineString:
+		return intersectLines(g, mask_rings)
+	case orb.Ring:
+		return intersectPolygons(repairPolygons(orb.MultiPolygon{orb.Polygon{g}}), mask_rings)
+	case orb.Polygon:
+		return intersectPolygons(repairPolygons(orb.MultiPolygon{g}), mask_rings)
+	case orb.MultiPolygon:
+		return intersectPolygons(repairPolygons(g), mask_rings)
+	case orb.Bound:
+		return intersectPolygons(orb.MultiPolygon{g.ToPolygon()}, mask_rings)
+	case orb.Collection:
+
+		c := make(orb.Collection, 0)
+
+		for _, cg := range g {
+
+			i := intersectGeometry(cg, mask_rings)
+
+			if i != nil {
+				c = append(c, i)
+			}
+		}
+
+		if len(c) == 0 {
+			return nil
+		}
+
+		return c
+
+	default:
+		return nil
+	}
+}
+
+// intersectPolygons returns the intersection of the polygons in 'subject' and the (normalized) rings in 'mask_rings'
+// as a Polygon or MultiPolygon, or nil if they do not intersect. Both the subject and the mask are expected to be
+// valid (non self-intersecting) polygons.
+func intersectPolygons(subject orb.MultiPolygon, mask_rings []orb.Ring) orb.Geometry {
+
+	subject_rings := normalizeRings(subject)
+
+	if len(subject_rings) == 0 {
+		return nil
+	}
+
+	subject_segs := ringSegments(subject_rings)
+	mask_segs := ringSegments(mask_rings)
+
+	nodes := nodeSegments(subject_segs, mask_segs)
+
+	subject_pieces := segmentPieces(subject_segs)
+	mask_pieces := segmentPieces(mask_segs)
+
+	subject_set := pieceSet(subject_pieces)
+	mask_set := pieceSet(mask_pieces)
+
+	subject_idx := newPolygonIndex(subject_rings)
+	mask_idx := newPolygonIndex(mask_rings)
+
+	edges := make([]piece, 0)
+
+	// Keep the parts of the subject's edges that are inside the mask and the parts of the mask's edges that
+	// are inside the subject. Edges shared by both are kept (once) if the interiors of both are on the same
+	// side and dropped otherwise.
+
+	keep_subject := func(p piece) (bool, bool) {
+
+		if mask_set[p] {
+			return true, true
+		}
+
+		if mask_set[piece{p[1], p[0]}] {
+			return false, true
+		}
+
+		return false, false
+	}
+
+	keep_mask := func(p piece) (bool, bool) {
+
+		if subject_set[p] || subject_set[piece{p[1], p[0]}] {
+			return false, true
+		}
+
+		return false, false
+	}
+
+	edges = append(edges, classifyPieces(subject_segs, subject_pieces, mask_idx, nodes, keep_subject)...)
+	edges = append(edges, classifyPieces(mask_segs, mask_pieces, subject_idx, nodes, keep_mask)...)
+
+	rings := assembleRings(edges)
+
+	return polygonsFromRings(rings)
+}
+
+// intersectLines returns the parts of the lines in 'mls' that are inside, or on the edge of, the (normalized) rings in
+// 'mask_rings' as a LineString or MultiLineString, or nil if there are none.
+func intersectLines(mls orb.MultiLineString, mask_rings []orb.Ring) orb.Geometry {
+
+	line_segs := make([]*segment, 0)
+
+	for i, ls := range mls {
+
+		pts := dedupePoints(ls)
+
+		for j := 1; j < len(pts); j++ {
+			line_segs = append(line_segs, &segment{a: pts[j-1], b: pts[j], path: i})
+		}
+	}
+
+	if len(line_segs) == 0 {
+		return nil
+	}
+
+	mask_segs := ringSegments(mask_rings)
+
+	nodes := nodeSegments(line_segs, mask_segs)
+
+	line_pieces := segmentPieces(line_segs)
+	mask_set := pieceSet(segmentPieces(mask_segs))
+
+	mask_idx := newPolygonIndex(mask_rings)
+
+	on_edge := func(p piece) (bool, bool) {
+
+		if mask_set[p] || mask_set[piece{p[1], p[0]}] {
+			return true, true
+		}
+
+		return false, false
+	}
+
+	kept := classifyPieces(line_segs, line_pieces, mask_idx, nodes, on_edge)
+
+	// Join consecutive pieces back in to lines.
+
+	out := make(orb.MultiLineString, 0)
+	var current orb.LineString
+
+	for _, p := range kept {
+
+		if len(current) > 0 && current[len(current)-1].Equal(p[0]) {
+			current = append(current, p[1])
+			continue
+		}
+
+		if len(current) > 1 {
+			out = append(out, current)
+		}
+
+		current = orb.LineString{p[0], p[1]}
+	}
+
+	if len(current) > 1 {
+		out = append(out, current)
+	}
+
+	switch len(out) {
+	case 0:
+		return nil
+	case 1:
+		return out[0]
+	default:
+		return out
+	}
+}
+
+// classifyPieces returns the pieces of 'segs' (in order) that should be kept. The 'shared' function is called first
+// for each piece and returns whether the piece should be kept and whether that decision is final, for example because
+// the piece lies on the edge of the other geometry. Otherwise a piece is kept if its midpoint is inside 'idx'. Since
+// pieces can only cross in or out of 'idx' at a node the point-in-polygon test is only repeated after a node.
+func classifyPieces(segs []*segment, pieces [][]piece, idx *polygonIndex, nodes map[orb.Point]bool, shared func(piece) (bool, bool)) []piece {
+
+	kept := make([]piece, 0)
+
+	inside := false
+	stale := true
+	path := -1
+
+	for i, seg := range segs {
+
+		if seg.path != path {
+			path = seg.path
+			stale = true
+		}
+
+		for _, p := range pieces[i] {
+
+			keep, final := shared(p)
+
+			if final {
+
+				if keep {
+					kept = append(kept, p)
+				}
+
+				stale = true
+				continue
+			}
+
+			if stale || nodes[p[0]] {
+				inside = idx.contains(midpoint(p[0], p[1]))
+				stale = false
+			}
+
+			if inside {
+				kept = append(kept, p)
+			}
+		}
+	}
+
+	return kept
+}
+
+// nodeSegments adds the points where each segment in 'a' intersects each segment in 'b' to the splits of both and
+// returns the set of all the intersection points. The segments in 'b' are bucketed in to a uniform grid so that only
+// segments whose bounding boxes share a grid cell are tested.
+func nodeSegments(a []*segment, b []*segment) map[orb.Point]bool {
+
+	nodes := make(map[orb.Point]bool)
+
+	if len(a) == 0 || len(b) == 0 {
+		return nodes
+	}
+
+	bound := func(s *segment) orb.Bound {
+		return orb.Bound{Min: s.a, Max: s.a}.Extend(s.b)
+	}
+
+	extent := bound(b[0])
+	total := 0.0
+
+	for _, s := range b {
+		sb := bound(s)
+		extent = extent.Union(sb)
+		total += math.Max(sb.Max.X()-sb.Min.X(), sb.Max.Y()-sb.Min.Y())
+	}
+
+	// Cells are sized to match the average segment so that the number of segments in each cell stays small
+	// however the segments are distributed (for example along the outline of a large, detailed polygon).
+
+	size := 1
+	avg := total / float64(len(b))
+
+	if avg > 0 {
+		size = int(math.Ceil(math.Max(extent.Max.X()-extent.Min.X(), extent.Max.Y()-extent.Min.Y()) / avg))
+	}
+
+	if size < 1 {
+		size = 1
+	}
+
+	if size > max_index_cells {
+		size = max_index_cells
+	}
+
+	cell_w := (extent.Max.X() - extent.Min.X()) / float64(size)
+	cell_h := (extent.Max.Y() - extent.Min.Y()) / float64(size)
+
+	cell := func(v float64, min float64, d float64) int {
+
+		if d <= 0 {
+			return 0
+		}
+
+		c := int((v - min) / d)
+
+		if c < 0 {
+			return 0
+		}
+
+		if c >= size {
+			return size - 1
+		}
+
+		return c
+	}
+
+	cells := make(map[int][]int)
+
+	for i, s := range b {
+
+		sb := bound(s)
+
+		for x := cell(sb.Min.X(), extent.Min.X(), cell_w); x <= cell(sb.Max.X(), extent.Min.X(), cell_w); x++ {
+			for y := cell(sb.Min.Y(), extent.Min.Y(), cell_h); y <= cell(sb.Max.Y(), extent.Min.Y(), cell_h); y++ {
+				cells[y*size+x] = append(cells[y*size+x], i)
+			}
+		}
+	}
+
+	// Where several segments cross at (nearly) the same point the computed intersections can differ slightly
+	// depending on which pair of segments they were derived from. Computed points are snapped to any existing
+	// vertex or intersection within overlay_tolerance so that they all meet at a single node.
+
+	snap_idx := make(map[[2]float64][]orb.Point)
+
+	snap_key := func(pt orb.Point) [2]float64 {
+		return [2]float64{math.Floor(pt.X() / overlay_tolerance), math.Floor(pt.Y() / overlay_tolerance)}
+	}
+
+	snap := func(pt orb.Point) orb.Point {
+
+		k := snap_key(pt)
+
+		for dx := -1.0; dx <= 1.0; dx++ {
+			for dy := -1.0; dy <= 1.0; dy++ {
+
+				for _, other := range snap_idx[[2]float64{k[0] + dx, k[1] + dy}] {
+
+					if math.Abs(other.X()-pt.X()) <= overlay_tolerance && math.Abs(other.Y()-pt.Y()) <= overlay_tolerance {
+						return other
+					}
+				}
+			}
+		}
+
+		snap_idx[k] = append(snap_idx[k], pt)
+		return pt
+	}
+
+	for _, segs := range [][]*segment{a, b} {
+
+		for _, s := range segs {
+			snap(s.a)
+			snap(s.b)
+		}
+	}
+
+	// Segments in 'b' can share more than one cell with a segment in 'a' so keep track of which segment
+	// in 'a' each one was last tested against.
+
+	tested := make([]int, len(b))
+
+	for i := range tested {
+		tested[i] = -1
+	}
+
+	// When noding a set of segments against itself each pair only needs to be tested once.
+
+	self := len(a) == len(b) && &a[0] == &b[0]
+
+	for i, s := range a {
+
+		sb := bound(s)
+
+		if !sb.Intersects(extent) {
+			continue
+		}
+
+		for x := cell(sb.Min.X(), extent.Min.X(), cell_w); x <= cell(sb.Max.X(), extent.Min.X(), cell_w); x++ {
+			for y := cell(sb.Min.Y(), extent.Min.Y(), cell_h); y <= cell(sb.Max.Y(), extent.Min.Y(), cell_h); y++ {
+
+				for _, j := range cells[y*size+x] {
+
+					if tested[j] == i || (self && j <= i) {
+						continue
+					}
+
+					tested[j] = i
+					o := b[j]
+
+					for _, pt := range segmentIntersections(s.a, s.b, o.a, o.b) {
+
+						if !isEndpoint(pt, s, o) {
+							pt = snap(pt)
+						}
+
+						s.splits = append(s.splits, pt)
+						o.splits = append(o.splits, pt)
+						nodes[pt] = true
+					}
+				}
+			}
+		}
+	}
+
+	return nodes
+}
+
+// isEndpoint returns true if 'pt' is one of the endpoints of 's' or 'o'.
+func isEndpoint(pt orb.Point, s *segment, o *segment) bool {
+	return pt.Equal(s.a) || pt.Equal(s.b) || pt.Equal(o.a) || pt.Equal(o.b)
+}
+
+// segmentIntersections returns the points where the segment 'p1' to 'p2' intersects the segment 'q1' to 'q2'. Where
+// the segments touch, or overlap, the endpoints involved are returned rather than computed points.
+func segmentIntersections(p1 orb.Point, p2 orb.Point, q1 orb.Point, q2 orb.Point) []orb.Point {
+
+	if math.Max(p1.Y(), p2.Y()) < math.Min(q1.Y(), q2.Y()) || math.Min(p1.Y(), p2.Y()) > math.Max(q1.Y(), q2.Y()) {
+		return nil
+	}
+
+	d1 := side(q1, q2, p1)
+	d2 := side(q1, q2, p2)
+	d3 := side(p1, p2, q1)
+	d4 := side(p1, p2, q2)
+
+	var pts []orb.Point
+
+	if d1 == 0 && within(q1, q2, p1) {
+		pts = append(pts, p1)
+	}
+
+	if d2 == 0 && within(q1, q2, p2) {
+		pts = append(pts, p2)
+	}
+
+	if d3 == 0 && within(p1, p2, q1) {
+		pts = append(pts, q1)
+	}
+
+	if d4 == 0 && within(p1, p2, q2) {
+		pts = append(pts, q2)
+	}
+
+	if len(pts) > 0 {
+		return pts
+	}
+
+	if d1*d2 < 0 && d3*d4 < 0 {
+
+		r := orb.Point{p2.X() - p1.X(), p2.Y() - p1.Y()}
+		s := orb.Point{q2.X() - q1.X(), q2.Y() - q1.Y()}
+
+		denom := r.X()*s.Y() - r.Y()*s.X()
+
+		if denom == 0 {
+			return nil
+		}
+
+		t := ((q1.X()-p1.X())*s.Y() - (q1.Y()-p1.Y())*s.X()) / denom
+
+		pts = append(pts, orb.Point{p1.X() + t*r.X(), p1.Y() + t*r.Y()})
+	}
+
+	return pts
+}
+
+// side returns 1 if 'pt' is to the left of the line from 'a' to 'b', -1 if it is to the right and 0 if it is within
+// overlay_tolerance of the line.
+func side(a orb.Point, b orb.Point, pt orb.Point) int {
+
+	dx := b.X() - a.X()
+	dy := b.Y() - a.Y()
+
+	length := math.Sqrt(dx*dx + dy*dy)
+
+	if length == 0 {
+		return 0
+	}
+
+	d := (dx*(pt.Y()-a.Y()) - dy*(pt.X()-a.X())) / length
+
+	switch {
+	case d > overlay_tolerance:
+		return 1
+	case d < -overlay_tolerance:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// within returns true if 'pt', which is assumed to be on the line from 'a' to 'b', is between 'a' and 'b'.
+func within(a orb.Point, b orb.Point, pt orb.Point) bool {
+
+	dx := b.X() - a.X()
+	dy := b.Y() - a.Y()
+
+	length_sq := dx*dx + dy*dy
+	dot := (pt.X()-a.X())*dx + (pt.Y()-a.Y())*dy
+
+	tolerance := overlay_tolerance * math.Sqrt(length_sq)
+
+	return dot >= -tolerance && dot <= length_sq+tolerance
+}
+
+// ringSegments returns the segments of each ring in 'rings'.
+func ringSegments(rings []orb.Ring) []*segment {
+
+	segs := make([]*segment, 0)
+
+	for i, r := range rings {
+
+		for j := 1; j < len(r); j++ {
+			segs = append(segs, &segment{a: r[j-1], b: r[j], path: i})
+		}
+	}
+
+	return segs
+}
+
+// segmentPieces returns the pieces of each segment in 'segs' once it has been split at each of its nodes.
+func segmentPieces(segs []*segment) [][]piece {
+
+	pieces := make([][]piece, len(segs))
+
+	for i, s := range segs {
+
+		dx := s.b.X() - s.a.X()
+		dy := s.b.Y() - s.a.Y()
+
+		param := func(pt orb.Point) float64 {
+			return ((pt.X()-s.a.X())*dx + (pt.Y()-s.a.Y())*dy) / (dx*dx + dy*dy)
+		}
+
+		splits := make([]orb.Point, 0, len(s.splits))
+
+		for _, pt := range s.splits {
+
+			if pt.Equal(s.a) || pt.Equal(s.b) {
+				continue
+			}
+
+			t := param(pt)
+
+			if t <= 0 || t >= 1 {
+				continue
+			}
+
+			splits = append(splits, pt)
+		}
+
+		sort.Slice(splits, func(i, j int) bool {
+			return param(splits[i]) < param(splits[j])
+		})
+
+		seg_pieces := make([]piece, 0, len(splits)+1)
+		prev := s.a
+
+		for _, pt := range append(splits, s.b) {
+
+			if pt.Equal(prev) {
+				continue
+			}
+
+			seg_pieces = append(seg_pieces, piece{prev, pt})
+			prev = pt
+		}
+
+		pieces[i] = seg_pieces
+	}
+
+	return pieces
+}
+
+func pieceSet(pieces [][]piece) map[piece]bool {
+
+	set := make(map[piece]bool)
+
+	for _, seg_pieces := range pieces {
+
+		for _, p := range seg_pieces {
+			set[p] = true
+		}
+	}
+
+	return set
+}
+
+// assembleRings links 'edges', whose interiors are all on their left, in to closed rings. Where more than one edge
+// leaves a point the edge making the sharpest left turn is followed so that rings which only touch at a point are
+// kept separate. Edges that can not be linked in to a closed ring are discarded.
+func assembleRings(edges []piece) []orb.Ring {
+
+	outgoing := make(map[orb.Point][]int)
+
+	for i, e := range edges {
+		outgoing[e[0]] = append(outgoing[e[0]], i)
+	}
+
+	used := make([]bool, len(edges))
+	rings := make([]orb.Ring, 0)
+
+	for i, e := range edges {
+
+		if used[i] {
+			continue
+		}
+
+		used[i] = true
+
+		start := e[0]
+		ring := orb.Ring{e[0], e[1]}
+		current := e
+
+		closed := false
+
+		for {
+
+			if current[1].Equal(start) {
+				closed = true
+				break
+			}
+
+			next := -1
+			best := math.Inf(-1)
+
+			in_x := current[1].X() - current[0].X()
+			in_y := current[1].Y() - current[0].Y()
+
+			for _, j := range outgoing[current[1]] {
+
+				if used[j] {
+					continue
+				}
+
+				out_x := edges[j][1].X() - edges[j][0].X()
+				out_y := edges[j][1].Y() - edges[j][0].Y()
+
+				angle := math.Atan2(in_x*out_y-in_y*out_x, in_x*out_x+in_y*out_y)
+
+				if angle > best {
+					best = angle
+					next = j
+				}
+			}
+
+			if next == -1 {
+				break
+			}
+
+			used[next] = true
+			current = edges[next]
+			ring = append(ring, current[1])
+		}
+
+		if closed && len(ring) >= 4 {
+			rings = append(rings, ring)
+		}
+	}
+
+	return rings
+}
+
+// polygonsFromRings returns a Polygon or MultiPolygon for 'rings' where counter-clockwise rings are treated as
+// exterior rings and clockwise rings as interior rings (holes). Each hole is assigned to the smallest exterior ring
+// that contains it. Rings with no area, and holes that are not contained by any exterior ring, are discarded.
+func polygonsFromRings(rings []orb.Ring) orb.Geometry {
+
+	shells := make([]orb.Ring, 0)
+	shell_areas := make([]float64, 0)
+	holes := make([]orb.Ring, 0)
+
+	for _, r := range rings {
+
+		area := signedArea(r)
+
+		switch {
+		case area > overlay_tolerance*overlay_tolerance:
+			shells = append(shells, r)
+			shell_areas = append(shell_areas, area)
+		case area < -overlay_tolerance*overlay_tolerance:
+			holes = append(holes, r)
+		}
+	}
+
+	if len(shells) == 0 {
+		return nil
+	}
+
+	polygons := make(orb.MultiPolygon, len(shells))
+
+	for i, s := range shells {
+		polygons[i] = orb.Polygon{s}
+	}
+
+	// Shells are only indexed if there are holes to assign to them.
+
+	shell_idx := make([]*polygonIndex, len(shells))
+
+	for _, h := range holes {
+
+		// Test a point just to the left of the hole's first edge which, since holes run clockwise, is
+		// inside the polygon rather than inside the hole itself.
+
+		pt := leftOf(piece{h[0], h[1]})
+
+		owner := -1
+
+		for i, s := range shells {
+
+			if !s.Bound().Contains(pt) {
+				continue
+			}
+
+			if shell_idx[i] == nil {
+				shell_idx[i] = newPolygonIndex([]orb.Ring{s})
+			}
+
+			if !shell_idx[i].contains(pt) {
+				continue
+			}
+
+			if owner == -1 || shell_areas[i] < shell_areas[owner] {
+				owner = i
+			}
+		}
+
+		if owner != -1 {
+			polygons[owner] = append(polygons[owner], h)
+		}
+	}
+
+	if len(polygons) == 1 {
+		return polygons[0]
+	}
+
+	return polygons
+}
+
+// normalizeRings returns the rings of each polygon in 'mp' with consecutive duplicate points removed, closed and
+// oriented so that exterior rings are counter-clockwise and interior rings are clockwise. Rings with fewer than
+// three distinct points, or no area, are discarded along with the interior rings of any discarded exterior ring.
+func normalizeRings(mp orb.MultiPolygon) []orb.Ring {
+
+	rings := make([]orb.Ring, 0)
+
+	for _, p := range mp {
+
+		for i, r := range p {
+
+			pts := dedupePoints(r)
+
+			if len(pts) > 0 && !pts[0].Equal(pts[len(pts)-1]) {
+				pts = append(pts, pts[0])
+			}
+
+			ring := orb.Ring(pts)
+			area := 0.0
+
+			if len(ring) >= 4 {
+				area = signedArea(ring)
+			}
+
+			if area == 0 {
+
+				if i == 0 {
+					break
+				}
+
+				continue
+			}
+
+			if (i == 0 && area < 0) || (i > 0 && area > 0) {
+				ring = reverseRing(ring)
+			}
+
+			rings = append(rings, ring)
+		}
+	}
+
+	return rings
+}
+
+func dedupePoints(pts []orb.Point) []orb.Point {
+
+	out := make([]orb.Point, 0, len(pts))
+
+	for _, pt := range pts {
+
+		if len(out) > 0 && out[len(out)-1].Equal(pt) {
+			continue
+		}
+
+		out = append(out, pt)
+	}
+
+	return out
+}
+
+func reverseRing(r orb.Ring) orb.Ring {
+
+	out := make(orb.Ring, len(r))
+
+	for i, pt := range r {
+		out[len(r)-1-i] = pt
+	}
+
+	return out
+}
+
+// signedArea returns the planar area of 'r' which is positive if 'r' is counter-clockwise and negative otherwise.
+func signedArea(r orb.Ring) float64 {
+
+	area := 0.0
+
+	for i := 1; i < len(r); i++ {
+		area += r[i-1].X()*r[i].Y() - r[i].X()*r[i-1].Y()
+	}
+
+	return area / 2.0
+}
+
+func midpoint(a orb.Point, b orb.Point) orb.Point {
+	return orb.Point{(a.X() + b.X()) / 2.0, (a.Y() + b.Y()) / 2.0}
+}
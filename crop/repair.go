@@ -0,0 +1,489 @@
+package crop
+
+import (
+	"github.com/paulmach/orb"
+	"math"
+	"sort"
+)
+
+// repairPolygons returns the polygons in 'mp' with degenerate rings removed and any self-intersections, overlapping
+// edges or interior rings which cross their exterior ring resolved using the even-odd rule: a point is inside a polygon
+// if a line from it crosses the polygon's rings an odd number of times. Each polygon is repaired independently so
+// polygons which overlap one another are not merged. Polygons with no remaining area are discarded.
+func repairPolygons(mp orb.MultiPolygon) orb.MultiPolygon {
+
+	repaired := make(orb.MultiPolygon, 0)
+
+	for _, p := range mp {
+		repaired = append(repaired, repairPolygon(p)...)
+	}
+
+	return repaired
+}
+
+// repairPolygon returns the valid polygons, following the even-odd rule, described by the rings of 'p'. Polygons that
+// are already valid are returned as-is, other than having their rings oriented, since checking a polygon is much
+// cheaper than repairing it.
+func repairPolygon(p orb.Polygon) orb.MultiPolygon {
+
+	if isValidPolygon(p) {
+		return orb.MultiPolygon{orientPolygon(p)}
+	}
+
+	// Rings are cleaned but not reoriented since, under the even-odd rule, it is only the edges of a ring that
+	// matter. Self-intersecting rings can also have no (signed) area overall while still enclosing an area.
+
+	rings := make([]orb.Ring, 0)
+
+	for _, r := range p {
+
+		cleaned := cleanRing(r)
+
+		if cleaned != nil {
+			rings = append(rings, cleaned)
+		}
+	}
+
+	if len(rings) == 0 {
+		return nil
+	}
+
+	segs := ringSegments(rings)
+	nodeSegments(segs, segs)
+
+	pieces := segmentPieces(segs)
+
+	// Every vertex of a ring has one edge in and one edge out. Points with more than that are where rings
+	// cross or touch and are the only places where the interior can switch from one side of a ring to the other.
+
+	degree := make(map[orb.Point]int)
+
+	// Pieces which are traced more than once (overlapping edges) have the same parity on both sides when they
+	// are traced an even number of times and are not part of the repaired polygon.
+
+	count := make(map[piece]int)
+
+	for _, seg_pieces := range pieces {
+
+		for _, pc := range seg_pieces {
+
+			degree[pc[0]] += 1
+			degree[pc[1]] += 1
+
+			count[undirectedPiece(pc)] += 1
+		}
+	}
+
+	idx := newPolygonIndex(rings)
+
+	edges := make([]piece, 0)
+	seen := make(map[piece]bool)
+
+	left_inside := false
+	stale := true
+	path := -1
+
+	for i, seg := range segs {
+
+		if seg.path != path {
+			path = seg.path
+			stale = true
+		}
+
+		for _, pc := range pieces[i] {
+
+			key := undirectedPiece(pc)
+
+			if count[key] > 1 {
+
+				stale = true
+
+				if count[key]%2 == 0 || seen[key] {
+					continue
+				}
+
+				seen[key] = true
+
+				if idx.contains(leftOf(pc)) {
+					edges = append(edges, pc)
+				} else {
+					edges = append(edges, piece{pc[1], pc[0]})
+				}
+
+				continue
+			}
+
+			if stale || degree[pc[0]] > 2 {
+				left_inside = idx.contains(leftOf(pc))
+				stale = false
+			}
+
+			if left_inside {
+				edges = append(edges, pc)
+			} else {
+				edges = append(edges, piece{pc[1], pc[0]})
+			}
+		}
+	}
+
+	switch g := polygonsFromRings(assembleRings(edges)).(type) {
+	case orb.Polygon:
+		return orb.MultiPolygon{g}
+	case orb.MultiPolygon:
+		return g
+	default:
+		return nil
+	}
+}
+
+// cleanRing returns a copy of 'r' with consecutive duplicate points removed and closed, or nil if it has fewer than
+// three distinct points or all of its points are on the same line.
+func cleanRing(r orb.Ring) orb.Ring {
+
+	pts := dedupePoints(r)
+
+	if len(pts) > 0 && !pts[0].Equal(pts[len(pts)-1]) {
+		pts = append(pts, pts[0])
+	}
+
+	if len(pts) < 4 {
+		return nil
+	}
+
+	// Find the point furthest from the first point and test whether any other point is off the line between them.
+
+	a := pts[0]
+	far := a
+	max_d := 0.0
+
+	for _, pt := range pts {
+
+		d := math.Hypot(pt.X()-a.X(), pt.Y()-a.Y())
+
+		if d > max_d {
+			max_d = d
+			far = pt
+		}
+	}
+
+	for _, pt := range pts {
+
+		if side(a, far, pt) != 0 {
+			return orb.Ring(pts)
+		}
+	}
+
+	return nil
+}
+
+// undirectedPiece returns 'p' with its points in a consistent order so that the same edge traced in either direction
+// has the same key.
+func undirectedPiece(p piece) piece {
+
+	a := p[0]
+	b := p[1]
+
+	if b.X() < a.X() || (b.X() == a.X() && b.Y() < a.Y()) {
+		return piece{b, a}
+	}
+
+	return p
+}
+
+// leftOf returns a point just to the left of the midpoint of 'p'.
+func leftOf(p piece) orb.Point {
+
+	a := p[0]
+	b := p[1]
+
+	dx := b.X() - a.X()
+	dy := b.Y() - a.Y()
+
+	length := math.Sqrt(dx*dx + dy*dy)
+	offset := math.Max(length*1e-6, overlay_tolerance*10)
+
+	mid := midpoint(a, b)
+
+	return orb.Point{mid.X() - dy/length*offset, mid.Y() + dx/length*offset}
+}
+
+// isValidPolygon reports whether 'p' can be used without being repaired: each of its rings is closed, has no
+// consecutive duplicate points and encloses some area, no two edges touch or cross (other than consecutive edges of the
+// same ring at the vertex they share) and each interior ring is inside the exterior ring and outside all the others.
+func isValidPolygon(p orb.Polygon) bool {
+
+	if len(p) == 0 {
+		return false
+	}
+
+	for _, r := range p {
+
+		if len(r) < 4 || !r[0].Equal(r[len(r)-1]) {
+			return false
+		}
+
+		for i := 1; i < len(r); i++ {
+
+			if r[i].Equal(r[i-1]) {
+				return false
+			}
+		}
+
+		if math.Abs(signedArea(r)) <= overlay_tolerance*overlay_tolerance {
+			return false
+		}
+	}
+
+	seg_count := 0
+
+	for _, r := range p {
+		seg_count += len(r) - 1
+	}
+
+	segs := make([]segment, 0, seg_count)
+
+	for i, r := range p {
+
+		for j := 1; j < len(r); j++ {
+			segs = append(segs, segment{a: r[j-1], b: r[j], path: i})
+		}
+	}
+
+	// The first and last segment of each ring are also consecutive.
+
+	first := make([]int, len(p))
+	last := make([]int, len(p))
+
+	for i, s := range segs {
+
+		if i == 0 || segs[i-1].path != s.path {
+			first[s.path] = i
+		}
+
+		last[s.path] = i
+	}
+
+	consecutive := func(i int, j int) bool {
+
+		if i > j {
+			i, j = j, i
+		}
+
+		if segs[i].path != segs[j].path {
+			return false
+		}
+
+		path := segs[i].path
+
+		return j == i+1 || (i == first[path] && j == last[path])
+	}
+
+	// Segments are bucketed in to horizontal rows and then, within each row, a vertical line is swept across them
+	// from left to right so that only segments whose bounding boxes overlap are compared.
+
+	bounds := make([]orb.Bound, len(segs))
+	extent := orb.Bound{Min: segs[0].a, Max: segs[0].a}
+
+	for i, s := range segs {
+		bounds[i] = orb.Bound{Min: s.a, Max: s.a}.Extend(s.b)
+		extent = extent.Union(bounds[i])
+	}
+
+	row_count := int(math.Sqrt(float64(len(segs)))) + 1
+
+	if row_count > max_index_cells {
+		row_count = max_index_cells
+	}
+
+	height := (extent.Max.Y() - extent.Min.Y()) / float64(row_count)
+
+	row := func(y float64) int {
+
+		if height <= 0 {
+			return 0
+		}
+
+		r := int((y - extent.Min.Y()) / height)
+
+		if r < 0 {
+			return 0
+		}
+
+		if r >= row_count {
+			return row_count - 1
+		}
+
+		return r
+	}
+
+	rows := make([][]int, row_count)
+	first_row := make([]int, len(segs))
+
+	for i, b := range bounds {
+
+		first_row[i] = row(b.Min.Y())
+
+		for r := first_row[i]; r <= row(b.Max.Y()); r++ {
+			rows[r] = append(rows[r], i)
+		}
+	}
+
+	active := make([]int, 0)
+
+	for r, row_segs := range rows {
+
+		sort.Slice(row_segs, func(i, j int) bool {
+			return bounds[row_segs[i]].Min.X() < bounds[row_segs[j]].Min.X()
+		})
+
+		active = active[:0]
+
+		for _, i := range row_segs {
+
+			b := bounds[i]
+			still_active := active[:0]
+
+			for _, j := range active {
+
+				if bounds[j].Max.X() < b.Min.X() {
+					continue
+				}
+
+				still_active = append(still_active, j)
+
+				if bounds[j].Max.Y() < b.Min.Y() || bounds[j].Min.Y() > b.Max.Y() {
+					continue
+				}
+
+				// Segments that share more than one row are only compared in the first of them.
+
+				shared_row := first_row[i]
+
+				if first_row[j] > shared_row {
+					shared_row = first_row[j]
+				}
+
+				if r != shared_row {
+					continue
+				}
+
+				s := segs[i]
+				o := segs[j]
+
+				// Consecutive edges always share a vertex and can only meet anywhere else if one doubles
+				// back over the other.
+
+				if consecutive(i, j) {
+
+					if overlapsEndpoint(s, o) || overlapsEndpoint(o, s) {
+						return false
+					}
+
+					continue
+				}
+
+				if len(segmentIntersections(s.a, s.b, o.a, o.b)) > 0 {
+					return false
+				}
+			}
+
+			active = append(still_active, i)
+		}
+	}
+
+	if len(p) == 1 {
+		return true
+	}
+
+	// Since no rings touch each other every vertex of an interior ring is either inside or outside of every
+	// other ring so it is enough to test a single vertex.
+
+	shell := newPolygonIndex([]orb.Ring{p[0]})
+
+	for _, h := range p[1:] {
+
+		if !shell.contains(h[0]) {
+			return false
+		}
+	}
+
+	holes := []orb.Ring(p[1:])
+	hole_bounds := make([]orb.Bound, len(holes))
+	hole_order := make([]int, len(holes))
+
+	for i, h := range holes {
+		hole_bounds[i] = h.Bound()
+		hole_order[i] = i
+	}
+
+	sort.Slice(hole_order, func(i, j int) bool {
+		return hole_bounds[hole_order[i]].Min.X() < hole_bounds[hole_order[j]].Min.X()
+	})
+
+	hole_idx := make([]*polygonIndex, len(holes))
+
+	contains := func(i int, pt orb.Point) bool {
+
+		if !hole_bounds[i].Contains(pt) {
+			return false
+		}
+
+		if hole_idx[i] == nil {
+			hole_idx[i] = newPolygonIndex([]orb.Ring{holes[i]})
+		}
+
+		return hole_idx[i].contains(pt)
+	}
+
+	for n, i := range hole_order {
+
+		for _, j := range hole_order[n+1:] {
+
+			if hole_bounds[j].Min.X() > hole_bounds[i].Max.X() {
+				break
+			}
+
+			if contains(i, holes[j][0]) || contains(j, holes[i][0]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// overlapsEndpoint returns true if either endpoint of 's', other than an endpoint it shares with 'o', is on 'o'.
+func overlapsEndpoint(s segment, o segment) bool {
+
+	for _, pt := range [2]orb.Point{s.a, s.b} {
+
+		if pt.Equal(o.a) || pt.Equal(o.b) {
+			continue
+		}
+
+		if side(o.a, o.b, pt) == 0 && within(o.a, o.b, pt) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// orientPolygon returns 'p' with its exterior ring oriented counter-clockwise and its interior rings clockwise.
+func orientPolygon(p orb.Polygon) orb.Polygon {
+
+	oriented := make(orb.Polygon, len(p))
+
+	for i, r := range p {
+
+		area := signedArea(r)
+
+		if (i == 0 && area < 0) || (i > 0 && area > 0) {
+			r = reverseRing(r)
+		}
+
+		oriented[i] = r
+	}
+
+	return oriented
+}
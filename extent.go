@@ -8,7 +8,8 @@ import (
 
 // Extent4326 returns a EPSG4326 extent for 't'. This is a utility method
 // because I can't figure out how to do this using the available methods in
-// go-spatial/geom package.
+// go-spatial/geom package. Note that 't' is assumed to be a web mercator
+// (EPSG:3857) tile; use the TileBound method for other grids.
 func Extent4326(t *slippy.Tile) *geom.Extent {
 
 	return geom.NewExtent(
@@ -3,10 +3,13 @@ module github.com/sfomuseum/go-whosonfirst-tiles
 go 1.16
 
 require (
+	github.com/aaronland/go-roster v0.0.2
 	github.com/go-spatial/geom v0.0.0-20210728181007-c040fef66f77
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/paulmach/orb v0.2.2
 	github.com/tidwall/sjson v1.1.7
 	github.com/whosonfirst/go-geojson-svg v0.0.4
 	github.com/whosonfirst/go-whosonfirst-iterate v1.2.0
 	gocloud.dev v0.23.0
+	google.golang.org/protobuf v1.26.0
 )
@@ -0,0 +1,175 @@
+package tiles
+
+import (
+	"fmt"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/project"
+)
+
+// The SRID for the spherical (web) mercator projection.
+const SRID_WEB_MERCATOR uint = 3857
+
+// The SRID for geographic (longitude, latitude) coordinates.
+const SRID_GEOGRAPHIC uint = 4326
+
+// The default size, in pixels, of a rendered tile used to measure buffers around tiles.
+const DEFAULT_TILE_SIZE uint = 256
+
+// NewGrid returns a new slippy.Grid instance for 'srid'. Valid options are 3857 (web mercator tiles where zoom
+// level 0 is a single tile) and 4326 (geographic tiles where zoom level 0 is two tiles side by side). For other
+// grids see the TileMatrixSet type.
+func NewGrid(srid uint) (slippy.Grid, error) {
+
+	switch srid {
+	case SRID_WEB_MERCATOR, SRID_GEOGRAPHIC:
+		return slippy.NewGrid(srid)
+	default:
+		return nil, fmt.Errorf("Unsupported SRID '%d'", srid)
+	}
+}
+
+// IsWebMercator returns a boolean value indicating whether 'g' is a web mercator (EPSG:3857) grid, following the
+// same tiling scheme as the paulmach/orb/maptile package. A nil grid is considered to be web mercator since that is
+// what the paulmach/orb/maptile package assumes. ProjectedGrid instances (for example a TileMatrixSet) are never
+// considered to be web mercator grids, even if their coordinate reference system is EPSG:3857, since they may define
+// their own tile matrices.
+func IsWebMercator(g slippy.Grid) bool {
+
+	if g == nil {
+		return true
+	}
+
+	_, ok := g.(ProjectedGrid)
+
+	if ok {
+		return false
+	}
+
+	return g.SRID() == SRID_WEB_MERCATOR
+}
+
+// ToNativeProjection returns an orb.Projection for converting geographic (EPSG:4326) coordinates in to the native
+// coordinates of 'g'.
+func ToNativeProjection(g slippy.Grid) (orb.Projection, error) {
+
+	if pg, ok := g.(ProjectedGrid); ok {
+		return pg.ToNativeProjection(), nil
+	}
+
+	if IsWebMercator(g) {
+		return project.WGS84.ToMercator, nil
+	}
+
+	switch g.SRID() {
+	case SRID_GEOGRAPHIC:
+		return identityProjection, nil
+	default:
+		return nil, fmt.Errorf("Unsupported SRID '%d'", g.SRID())
+	}
+}
+
+// FromNativeProjection returns an orb.Projection for converting the native coordinates of 'g' in to geographic
+// (EPSG:4326) coordinates.
+func FromNativeProjection(g slippy.Grid) (orb.Projection, error) {
+
+	if pg, ok := g.(ProjectedGrid); ok {
+		return pg.FromNativeProjection(), nil
+	}
+
+	if IsWebMercator(g) {
+		return project.Mercator.ToWGS84, nil
+	}
+
+	switch g.SRID() {
+	case SRID_GEOGRAPHIC:
+		return identityProjection, nil
+	default:
+		return nil, fmt.Errorf("Unsupported SRID '%d'", g.SRID())
+	}
+}
+
+// TileExtent returns the extent of 't', in the native coordinates of 'g'.
+func TileExtent(g slippy.Grid, t maptile.Tile) (orb.Bound, error) {
+
+	if IsWebMercator(g) {
+		return project.Bound(t.Bound(), project.WGS84.ToMercator), nil
+	}
+
+	ext, ok := slippy.Extent(g, slippy.NewTile(uint(t.Z), uint(t.X), uint(t.Y)))
+
+	if !ok {
+		return orb.Bound{}, fmt.Errorf("Tile %d/%d/%d is not valid for grid", t.Z, t.X, t.Y)
+	}
+
+	b := orb.Bound{
+		Min: orb.Point{ext.MinX(), ext.MinY()},
+		Max: orb.Point{ext.MaxX(), ext.MaxY()},
+	}
+
+	return b, nil
+}
+
+// TileBound returns the geographic (EPSG:4326) bounds of 't' in 'g'. For web mercator grids this is the same as
+// calling t.Bound(). For other grids this is the bounding box of the tile's four (projected) corners.
+func TileBound(g slippy.Grid, t maptile.Tile) (orb.Bound, error) {
+
+	if IsWebMercator(g) {
+		return t.Bound(), nil
+	}
+
+	return BufferedTileBound(g, t, 0, 0)
+}
+
+// BufferedTileBound returns the geographic (EPSG:4326) bounds of 't' in 'g' once its extent has been expanded by 'dx'
+// and 'dy', in the native coordinates of 'g', on each side. This is the bounding box of the expanded extent's four
+// (projected) corners.
+func BufferedTileBound(g slippy.Grid, t maptile.Tile, dx float64, dy float64) (orb.Bound, error) {
+
+	ext, err := TileExtent(g, t)
+
+	if err != nil {
+		return orb.Bound{}, err
+	}
+
+	ext = orb.Bound{
+		Min: orb.Point{ext.Min.X() - dx, ext.Min.Y() - dy},
+		Max: orb.Point{ext.Max.X() + dx, ext.Max.Y() + dy},
+	}
+
+	proj, err := FromNativeProjection(g)
+
+	if err != nil {
+		return orb.Bound{}, err
+	}
+
+	b := orb.Bound{Min: proj(ext.Min), Max: proj(ext.Min)}
+
+	for _, pt := range []orb.Point{ext.Max, {ext.Min.X(), ext.Max.Y()}, {ext.Max.X(), ext.Min.Y()}} {
+		b = b.Extend(proj(pt))
+	}
+
+	return b, nil
+}
+
+// GridSize returns the number of columns and rows in 'g' at zoom level 'z'.
+func GridSize(g slippy.Grid, z maptile.Zoom) (uint32, uint32, error) {
+
+	if IsWebMercator(g) {
+		n := uint32(1) << uint32(z)
+		return n, n, nil
+	}
+
+	sz, ok := g.Size(uint(z))
+
+	if !ok {
+		return 0, 0, fmt.Errorf("Zoom level %d is not valid for grid", z)
+	}
+
+	return uint32(sz.X), uint32(sz.Y), nil
+}
+
+func identityProjection(pt orb.Point) orb.Point {
+	return pt
+}
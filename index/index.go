@@ -0,0 +1,433 @@
+// package index provides an in-memory spatial index of Who's On First features for finding the records that
+// intersect a given bounding box or map tile.
+package index
+
+import (
+	"context"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+	"github.com/whosonfirst/go-whosonfirst-iterate/iterator"
+	"io"
+	"sync"
+)
+
+// The maximum depth of the index's quadtree.
+const MAX_DEPTH int = 20
+
+var world = orb.Bound{Min: orb.Point{-180.0, -90.0}, Max: orb.Point{180.0, 90.0}}
+
+// Index is an in-memory spatial index of geojson.Feature instances, keyed by their "wof:id" property. Features are
+// stored in a (loose) quadtree where each feature is assigned to the smallest quadrant that completely contains its
+// bounding box. Features that extend beyond the bounds of the world are assigned to the root of the tree. Index
+// instances are safe for concurrent use.
+type Index struct {
+	root     *quadNode
+	features map[int64]*indexItem
+	mu       *sync.RWMutex
+}
+
+type indexItem struct {
+	id      int64
+	bound   orb.Bound
+	bounds  []orb.Bound
+	feature *geojson.Feature
+	node    *quadNode
+}
+
+type quadNode struct {
+	bound    orb.Bound
+	depth    int
+	parent   *quadNode
+	items    map[int64]*indexItem
+	children [4]*quadNode
+}
+
+// NewIndex returns a new, empty, Index instance.
+func NewIndex(ctx context.Context) (*Index, error) {
+
+	idx := &Index{
+		root:     newQuadNode(world, nil),
+		features: make(map[int64]*indexItem),
+		mu:       new(sync.RWMutex),
+	}
+
+	return idx, nil
+}
+
+// NewIndexWithIterator returns a new Index instance populated with the records emitted by the
+// whosonfirst/go-whosonfirst-iterate/emitter URI 'iter_uri' for 'uris'.
+func NewIndexWithIterator(ctx context.Context, iter_uri string, uris ...string) (*Index, error) {
+
+	idx, err := NewIndex(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = idx.IndexURIs(ctx, iter_uri, uris...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+// IndexURIs adds (or replaces) the records emitted by the whosonfirst/go-whosonfirst-iterate/emitter URI 'iter_uri'
+// for 'uris'. If the same wof:id is emitted more than once (for example alternate geometries) the last record
+// processed wins so you may want to use the iterator's "?_exclude=" parameter to skip them.
+func (idx *Index) IndexURIs(ctx context.Context, iter_uri string, uris ...string) error {
+
+	iter_cb := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
+
+		body, err := io.ReadAll(fh)
+
+		if err != nil {
+			return fmt.Errorf("Failed to read record, %w", err)
+		}
+
+		f, err := geojson.UnmarshalFeature(body)
+
+		if err != nil {
+			return fmt.Errorf("Failed to unmarshal record, %w", err)
+		}
+
+		return idx.Replace(ctx, f)
+	}
+
+	iter, err := iterator.NewIterator(ctx, iter_uri, iter_cb)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create new iterator, %w", err)
+	}
+
+	err = iter.IterateURIs(ctx, uris...)
+
+	if err != nil {
+		return fmt.Errorf("Failed to iterate URIs, %w", err)
+	}
+
+	return nil
+}
+
+// Add adds 'f' to the index. It is an error to add a feature whose wof:id is already present in the index.
+func (idx *Index) Add(ctx context.Context, f *geojson.Feature) error {
+
+	item, err := newIndexItem(f)
+
+	if err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	_, exists := idx.features[item.id]
+
+	if exists {
+		return fmt.Errorf("Feature %d already exists", item.id)
+	}
+
+	idx.insert(item)
+	return nil
+}
+
+// Replace adds 'f' to the index replacing any existing feature with the same wof:id. If 'f' is invalid an error is
+// returned and the existing feature is left in place.
+func (idx *Index) Replace(ctx context.Context, f *geojson.Feature) error {
+
+	item, err := newIndexItem(f)
+
+	if err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(item.id)
+	idx.insert(item)
+	return nil
+}
+
+// Remove removes the feature with wof:id 'id' from the index. It is not an error to remove a feature that is not
+// present in the index.
+func (idx *Index) Remove(ctx context.Context, id int64) error {
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+	return nil
+}
+
+// Get returns the feature with wof:id 'id' and a boolean flag indicating whether it is present in the index.
+func (idx *Index) Get(ctx context.Context, id int64) (*geojson.Feature, bool) {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	item, ok := idx.features[id]
+
+	if !ok {
+		return nil, false
+	}
+
+	return item.feature, true
+}
+
+// Count returns the number of features in the index.
+func (idx *Index) Count() int {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.features)
+}
+
+// Intersects returns the features whose bounding boxes intersect 'b'. The features returned are the same instances
+// stored in the index and should be treated as read-only.
+func (idx *Index) Intersects(ctx context.Context, b orb.Bound) ([]*geojson.Feature, error) {
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	features := make([]*geojson.Feature, 0)
+
+	var walk func(*quadNode) error
+
+	walk = func(n *quadNode) error {
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// pass
+		}
+
+		for _, item := range n.items {
+
+			if item.intersects(b) {
+				features = append(features, item.feature)
+			}
+		}
+
+		for _, c := range n.children {
+
+			if c == nil || !c.bound.Intersects(b) {
+				continue
+			}
+
+			err := walk(c)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	err := walk(idx.root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return features, nil
+}
+
+// IntersectsTile returns the features whose bounding boxes intersect 't'.
+func (idx *Index) IntersectsTile(ctx context.Context, t maptile.Tile) ([]*geojson.Feature, error) {
+	return idx.Intersects(ctx, t.Bound())
+}
+
+// newIndexItem returns a new indexItem for 'f', deriving its wof:id and bounding boxes. It returns an error if 'f'
+// can not be indexed.
+func newIndexItem(f *geojson.Feature) (*indexItem, error) {
+
+	id, err := featureId(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Geometry == nil {
+		return nil, fmt.Errorf("Feature %d is missing geometry", id)
+	}
+
+	b := f.Geometry.Bound()
+
+	// Features that cross the antimeridian have a bounding box on either side of it, rather than one
+	// spanning (almost) the entire world, which are used to test for intersections. The feature is still
+	// stored in the node that contains its (larger) bounding box.
+
+	bounds := tiles.AntimeridianBounds(f.Geometry)
+
+	for _, ab := range bounds {
+		b = b.Union(ab)
+	}
+
+	item := &indexItem{
+		id:      id,
+		bound:   b,
+		bounds:  bounds,
+		feature: f,
+	}
+
+	return item, nil
+}
+
+// insert adds 'item' to the index. The caller is expected to hold a write lock.
+func (idx *Index) insert(item *indexItem) {
+
+	n := idx.root
+
+	for n.depth < MAX_DEPTH {
+
+		c := n.child(item.bound)
+
+		if c == nil {
+			break
+		}
+
+		n = c
+	}
+
+	item.node = n
+	n.items[item.id] = item
+
+	idx.features[item.id] = item
+}
+
+// remove removes the feature with wof:id 'id' from the index. The caller is expected to hold a write lock.
+func (idx *Index) remove(id int64) {
+
+	item, ok := idx.features[id]
+
+	if !ok {
+		return
+	}
+
+	delete(item.node.items, id)
+	delete(idx.features, id)
+
+	item.node.prune()
+}
+
+// intersects returns true if any of the bounding boxes for 'item' intersect 'b'.
+func (item *indexItem) intersects(b orb.Bound) bool {
+
+	for _, ib := range item.bounds {
+
+		if ib.Intersects(b) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newQuadNode returns a new quadNode for 'b' whose parent is 'parent' (or nil for the root of the tree).
+func newQuadNode(b orb.Bound, parent *quadNode) *quadNode {
+
+	depth := 0
+
+	if parent != nil {
+		depth = parent.depth + 1
+	}
+
+	n := &quadNode{
+		bound:  b,
+		depth:  depth,
+		parent: parent,
+		items:  make(map[int64]*indexItem),
+	}
+
+	return n
+}
+
+// prune detaches 'n', and then any of its ancestors, from the tree for as long as they have no items or children.
+// The root of the tree is never pruned.
+func (n *quadNode) prune() {
+
+	for n.parent != nil && n.empty() {
+
+		p := n.parent
+
+		for i, c := range p.children {
+
+			if c == n {
+				p.children[i] = nil
+			}
+		}
+
+		n = p
+	}
+}
+
+// empty returns true if 'n' has no items or children.
+func (n *quadNode) empty() bool {
+
+	if len(n.items) > 0 {
+		return false
+	}
+
+	for _, c := range n.children {
+
+		if c != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// child returns the child of 'n' that completely contains 'b', creating it if necessary, or nil if no child does.
+func (n *quadNode) child(b orb.Bound) *quadNode {
+
+	c := n.bound.Center()
+
+	quadrants := [4]orb.Bound{
+		{Min: orb.Point{n.bound.Min.X(), c.Y()}, Max: orb.Point{c.X(), n.bound.Max.Y()}},
+		{Min: c, Max: n.bound.Max},
+		{Min: n.bound.Min, Max: c},
+		{Min: orb.Point{c.X(), n.bound.Min.Y()}, Max: orb.Point{n.bound.Max.X(), c.Y()}},
+	}
+
+	for i, q := range quadrants {
+
+		if !q.Contains(b.Min) || !q.Contains(b.Max) {
+			continue
+		}
+
+		if n.children[i] == nil {
+			n.children[i] = newQuadNode(q, n)
+		}
+
+		return n.children[i]
+	}
+
+	return nil
+}
+
+// featureId returns the value of the "wof:id" property for 'f'.
+func featureId(f *geojson.Feature) (int64, error) {
+
+	id_raw, exists := f.Properties["wof:id"]
+
+	if !exists {
+		return 0, fmt.Errorf("Missing wof:id property")
+	}
+
+	id, ok := id_raw.(float64)
+
+	if !ok {
+		return 0, fmt.Errorf("Invalid wof:id property")
+	}
+
+	return int64(id), nil
+}
@@ -0,0 +1,137 @@
+package index
+
+import (
+	"context"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"testing"
+)
+
+// newFeature returns a new geojson.Feature, with wof:id 'id', for 'geom'.
+func newFeature(id int64, geom orb.Geometry) *geojson.Feature {
+
+	f := geojson.NewFeature(geom)
+	f.Properties["wof:id"] = float64(id)
+
+	return f
+}
+
+func TestReplace(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx, err := NewIndex(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to create index, %v", err)
+	}
+
+	err = idx.Add(ctx, newFeature(1, orb.Point{-122.4, 37.8}))
+
+	if err != nil {
+		t.Fatalf("Failed to add feature, %v", err)
+	}
+
+	tests := []struct {
+		Name    string
+		Feature *geojson.Feature
+	}{
+		{Name: "missing geometry", Feature: newFeature(1, nil)},
+		{Name: "missing id", Feature: geojson.NewFeature(orb.Point{0, 0})},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			err := idx.Replace(ctx, test.Feature)
+
+			if err == nil {
+				t.Fatalf("Expected replace to fail")
+			}
+
+			f, ok := idx.Get(ctx, 1)
+
+			if !ok {
+				t.Fatalf("Expected existing feature to be left in place")
+			}
+
+			if !orb.Equal(f.Geometry, orb.Point{-122.4, 37.8}) {
+				t.Fatalf("Expected existing feature to be unchanged, got %v", f.Geometry)
+			}
+
+			features, err := idx.Intersects(ctx, orb.Bound{Min: orb.Point{-123, 37}, Max: orb.Point{-122, 38}})
+
+			if err != nil {
+				t.Fatalf("Failed to query index, %v", err)
+			}
+
+			if len(features) != 1 {
+				t.Fatalf("Expected existing feature to be found in the index, got %d features", len(features))
+			}
+		})
+	}
+
+	err = idx.Replace(ctx, newFeature(1, orb.Point{2.35, 48.85}))
+
+	if err != nil {
+		t.Fatalf("Failed to replace feature, %v", err)
+	}
+
+	features, err := idx.Intersects(ctx, orb.Bound{Min: orb.Point{-123, 37}, Max: orb.Point{-122, 38}})
+
+	if err != nil {
+		t.Fatalf("Failed to query index, %v", err)
+	}
+
+	if len(features) != 0 {
+		t.Fatalf("Expected replaced feature to be removed from its old location")
+	}
+
+	if idx.Count() != 1 {
+		t.Fatalf("Expected 1 feature, got %d", idx.Count())
+	}
+}
+
+func TestRemovePrunesNodes(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx, err := NewIndex(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to create index, %v", err)
+	}
+
+	err = idx.Add(ctx, newFeature(1, orb.Point{-122.4, 37.8}))
+
+	if err != nil {
+		t.Fatalf("Failed to add feature, %v", err)
+	}
+
+	err = idx.Add(ctx, newFeature(2, orb.Point{-122.41, 37.81}))
+
+	if err != nil {
+		t.Fatalf("Failed to add feature, %v", err)
+	}
+
+	err = idx.Remove(ctx, 1)
+
+	if err != nil {
+		t.Fatalf("Failed to remove feature, %v", err)
+	}
+
+	if idx.root.empty() {
+		t.Fatalf("Expected nodes for the remaining feature to be kept")
+	}
+
+	err = idx.Remove(ctx, 2)
+
+	if err != nil {
+		t.Fatalf("Failed to remove feature, %v", err)
+	}
+
+	if !idx.root.empty() {
+		t.Fatalf("Expected empty nodes to be pruned")
+	}
+}
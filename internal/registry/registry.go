@@ -0,0 +1,109 @@
+// package registry provides a common registry, keyed by URI scheme, for the initialization functions of pluggable
+// interfaces like renderers and writers.
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/aaronland/go-roster"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry is a lookup table of initialization functions keyed by URI scheme. Registry instances are safe for
+// concurrent use.
+type Registry struct {
+	roster roster.Roster
+	mu     *sync.Mutex
+}
+
+// NewRegistry returns a new, empty, Registry instance.
+func NewRegistry() *Registry {
+
+	r := &Registry{
+		mu: new(sync.Mutex),
+	}
+
+	return r
+}
+
+// Register registers 'scheme' as a key pointing to 'f'.
+func (r *Registry) Register(ctx context.Context, scheme string, f interface{}) error {
+
+	ro, err := r.ensureRoster()
+
+	if err != nil {
+		return err
+	}
+
+	return ro.Register(ctx, scheme, f)
+}
+
+// Schemes returns the sorted list of schemes, formatted as "{SCHEME}://", that have been registered.
+func (r *Registry) Schemes() []string {
+
+	ctx := context.Background()
+	schemes := []string{}
+
+	ro, err := r.ensureRoster()
+
+	if err != nil {
+		return schemes
+	}
+
+	for _, dr := range ro.Drivers(ctx) {
+		scheme := fmt.Sprintf("%s://", strings.ToLower(dr))
+		schemes = append(schemes, scheme)
+	}
+
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Lookup returns the initialization function registered for the scheme of 'uri' and a boolean flag indicating
+// whether one was found.
+func (r *Registry) Lookup(ctx context.Context, uri string) (interface{}, bool, error) {
+
+	ro, err := r.ensureRoster()
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	// The default roster only returns an error if the scheme has not been registered.
+
+	i, err := ro.Driver(ctx, u.Scheme)
+
+	if err != nil {
+		return nil, false, nil
+	}
+
+	return i, true, nil
+}
+
+func (r *Registry) ensureRoster() (roster.Roster, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.roster == nil {
+
+		ro, err := roster.NewDefaultRoster()
+
+		if err != nil {
+			return nil, err
+		}
+
+		r.roster = ro
+	}
+
+	return r.roster, nil
+}
@@ -0,0 +1,103 @@
+// package sqlite provides common methods for writing rows to SQLite databases in batched transactions.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// OpenDatabase opens the SQLite database at 'path', using the database/sql driver 'driver', and creates 'schema'.
+func OpenDatabase(ctx context.Context, driver string, path string, schema string) (*sql.DB, error) {
+
+	db, err := sql.Open(driver, path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open database, %w", err)
+	}
+
+	// SQLite does not support concurrent writers so there is no point in having more than one connection.
+
+	db.SetMaxOpenConns(1)
+
+	_, err = db.ExecContext(ctx, schema)
+
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to create schema, %w", err)
+	}
+
+	return db, nil
+}
+
+// Batch executes statements against a database in transactions of up to a fixed number of statements. Batch
+// instances are not safe for concurrent use.
+type Batch struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	size    int
+	pending int
+}
+
+// NewBatch returns a new Batch instance for 'db' that commits a transaction every 'size' statements.
+func NewBatch(db *sql.DB, size int) *Batch {
+
+	b := &Batch{
+		db:   db,
+		size: size,
+	}
+
+	return b
+}
+
+// Exec executes 'query', with 'args', in the current transaction, beginning a new one if necessary, and commits the
+// transaction once it contains the maximum number of statements.
+func (b *Batch) Exec(ctx context.Context, query string, args ...interface{}) error {
+
+	if b.tx == nil {
+
+		// Transactions span multiple calls to Exec so they are not bound to the (per-statement) context
+		// passed to this method which may be cancelled before the transaction is committed.
+
+		tx, err := b.db.BeginTx(context.Background(), nil)
+
+		if err != nil {
+			return fmt.Errorf("Failed to begin transaction, %w", err)
+		}
+
+		b.tx = tx
+	}
+
+	_, err := b.tx.ExecContext(ctx, query, args...)
+
+	if err != nil {
+		return err
+	}
+
+	b.pending += 1
+
+	if b.pending >= b.size {
+		return b.Commit()
+	}
+
+	return nil
+}
+
+// Commit commits the current transaction, if there is one.
+func (b *Batch) Commit() error {
+
+	if b.tx == nil {
+		return nil
+	}
+
+	err := b.tx.Commit()
+
+	b.tx = nil
+	b.pending = 0
+
+	if err != nil {
+		return fmt.Errorf("Failed to commit transaction, %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+// package wof provides common methods for reading properties of Who's On First records.
+package wof
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Placetype returns the value of the "wof:placetype" property of the Who's On First record defined by 'body' or an
+// empty string if it is not present.
+func Placetype(body []byte) (string, error) {
+
+	var f struct {
+		Properties struct {
+			Placetype string `json:"wof:placetype"`
+		} `json:"properties"`
+	}
+
+	err := json.Unmarshal(body, &f)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal feature, %w", err)
+	}
+
+	return f.Properties.Placetype, nil
+}
@@ -0,0 +1,97 @@
+package list
+
+import (
+	"context"
+	"fmt"
+	"gocloud.dev/blob"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// blobOutput implements the io.WriteCloser interface for writing to a single object in a gocloud.dev/blob bucket.
+type blobOutput struct {
+	bucket *blob.Bucket
+	wr     *blob.Writer
+}
+
+// NewBlobOutput returns a new io.WriteCloser instance for writing to the object defined by 'uri', which is expected
+// to be a valid gocloud.dev/blob bucket URI whose path is the key of the object to write. For example:
+//
+//	file:///usr/local/data/tiles.csv
+//	s3://{BUCKET}/tiles.csv?region={REGION}
+//
+// For file:// URIs the bucket is the parent directory of the path. For all other URIs the bucket is the host. The
+// relevant gocloud.dev/blob driver (for example gocloud.dev/blob/fileblob) needs to have been imported. Closing the
+// io.WriteCloser will also close the bucket.
+func NewBlobOutput(ctx context.Context, uri string, content_type string) (io.WriteCloser, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	var bucket_path string
+	var key string
+
+	if u.Scheme == "file" {
+		bucket_path = filepath.Dir(u.Path)
+		key = filepath.Base(u.Path)
+	} else {
+		key = strings.TrimLeft(u.Path, "/")
+	}
+
+	if key == "" || key == "." || key == "/" {
+		return nil, fmt.Errorf("Missing key for '%s'", uri)
+	}
+
+	bucket_uri := fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, bucket_path)
+
+	if u.RawQuery != "" {
+		bucket_uri = fmt.Sprintf("%s?%s", bucket_uri, u.RawQuery)
+	}
+
+	bucket, err := blob.OpenBucket(ctx, bucket_uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open bucket, %w", err)
+	}
+
+	wr_opts := &blob.WriterOptions{
+		ContentType: content_type,
+	}
+
+	wr, err := bucket.NewWriter(ctx, key, wr_opts)
+
+	if err != nil {
+		bucket.Close()
+		return nil, fmt.Errorf("Failed to create new writer for '%s', %w", key, err)
+	}
+
+	o := &blobOutput{
+		bucket: bucket,
+		wr:     wr,
+	}
+
+	return o, nil
+}
+
+// Write writes 'p' to the underlying blob.
+func (o *blobOutput) Write(p []byte) (int, error) {
+	return o.wr.Write(p)
+}
+
+// Close closes the underlying blob and its bucket.
+func (o *blobOutput) Close() error {
+
+	err := o.wr.Close()
+
+	if err != nil {
+		o.bucket.Close()
+		return fmt.Errorf("Failed to close writer, %w", err)
+	}
+
+	return o.bucket.Close()
+}
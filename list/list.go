@@ -0,0 +1,479 @@
+// package list provides methods for writing tile coverage information for Who's On First records in a variety of formats.
+package list
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+	"github.com/sfomuseum/go-whosonfirst-tiles/coverage"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Format defines the encoding used to write tile coverage information.
+type Format string
+
+// CSV_FORMAT signals that coverage information should be written as CSV rows.
+const CSV_FORMAT Format = "csv"
+
+// NDJSON_FORMAT signals that coverage information should be written as newline-delimited JSON objects.
+const NDJSON_FORMAT Format = "ndjson"
+
+// GEOJSON_FORMAT signals that coverage information should be written as a GeoJSON FeatureCollection where each
+// feature is the (EPSG:4326) polygon of a tile, or range of tiles.
+const GEOJSON_FORMAT Format = "geojson"
+
+// QUADKEY_FORMAT signals that coverage information should be written as CSV rows where each tile is encoded as a
+// (Bing Maps) quadkey. Quadkeys are only defined for the web mercator (EPSG:3857) grid and can not be used to encode
+// tile ranges.
+const QUADKEY_FORMAT Format = "quadkey"
+
+// ContentType returns the content (mime) type for coverage information encoded as 'f'.
+func (f Format) ContentType() string {
+
+	switch f {
+	case NDJSON_FORMAT:
+		return "application/x-ndjson"
+	case GEOJSON_FORMAT:
+		return "application/geo+json"
+	default:
+		return "text/csv"
+	}
+}
+
+// WriterOptions defines configuration options for a Writer instance.
+type WriterOptions struct {
+	// The Format used to encode coverage information. If empty then CSV_FORMAT is assumed.
+	Format Format
+	// If true then a header row is written before the first row of CSV_FORMAT or QUADKEY_FORMAT output.
+	Header bool
+	// The grid that tiles are addressed in. This is used to derive the polygons for GEOJSON_FORMAT output. If nil
+	// a web mercator (EPSG:3857) grid is assumed.
+	Grid slippy.Grid
+}
+
+// Writer writes tile coverage information to an io.Writer instance. It is safe to use a Writer concurrently.
+type Writer struct {
+	wr       io.Writer
+	csv_wr   *csv.Writer
+	format   Format
+	header   bool
+	grid     slippy.Grid
+	mu       *sync.Mutex
+	count    int64
+	from_prj orb.Projection
+}
+
+// record is a single row of coverage information, as ordered keys and values, along with the tile (or range of
+// tiles) it describes.
+type record struct {
+	keys   []string
+	values []interface{}
+	tile   maptile.Tile
+	ranged *coverage.TileRange
+}
+
+// NewWriter returns a new Writer instance that writes coverage information to 'wr' as configured by 'opts'.
+func NewWriter(ctx context.Context, wr io.Writer, opts *WriterOptions) (*Writer, error) {
+
+	format := opts.Format
+
+	switch format {
+	case "":
+		format = CSV_FORMAT
+	case CSV_FORMAT, NDJSON_FORMAT, GEOJSON_FORMAT:
+		// pass
+	case QUADKEY_FORMAT:
+
+		if !tiles.IsWebMercator(opts.Grid) {
+			return nil, fmt.Errorf("Quadkeys are only supported for web mercator grids")
+		}
+
+	default:
+		return nil, fmt.Errorf("Invalid format '%s'", format)
+	}
+
+	from_prj, err := tiles.FromNativeProjection(opts.Grid)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive projection for grid, %w", err)
+	}
+
+	list_wr := &Writer{
+		wr:       wr,
+		csv_wr:   csv.NewWriter(wr),
+		format:   format,
+		header:   opts.Header,
+		grid:     opts.Grid,
+		mu:       new(sync.Mutex),
+		from_prj: from_prj,
+	}
+
+	return list_wr, nil
+}
+
+// WriteCoverage writes a row for each of the tiles in 'c'. If 'c' contains tile relations then each row will also
+// include the tile's relationship to the record's geometry and the fraction of the tile covered by it.
+func (w *Writer) WriteCoverage(ctx context.Context, c *coverage.Coverage) error {
+
+	records := make([]*record, 0, len(c.Tiles))
+
+	for _, t := range sortedTiles(c.Tiles) {
+
+		r := &record{
+			tile: t,
+		}
+
+		if w.format == QUADKEY_FORMAT {
+			r.keys = []string{"wof:id", "quadkey"}
+			r.values = []interface{}{c.Id, tiles.ToQuadkey(t)}
+		} else {
+			r.keys = []string{"wof:id", "z", "x", "y"}
+			r.values = []interface{}{c.Id, t.Z, t.X, t.Y}
+		}
+
+		if c.Relations != nil {
+
+			var relationship coverage.Relationship
+			var fraction float64
+
+			rel, ok := c.Relations[t]
+
+			if ok {
+				relationship = rel.Relationship
+				fraction = rel.Fraction
+			}
+
+			r.keys = append(r.keys, "relationship", "fraction")
+			r.values = append(r.values, relationship, fraction)
+		}
+
+		records = append(records, r)
+	}
+
+	return w.writeRecords(ctx, records...)
+}
+
+// WriteRangeCoverage writes a row for each of the tile ranges in 'c'.
+func (w *Writer) WriteRangeCoverage(ctx context.Context, c *coverage.RangeCoverage) error {
+
+	if w.format == QUADKEY_FORMAT {
+		return fmt.Errorf("Tile ranges can not be encoded as quadkeys")
+	}
+
+	records := make([]*record, len(c.Ranges))
+
+	for i, tr := range c.Ranges {
+
+		tr := tr
+
+		records[i] = &record{
+			keys:   []string{"wof:id", "zoom", "min_x", "min_y", "max_x", "max_y"},
+			values: []interface{}{c.Id, tr.Zoom, tr.MinX, tr.MinY, tr.MaxX, tr.MaxY},
+			ranged: &tr,
+		}
+	}
+
+	return w.writeRecords(ctx, records...)
+}
+
+// WriteQuadtreeCoverage writes a row for each of the (mixed-zoom) tiles in 'c'. Each row also includes the zoom level
+// that the tile stands in for.
+func (w *Writer) WriteQuadtreeCoverage(ctx context.Context, c *coverage.QuadtreeCoverage) error {
+
+	records := make([]*record, len(c.Tiles))
+
+	for i, t := range c.Tiles {
+
+		r := &record{
+			tile: t,
+		}
+
+		if w.format == QUADKEY_FORMAT {
+			r.keys = []string{"wof:id", "zoom", "quadkey"}
+			r.values = []interface{}{c.Id, c.Zoom, tiles.ToQuadkey(t)}
+		} else {
+			r.keys = []string{"wof:id", "zoom", "z", "x", "y"}
+			r.values = []interface{}{c.Id, c.Zoom, t.Z, t.X, t.Y}
+		}
+
+		records[i] = r
+	}
+
+	return w.writeRecords(ctx, records...)
+}
+
+// Close finishes writing any pending data, including the closing brackets for GEOJSON_FORMAT output. It does not
+// close the underlying io.Writer instance.
+func (w *Writer) Close(ctx context.Context) error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch w.format {
+	case GEOJSON_FORMAT:
+
+		if w.count == 0 {
+
+			_, err := io.WriteString(w.wr, `{"type":"FeatureCollection","features":[`)
+
+			if err != nil {
+				return fmt.Errorf("Failed to write feature collection, %w", err)
+			}
+		}
+
+		_, err := io.WriteString(w.wr, "]}\n")
+
+		if err != nil {
+			return fmt.Errorf("Failed to write feature collection, %w", err)
+		}
+
+	case CSV_FORMAT, QUADKEY_FORMAT:
+
+		w.csv_wr.Flush()
+		return w.csv_wr.Error()
+	}
+
+	return nil
+}
+
+func (w *Writer) writeRecords(ctx context.Context, records ...*record) error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, r := range records {
+
+		var err error
+
+		switch w.format {
+		case NDJSON_FORMAT:
+			err = w.writeNDJSON(r)
+		case GEOJSON_FORMAT:
+			err = w.writeGeoJSON(r)
+		default:
+			err = w.writeCSV(r)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		w.count += 1
+	}
+
+	if w.format == CSV_FORMAT || w.format == QUADKEY_FORMAT {
+		w.csv_wr.Flush()
+		return w.csv_wr.Error()
+	}
+
+	return nil
+}
+
+func (w *Writer) writeCSV(r *record) error {
+
+	if w.count == 0 && w.header {
+
+		err := w.csv_wr.Write(r.keys)
+
+		if err != nil {
+			return fmt.Errorf("Failed to write header, %w", err)
+		}
+	}
+
+	out := make([]string, len(r.values))
+
+	for i, v := range r.values {
+		out[i] = formatValue(v)
+	}
+
+	err := w.csv_wr.Write(out)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write row, %w", err)
+	}
+
+	return nil
+}
+
+func (w *Writer) writeNDJSON(r *record) error {
+
+	// Keys are written in order, rather than marshaling a map, so that rows are consistent with CSV output.
+
+	var buf bytes.Buffer
+	buf.WriteString("{")
+
+	for i, k := range r.keys {
+
+		if i > 0 {
+			buf.WriteString(",")
+		}
+
+		enc_k, err := json.Marshal(k)
+
+		if err != nil {
+			return fmt.Errorf("Failed to marshal key '%s', %w", k, err)
+		}
+
+		enc_v, err := json.Marshal(r.values[i])
+
+		if err != nil {
+			return fmt.Errorf("Failed to marshal value for '%s', %w", k, err)
+		}
+
+		buf.Write(enc_k)
+		buf.WriteString(":")
+		buf.Write(enc_v)
+	}
+
+	buf.WriteString("}\n")
+
+	_, err := w.wr.Write(buf.Bytes())
+
+	if err != nil {
+		return fmt.Errorf("Failed to write row, %w", err)
+	}
+
+	return nil
+}
+
+func (w *Writer) writeGeoJSON(r *record) error {
+
+	poly, err := w.polygon(r)
+
+	if err != nil {
+		return err
+	}
+
+	f := geojson.NewFeature(poly)
+
+	for i, k := range r.keys {
+		f.Properties[k] = r.values[i]
+	}
+
+	enc_f, err := f.MarshalJSON()
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal feature, %w", err)
+	}
+
+	prefix := ","
+
+	if w.count == 0 {
+		prefix = `{"type":"FeatureCollection","features":[`
+	}
+
+	_, err = io.WriteString(w.wr, prefix)
+
+	if err == nil {
+		_, err = w.wr.Write(enc_f)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to write feature, %w", err)
+	}
+
+	return nil
+}
+
+// polygon returns the EPSG:4326 polygon for the tile, or range of tiles, described by 'r'.
+func (w *Writer) polygon(r *record) (orb.Polygon, error) {
+
+	var ext orb.Bound
+
+	if r.ranged != nil {
+
+		min_ext, err := tiles.TileExtent(w.grid, maptile.New(r.ranged.MinX, r.ranged.MinY, r.ranged.Zoom))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to derive extent for range, %w", err)
+		}
+
+		max_ext, err := tiles.TileExtent(w.grid, maptile.New(r.ranged.MaxX, r.ranged.MaxY, r.ranged.Zoom))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to derive extent for range, %w", err)
+		}
+
+		ext = min_ext.Union(max_ext)
+
+	} else {
+
+		t_ext, err := tiles.TileExtent(w.grid, r.tile)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to derive extent for tile %d/%d/%d, %w", r.tile.Z, r.tile.X, r.tile.Y, err)
+		}
+
+		ext = t_ext
+	}
+
+	ring := orb.Ring{
+		w.from_prj(orb.Point{ext.Min.X(), ext.Min.Y()}),
+		w.from_prj(orb.Point{ext.Max.X(), ext.Min.Y()}),
+		w.from_prj(orb.Point{ext.Max.X(), ext.Max.Y()}),
+		w.from_prj(orb.Point{ext.Min.X(), ext.Max.Y()}),
+		w.from_prj(orb.Point{ext.Min.X(), ext.Min.Y()}),
+	}
+
+	return orb.Polygon{ring}, nil
+}
+
+func formatValue(v interface{}) string {
+
+	switch t := v.(type) {
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case uint:
+		return strconv.FormatUint(uint64(t), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(t), 10)
+	case maptile.Zoom:
+		return strconv.FormatUint(uint64(t), 10)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case coverage.Relationship:
+		return string(t)
+	case string:
+		return t
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// sortedTiles returns the tiles in 'set' ordered by zoom level, column and then row.
+func sortedTiles(set maptile.Set) maptile.Tiles {
+
+	tiles_list := make(maptile.Tiles, 0, len(set))
+
+	for t, _ := range set {
+		tiles_list = append(tiles_list, t)
+	}
+
+	sort.Slice(tiles_list, func(i, j int) bool {
+
+		a := tiles_list[i]
+		b := tiles_list[j]
+
+		if a.Z != b.Z {
+			return a.Z < b.Z
+		}
+
+		if a.X != b.X {
+			return a.X < b.X
+		}
+
+		return a.Y < b.Y
+	})
+
+	return tiles_list
+}
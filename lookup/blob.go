@@ -0,0 +1,224 @@
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles/coverage"
+	"gocloud.dev/blob"
+	"os"
+)
+
+// BlobWriter implements the Writer interface for writing tile lookup entries to a gocloud.dev/blob bucket as
+// individual {Z}/{X}/{Y}.json objects. Each object contains a JSON-encoded list of Entry instances sorted by ID.
+// Because all the entries for a tile need to be known before it can be written entries are staged in a temporary
+// SQLite database, on disk, until the writer's Close method is invoked at which point they are grouped by tile and
+// written to the bucket one tile at a time. If the same record is written more than once for a tile the last entry
+// wins.
+type BlobWriter struct {
+	bucket       *blob.Bucket
+	staging      *SQLiteWriter
+	staging_path string
+}
+
+var _ Writer = (*BlobWriter)(nil)
+
+// NewBlobWriter returns a new BlobWriter instance for 'uri' which is expected to be a valid gocloud.dev/blob bucket
+// URI. The relevant gocloud.dev/blob driver (for example gocloud.dev/blob/fileblob) needs to have been imported.
+// See NewBlobWriterWithBucket for details about how entries are staged.
+func NewBlobWriter(ctx context.Context, uri string) (Writer, error) {
+
+	bucket, err := blob.OpenBucket(ctx, uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open bucket, %w", err)
+	}
+
+	return NewBlobWriterWithBucket(ctx, bucket)
+}
+
+// NewBlobWriterWithBucket returns a new BlobWriter instance for 'bucket'. The bucket will be closed when the
+// writer's Close method is invoked. Entries are staged in a temporary SQLite database created in the default
+// directory for temporary files (os.TempDir) which needs to have enough free space for every entry in the index.
+// The database is opened using the SQLITE_DEFAULT_DRIVER database/sql driver which needs to have been imported by
+// the calling code (for example github.com/mattn/go-sqlite3). The database is removed when the writer's Close
+// method is invoked.
+func NewBlobWriterWithBucket(ctx context.Context, bucket *blob.Bucket) (Writer, error) {
+
+	tmp, err := os.CreateTemp("", "lookup-*.db")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create staging database, %w", err)
+	}
+
+	staging_path := tmp.Name()
+
+	err = tmp.Close()
+
+	if err != nil {
+		os.Remove(staging_path)
+		return nil, fmt.Errorf("Failed to close staging database, %w", err)
+	}
+
+	staging, err := newSQLiteWriter(ctx, SQLITE_DEFAULT_DRIVER, staging_path, SQLITE_DEFAULT_BATCH_SIZE)
+
+	if err != nil {
+		os.Remove(staging_path)
+		return nil, fmt.Errorf("Failed to open staging database, %w", err)
+	}
+
+	// The staging database is thrown away when the writer is closed so there is no need to wait for data to be
+	// synced to disk.
+
+	_, err = staging.db.ExecContext(ctx, "PRAGMA synchronous = OFF")
+
+	if err != nil {
+		staging.Close(ctx)
+		os.Remove(staging_path)
+		return nil, fmt.Errorf("Failed to configure staging database, %w", err)
+	}
+
+	wr := &BlobWriter{
+		bucket:       bucket,
+		staging:      staging,
+		staging_path: staging_path,
+	}
+
+	return wr, nil
+}
+
+// WriteEntry adds 'e' to the list of entries for tile 't' in the writer's staging database. Nothing is written to
+// the writer's bucket until the Close method is invoked.
+func (wr *BlobWriter) WriteEntry(ctx context.Context, t maptile.Tile, e *Entry) error {
+	return wr.staging.WriteEntry(ctx, t, e)
+}
+
+// Close writes the list of entries for each tile in the writer's staging database to {Z}/{X}/{Y}.json in the
+// writer's bucket, removes the staging database and then closes the bucket.
+func (wr *BlobWriter) Close(ctx context.Context) error {
+
+	defer os.Remove(wr.staging_path)
+
+	err := wr.writeTiles(ctx)
+
+	if err != nil {
+		wr.staging.Close(ctx)
+		wr.bucket.Close()
+		return err
+	}
+
+	err = wr.staging.Close(ctx)
+
+	if err != nil {
+		wr.bucket.Close()
+		return fmt.Errorf("Failed to close staging database, %w", err)
+	}
+
+	return wr.bucket.Close()
+}
+
+// writeTiles reads the entries in the writer's staging database, ordered by tile, and writes the entries for each
+// tile to the writer's bucket. Only the entries for a single tile are held in memory at any given time.
+func (wr *BlobWriter) writeTiles(ctx context.Context) error {
+
+	wr.staging.mu.Lock()
+	defer wr.staging.mu.Unlock()
+
+	err := wr.staging.batch.Commit()
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := wr.staging.db.QueryContext(ctx, "SELECT zoom_level, tile_column, tile_row, id, placetype, relationship, fraction FROM lookup ORDER BY zoom_level, tile_column, tile_row, id")
+
+	if err != nil {
+		return fmt.Errorf("Failed to query staging database, %w", err)
+	}
+
+	defer rows.Close()
+
+	var current maptile.Tile
+	tile_entries := make([]*Entry, 0)
+
+	for rows.Next() {
+
+		var z, x, y uint32
+		var relationship string
+
+		e := new(Entry)
+
+		err := rows.Scan(&z, &x, &y, &e.Id, &e.Placetype, &relationship, &e.Fraction)
+
+		if err != nil {
+			return fmt.Errorf("Failed to scan staging database row, %w", err)
+		}
+
+		e.Relationship = coverage.Relationship(relationship)
+		t := maptile.New(x, y, maptile.Zoom(z))
+
+		if len(tile_entries) > 0 && t != current {
+
+			err := wr.writeTile(ctx, current, tile_entries)
+
+			if err != nil {
+				return err
+			}
+
+			tile_entries = tile_entries[:0]
+		}
+
+		current = t
+		tile_entries = append(tile_entries, e)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read staging database, %w", err)
+	}
+
+	if len(tile_entries) > 0 {
+		return wr.writeTile(ctx, current, tile_entries)
+	}
+
+	return nil
+}
+
+// writeTile writes 'tile_entries', which are expected to be sorted by ID, to {Z}/{X}/{Y}.json in the writer's bucket.
+func (wr *BlobWriter) writeTile(ctx context.Context, t maptile.Tile, tile_entries []*Entry) error {
+
+	path := fmt.Sprintf("%d/%d/%d.json", t.Z, t.X, t.Y)
+
+	body, err := json.Marshal(tile_entries)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal entries for '%s', %w", path, err)
+	}
+
+	wr_opts := &blob.WriterOptions{
+		ContentType: "application/json",
+	}
+
+	bucket_wr, err := wr.bucket.NewWriter(ctx, path, wr_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create new writer for '%s', %w", path, err)
+	}
+
+	_, err = bucket_wr.Write(body)
+
+	if err != nil {
+		bucket_wr.Close()
+		return fmt.Errorf("Failed to write '%s', %w", path, err)
+	}
+
+	err = bucket_wr.Close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to close '%s', %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package lookup
+
+import (
+	"context"
+	"fmt"
+	"github.com/sfomuseum/go-whosonfirst-tiles/coverage"
+	"github.com/sfomuseum/go-whosonfirst-tiles/internal/wof"
+	"github.com/whosonfirst/go-whosonfirst-iterate/emitter"
+	"github.com/whosonfirst/go-whosonfirst-iterate/iterator"
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// BuilderOptions defines configuration options for a Builder instance.
+type BuilderOptions struct {
+	// A valid whosonfirst/go-whosonfirst-iterate/emitter URI.
+	IteratorURI string
+	// The CoverageOptions used to determine which tiles each record covers. Tile relationships are always derived
+	// regardless of the value of its Relations flag.
+	CoverageOptions *coverage.CoverageOptions
+	// The Writer instance where lookup entries will be written. The Builder does not close the writer.
+	Writer Writer
+	// An optional *log.Logger instance for reporting progress. If nil nothing is logged.
+	Logger *log.Logger
+}
+
+// Builder builds an inverted index mapping map tiles to the Who's On First records that cover them by iterating over
+// records, determining their tile coverage and writing an Entry for each (tile, record) pair.
+type Builder struct {
+	options *BuilderOptions
+	logger  *log.Logger
+}
+
+// Summary reports the work done by the Builder.Build method.
+type Summary struct {
+	// The number of records processed.
+	Records int64 `json:"records"`
+	// The number of entries written.
+	Entries int64 `json:"entries"`
+	// The amount of time it took to complete.
+	Duration time.Duration `json:"duration"`
+}
+
+// NewBuilder returns a new Builder instance configured by 'opts'.
+func NewBuilder(ctx context.Context, opts *BuilderOptions) (*Builder, error) {
+
+	if opts.IteratorURI == "" {
+		return nil, fmt.Errorf("Missing iterator URI")
+	}
+
+	if opts.CoverageOptions == nil {
+		return nil, fmt.Errorf("Missing coverage options")
+	}
+
+	if opts.Writer == nil {
+		return nil, fmt.Errorf("Missing writer")
+	}
+
+	logger := opts.Logger
+
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+
+	b := &Builder{
+		options: opts,
+		logger:  logger,
+	}
+
+	return b, nil
+}
+
+// Build writes lookup entries for all the records emitted by the builder's iterator for 'uris'.
+func (b *Builder) Build(ctx context.Context, uris ...string) (*Summary, error) {
+
+	t1 := time.Now()
+	summary := new(Summary)
+
+	iter_cb := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
+
+		body, err := io.ReadAll(fh)
+
+		if err != nil {
+			return fmt.Errorf("Failed to read record, %w", err)
+		}
+
+		count, err := IndexFeature(ctx, b.options.CoverageOptions, b.options.Writer, body)
+
+		if err != nil {
+			return err
+		}
+
+		atomic.AddInt64(&summary.Records, 1)
+		atomic.AddInt64(&summary.Entries, count)
+
+		path, _ := emitter.PathForContext(ctx)
+		b.logger.Printf("Wrote %d entries for %s\n", count, path)
+
+		return nil
+	}
+
+	iter, err := iterator.NewIterator(ctx, b.options.IteratorURI, iter_cb)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create new iterator, %w", err)
+	}
+
+	err = iter.IterateURIs(ctx, uris...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate URIs, %w", err)
+	}
+
+	summary.Duration = time.Since(t1)
+
+	return summary, nil
+}
+
+// IndexFeature writes a lookup Entry to 'wr' for each of the tiles, determined by 'opts', that cover the Who's On
+// First record defined by 'body'. It returns the number of entries written.
+func IndexFeature(ctx context.Context, opts *coverage.CoverageOptions, wr Writer, body []byte) (int64, error) {
+
+	placetype, err := wof.Placetype(body)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Make a copy of 'opts' so that relationships are always derived without modifying the caller's options.
+
+	cover_opts := *opts
+	cover_opts.Relations = true
+
+	var count int64
+
+	tile_cb := func(ctx context.Context, rsp *coverage.Coverage) error {
+
+		for t, _ := range rsp.Tiles {
+
+			e := &Entry{
+				Id:        rsp.Id,
+				Placetype: placetype,
+			}
+
+			rel, ok := rsp.Relations[t]
+
+			if ok {
+				e.Relationship = rel.Relationship
+				e.Fraction = rel.Fraction
+			}
+
+			err := wr.WriteEntry(ctx, t, e)
+
+			if err != nil {
+				return err
+			}
+
+			count += 1
+		}
+
+		return nil
+	}
+
+	err = coverage.CoverageWithFeatureAndCallback(ctx, &cover_opts, body, tile_cb)
+
+	if err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
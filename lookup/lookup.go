@@ -0,0 +1,64 @@
+// package lookup provides methods for building and persisting inverted indices mapping map tiles to the Who's On
+// First records that cover them.
+package lookup
+
+import (
+	"context"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles/coverage"
+	"github.com/sfomuseum/go-whosonfirst-tiles/internal/registry"
+)
+
+// Entry describes a single Who's On First record that covers a map tile.
+type Entry struct {
+	// The Who's On First ID of the record.
+	Id int64 `json:"wof:id"`
+	// The placetype of the record.
+	Placetype string `json:"wof:placetype"`
+	// The relationship between the map tile and the record's geometry.
+	Relationship coverage.Relationship `json:"relationship"`
+	// The fraction (0.0 to 1.0) of the map tile covered by the record's geometry.
+	Fraction float64 `json:"fraction"`
+}
+
+// Writer is an interface for persisting the entries of a tile lookup index.
+type Writer interface {
+	// WriteEntry records that the Who's On First record described by 'e' covers tile 't'.
+	WriteEntry(context.Context, maptile.Tile, *Entry) error
+	// Close flushes any pending data and closes the destination.
+	Close(context.Context) error
+}
+
+// WriterInitializeFunc is a function used to initialize an implementation of the Writer interface.
+type WriterInitializeFunc func(context.Context, string) (Writer, error)
+
+var writers = registry.NewRegistry()
+
+// RegisterWriter registers 'scheme' as a key pointing to 'f' in an internal lookup table of writers.
+func RegisterWriter(ctx context.Context, scheme string, f WriterInitializeFunc) error {
+	return writers.Register(ctx, scheme, f)
+}
+
+// Schemes returns the list of schemes that have been registered with the RegisterWriter method.
+func Schemes() []string {
+	return writers.Schemes()
+}
+
+// NewWriter returns a new Writer instance for 'uri'. If the scheme of 'uri' matches a writer previously registered
+// with the RegisterWriter method then that writer is used. Otherwise 'uri' is assumed to be a gocloud.dev/blob bucket
+// URI and a new BlobWriter is returned.
+func NewWriter(ctx context.Context, uri string) (Writer, error) {
+
+	i, ok, err := writers.Lookup(ctx, uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return NewBlobWriter(ctx, uri)
+	}
+
+	f := i.(WriterInitializeFunc)
+	return f(ctx, uri)
+}
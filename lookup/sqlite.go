@@ -0,0 +1,136 @@
+package lookup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles/internal/sqlite"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// The default database/sql driver used to open SQLite databases.
+const SQLITE_DEFAULT_DRIVER string = "sqlite3"
+
+// The default number of entries to write in a single database transaction.
+const SQLITE_DEFAULT_BATCH_SIZE int = 1000
+
+const sqlite_schema string = `CREATE TABLE IF NOT EXISTS lookup (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, id INTEGER, placetype TEXT, relationship TEXT, fraction REAL);
+CREATE UNIQUE INDEX IF NOT EXISTS lookup_by_tile ON lookup (zoom_level, tile_column, tile_row, id);
+CREATE INDEX IF NOT EXISTS lookup_by_id ON lookup (id);
+CREATE INDEX IF NOT EXISTS lookup_by_placetype ON lookup (zoom_level, tile_column, tile_row, placetype);`
+
+func init() {
+	ctx := context.Background()
+	RegisterWriter(ctx, "sqlite", NewSQLiteWriter)
+}
+
+// SQLiteWriter implements the Writer interface for writing tile lookup entries to the "lookup" table of a SQLite
+// database. Each row contains the zoom_level, tile_column and tile_row of a tile (using the same grid the entries were
+// derived from, with rows counted from the top) as well as the id, placetype, relationship and fraction properties of
+// the entry. If the same record is written more than once for a tile the last entry wins.
+type SQLiteWriter struct {
+	db    *sql.DB
+	batch *sqlite.Batch
+	mu    *sync.Mutex
+}
+
+var _ Writer = (*SQLiteWriter)(nil)
+
+// NewSQLiteWriter returns a new SQLiteWriter instance configured by 'uri' which is expected to take the form of:
+//
+//	sqlite://{PATH}?{PARAMETERS}
+//
+// Where {PATH} is the path to the SQLite database to create (or update) and {PARAMETERS} may be:
+// * `driver` The name of the database/sql driver used to open the database. Default is "sqlite3". The driver needs to have been imported by the calling code.
+// * `batch_size` The number of entries to write in a single database transaction. Default is 1000.
+func NewSQLiteWriter(ctx context.Context, uri string) (Writer, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	path := u.Path
+
+	if u.Host != "" {
+		path = u.Host + u.Path
+	}
+
+	if path == "" {
+		return nil, fmt.Errorf("Missing SQLite path")
+	}
+
+	q := u.Query()
+
+	driver := SQLITE_DEFAULT_DRIVER
+
+	if q.Get("driver") != "" {
+		driver = q.Get("driver")
+	}
+
+	batch_size := SQLITE_DEFAULT_BATCH_SIZE
+
+	if q.Get("batch_size") != "" {
+
+		v, err := strconv.Atoi(q.Get("batch_size"))
+
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("Invalid ?batch_size= parameter")
+		}
+
+		batch_size = v
+	}
+
+	return newSQLiteWriter(ctx, driver, path, batch_size)
+}
+
+func newSQLiteWriter(ctx context.Context, driver string, path string, batch_size int) (*SQLiteWriter, error) {
+
+	db, err := sqlite.OpenDatabase(ctx, driver, path, sqlite_schema)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create lookup database, %w", err)
+	}
+
+	wr := &SQLiteWriter{
+		db:    db,
+		batch: sqlite.NewBatch(db, batch_size),
+		mu:    new(sync.Mutex),
+	}
+
+	return wr, nil
+}
+
+// WriteEntry writes 'e' to the "lookup" table in the writer's database.
+func (wr *SQLiteWriter) WriteEntry(ctx context.Context, t maptile.Tile, e *Entry) error {
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	err := wr.batch.Exec(ctx, "INSERT OR REPLACE INTO lookup (zoom_level, tile_column, tile_row, id, placetype, relationship, fraction) VALUES (?, ?, ?, ?, ?, ?, ?)", int(t.Z), int(t.X), int(t.Y), e.Id, e.Placetype, string(e.Relationship), e.Fraction)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write entry for %d in tile %d/%d/%d, %w", e.Id, t.Z, t.X, t.Y, err)
+	}
+
+	return nil
+}
+
+// Close commits any pending entries and closes the writer's database.
+func (wr *SQLiteWriter) Close(ctx context.Context) error {
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	err := wr.batch.Commit()
+
+	if err != nil {
+		return err
+	}
+
+	return wr.db.Close()
+}
@@ -0,0 +1,238 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles/coverage"
+	"github.com/sfomuseum/go-whosonfirst-tiles/crop"
+	"github.com/sfomuseum/go-whosonfirst-tiles/render"
+	"github.com/whosonfirst/go-whosonfirst-iterate/iterator"
+	"io"
+	"sync/atomic"
+)
+
+// gather writes the cropped feature for each of the map tiles associated with the records emitted for 'uris' as
+// line-delimited GeoJSON fragments in the pipeline's data bucket. Each cropped feature is written as its own
+// fragment, rather than being appended to a shared per-tile document, so that records can be processed in parallel
+// without any locking or read-modify-write cycles. Coverage for all the records is derived by a single, shared pool of
+// GatherWorkers workers. If the pipeline has a mask then records are cropped to it before their coverage is derived.
+func (p *Pipeline) gather(ctx context.Context, summary *Summary, uris ...string) error {
+
+	var seq int64
+
+	iter_uri, err := p.iteratorURI()
+
+	if err != nil {
+		return err
+	}
+
+	batch_opts := &coverage.BatchOptions{
+		CoverageOptions: p.options.CoverageOptions,
+		Workers:         p.options.GatherWorkers,
+	}
+
+	batch, err := coverage.NewBatch(ctx, batch_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create new coverage batch, %w", err)
+	}
+
+	iter_cb := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
+
+		body, err := io.ReadAll(fh)
+
+		if err != nil {
+			return fmt.Errorf("Failed to read record, %w", err)
+		}
+
+		if p.mask != nil {
+
+			body, err = crop.CropFeatureWithMask(ctx, body, p.mask)
+
+			if errors.Is(err, crop.ErrNoIntersection) {
+				incr(&summary.Masked)
+				return nil
+			}
+
+			if err != nil {
+				return fmt.Errorf("Failed to apply mask to record, %w", err)
+			}
+		}
+
+		// The same wof:id may be emitted more than once (for example alternate geometries) so fragments
+		// are also keyed by the order in which records were processed.
+
+		record_seq := atomic.AddInt64(&seq, 1)
+
+		tile_cb := func(ctx context.Context, rsp *coverage.Coverage) error {
+
+			for t, _ := range rsp.Tiles {
+
+				path := fragmentPath(t, rsp.Id, record_seq)
+
+				bounds, err := p.cropBounds(t)
+
+				if err != nil {
+					return fmt.Errorf("Failed to derive bounds for '%s', %w", path, err)
+				}
+
+				var cropped []byte
+
+				// Tiles that are entirely covered by the feature don't need to be cropped. This is only known
+				// for the tile itself though so the feature is still cropped if the bounds have been buffered.
+
+				rel, ok := rsp.Relations[t]
+
+				if ok && rel.Relationship == coverage.INSIDE_RELATIONSHIP && !p.bufferedBounds() {
+					cropped, err = crop.FillFeatureWithBounds(ctx, body, bounds)
+				} else {
+					cropped, err = crop.CropFeatureWithBounds(ctx, body, bounds)
+				}
+
+				// Coverage is derived from the shape of a record so a record may still miss some of the
+				// tiles it covers once it has been cropped, for example tiles that fall inside a hole.
+
+				if errors.Is(err, crop.ErrNoIntersection) {
+					incr(&summary.Empty)
+					continue
+				}
+
+				if err != nil {
+					p.logger.Printf("Failed to crop feature '%s', %v", path, err)
+					incr(&summary.Skipped)
+					continue
+				}
+
+				err = p.writeFragment(ctx, path, cropped)
+
+				if err != nil {
+					return err
+				}
+
+				incr(&summary.Fragments)
+			}
+
+			return nil
+		}
+
+		err = batch.Add(ctx, body, tile_cb)
+
+		if err != nil {
+			return err
+		}
+
+		incr(&summary.Records)
+		return nil
+	}
+
+	iter, err := iterator.NewIterator(ctx, iter_uri, iter_cb)
+
+	if err != nil {
+		batch.Wait()
+		return fmt.Errorf("Failed to create new iterator, %w", err)
+	}
+
+	err = iter.IterateURIs(ctx, uris...)
+
+	if err != nil {
+		batch.Wait()
+		return fmt.Errorf("Failed to iterate URIs, %w", err)
+	}
+
+	err = batch.Wait()
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive coverage, %w", err)
+	}
+
+	return nil
+}
+
+// writeFragment writes 'body' followed by a newline to 'path' in the pipeline's data bucket.
+func (p *Pipeline) writeFragment(ctx context.Context, path string, body []byte) error {
+
+	wr, err := p.options.DataBucket.NewWriter(ctx, path, nil)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create new writer for '%s', %w", path, err)
+	}
+
+	_, err = wr.Write(body)
+
+	if err == nil {
+		_, err = wr.Write([]byte("\n"))
+	}
+
+	if err != nil {
+		wr.Close()
+		return fmt.Errorf("Failed to write '%s', %w", path, err)
+	}
+
+	err = wr.Close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to close '%s', %w", path, err)
+	}
+
+	return nil
+}
+
+// cropBounds returns the geographic bounds that the records assigned to 't' are cropped to. Records assigned to
+// neighbouring tiles by a coverage buffer are cropped to the buffered bounds of the tile so that they are not clipped
+// away entirely. If the pipeline's renderer is a render.BufferedRenderer the bounds are also expanded by its buffer so
+// that strokes are not cut off at the edges of the tile.
+func (p *Pipeline) cropBounds(t maptile.Tile) (orb.Bound, error) {
+
+	cover_opts := p.options.CoverageOptions
+
+	bounds, err := coverage.BufferedTileBound(cover_opts, t)
+
+	if err != nil {
+		return orb.Bound{}, err
+	}
+
+	r, ok := p.options.Renderer.(render.BufferedRenderer)
+
+	if !ok || r.Buffer() <= 0 {
+		return bounds, nil
+	}
+
+	crop_opts := &crop.CropOptions{
+		Grid:     cover_opts.Grid,
+		Buffer:   r.Buffer(),
+		TileSize: r.TileSize(),
+	}
+
+	render_bounds, err := crop.TileBoundWithOptions(t, crop_opts)
+
+	if err != nil {
+		return orb.Bound{}, err
+	}
+
+	return bounds.Union(render_bounds), nil
+}
+
+// bufferedBounds returns true if the bounds returned by cropBounds extend beyond the edges of a tile.
+func (p *Pipeline) bufferedBounds() bool {
+
+	if p.options.CoverageOptions.Buffer > 0 {
+		return true
+	}
+
+	r, ok := p.options.Renderer.(render.BufferedRenderer)
+
+	return ok && r.Buffer() > 0
+}
+
+// fragmentPath returns the data bucket path for the cropped feature of record 'id' in tile 't'.
+func fragmentPath(t maptile.Tile, id int64, seq int64) string {
+	return fmt.Sprintf("%s%d-%d.geojsonl", tilePrefix(t), id, seq)
+}
+
+// tilePrefix returns the data bucket prefix for all the fragments associated with tile 't'.
+func tilePrefix(t maptile.Tile) string {
+	return fmt.Sprintf("%d/%d/%d/", t.Z, t.X, t.Y)
+}
@@ -0,0 +1,206 @@
+// package pipeline provides methods for generating map tiles derived from Who's On First records by iterating over
+// records, determining their tile coverage, cropping them to each tile and rendering the results.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/sfomuseum/go-whosonfirst-tiles/coverage"
+	"github.com/sfomuseum/go-whosonfirst-tiles/crop"
+	"github.com/sfomuseum/go-whosonfirst-tiles/render"
+	"github.com/sfomuseum/go-whosonfirst-tiles/writer"
+	"gocloud.dev/blob"
+	"io"
+	"log"
+	"net/url"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// PipelineOptions defines configuration options for a Pipeline instance.
+type PipelineOptions struct {
+	// A valid whosonfirst/go-whosonfirst-iterate/emitter URI.
+	IteratorURI string
+	// The CoverageOptions used to determine which tiles each record covers. Its Grid is also used to crop and render tiles.
+	// If its Relations flag is true then tiles that are entirely covered by a record are filled rather than cropped,
+	// unless records are cropped to buffered bounds. If it defines a Buffer then records are cropped to the buffered
+	// bounds of each tile. If its TileSize is 0 and Renderer is a render.BufferedRenderer then pixel buffers are measured
+	// against the renderer's tile size, which is also used to crop records to the renderer's buffer.
+	CoverageOptions *coverage.CoverageOptions
+	// An optional Polygon or MultiPolygon, in EPSG:4326 coordinates, that all tiles are restricted to. Records are
+	// cropped to the mask before their tile coverage is determined so only tiles that intersect the mask are produced
+	// and records that do not intersect it are skipped.
+	Mask orb.Geometry
+	// The render.Renderer instance used to produce tiles. If it is a render.BufferedRenderer then records are cropped
+	// to the bounds of each tile expanded by the renderer's buffer.
+	Renderer render.Renderer
+	// A gocloud.dev/blob.Bucket instance where intermediate data (cropped features grouped by tile) will be written.
+	DataBucket *blob.Bucket
+	// The writer.Writer instance where rendered tiles will be written. The Pipeline does not close the writer.
+	TileWriter writer.Writer
+	// The maximum number of records to process concurrently. This limits both the iterator and the shared pool of
+	// workers used to derive coverage. If 0 the iterator's default, and the number of available CPUs, are used.
+	GatherWorkers int
+	// The maximum number of tiles to render concurrently. If 0 the number of available CPUs is used.
+	RenderWorkers int
+	// An optional *log.Logger instance for reporting progress and non-fatal errors. If nil nothing is logged.
+	Logger *log.Logger
+}
+
+// Pipeline generates map tiles for Who's On First records in two passes. The first pass writes the cropped feature
+// for each of the map tiles associated with a given record as a line-delimited GeoJSON fragment keyed by tile
+// ({Z}/{X}/{Y}/{WOF_ID}-{SEQUENCE}.geojsonl) to the data bucket. The second pass iterates over those fragments,
+// grouped by tile, renders each tile and then removes the fragments.
+type Pipeline struct {
+	options *PipelineOptions
+	logger  *log.Logger
+	mask    *crop.Mask
+}
+
+// Summary reports the work done by the Pipeline.Run method.
+type Summary struct {
+	// The number of records processed.
+	Records int64 `json:"records"`
+	// The number of cropped feature fragments written to the data bucket.
+	Fragments int64 `json:"fragments"`
+	// The number of (record, tile) pairs that were skipped because the record could not be cropped.
+	Skipped int64 `json:"skipped"`
+	// The number of (record, tile) pairs that were skipped because the record does not intersect the tile once cropped.
+	Empty int64 `json:"empty"`
+	// The number of records that were skipped because they do not intersect the mask.
+	Masked int64 `json:"masked"`
+	// The number of tiles rendered.
+	Tiles int64 `json:"tiles"`
+	// The amount of time it took to complete.
+	Duration time.Duration `json:"duration"`
+}
+
+// NewPipeline returns a new Pipeline instance configured by 'opts'.
+func NewPipeline(ctx context.Context, opts *PipelineOptions) (*Pipeline, error) {
+
+	if opts.IteratorURI == "" {
+		return nil, fmt.Errorf("Missing iterator URI")
+	}
+
+	if opts.CoverageOptions == nil {
+		return nil, fmt.Errorf("Missing coverage options")
+	}
+
+	if opts.Renderer == nil {
+		return nil, fmt.Errorf("Missing renderer")
+	}
+
+	if opts.DataBucket == nil {
+		return nil, fmt.Errorf("Missing data bucket")
+	}
+
+	if opts.TileWriter == nil {
+		return nil, fmt.Errorf("Missing tile writer")
+	}
+
+	if !writer.SupportsGrid(opts.TileWriter, opts.CoverageOptions.Grid) {
+		return nil, fmt.Errorf("Tile writer does not support the coverage grid")
+	}
+
+	if opts.GatherWorkers < 0 || opts.RenderWorkers < 0 {
+		return nil, fmt.Errorf("Invalid worker count")
+	}
+
+	// Measure coverage buffers against the same tile size as the renderer's buffer, unless told otherwise, so
+	// that records are assigned to the same tiles they are cropped to. The caller's options are left unchanged.
+
+	br, ok := opts.Renderer.(render.BufferedRenderer)
+
+	if ok && opts.CoverageOptions.TileSize == 0 && br.TileSize() > 0 {
+
+		cover_opts := *opts.CoverageOptions
+		cover_opts.TileSize = uint(br.TileSize())
+
+		pipeline_opts := *opts
+		pipeline_opts.CoverageOptions = &cover_opts
+
+		opts = &pipeline_opts
+	}
+
+	logger := opts.Logger
+
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+
+	p := &Pipeline{
+		options: opts,
+		logger:  logger,
+	}
+
+	if opts.Mask != nil {
+
+		mask, err := crop.NewMask(opts.Mask)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid mask, %w", err)
+		}
+
+		p.mask = mask
+	}
+
+	return p, nil
+}
+
+// Run generates tiles for all the records emitted by the pipeline's iterator for 'uris'.
+func (p *Pipeline) Run(ctx context.Context, uris ...string) (*Summary, error) {
+
+	t1 := time.Now()
+	summary := new(Summary)
+
+	err := p.gather(ctx, summary, uris...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to gather tile data, %w", err)
+	}
+
+	err = p.renderTiles(ctx, summary)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to render tiles, %w", err)
+	}
+
+	summary.Duration = time.Since(t1)
+	return summary, nil
+}
+
+// iteratorURI returns the pipeline's iterator URI with the GatherWorkers option, if present, assigned.
+func (p *Pipeline) iteratorURI() (string, error) {
+
+	if p.options.GatherWorkers == 0 {
+		return p.options.IteratorURI, nil
+	}
+
+	u, err := url.Parse(p.options.IteratorURI)
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse iterator URI, %w", err)
+	}
+
+	q := u.Query()
+	q.Set("_max_procs", strconv.Itoa(p.options.GatherWorkers))
+
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (p *Pipeline) renderWorkers() int {
+
+	if p.options.RenderWorkers == 0 {
+		return runtime.NumCPU()
+	}
+
+	return p.options.RenderWorkers
+}
+
+func incr(v *int64) {
+	atomic.AddInt64(v, 1)
+}
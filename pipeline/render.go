@@ -0,0 +1,244 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"gocloud.dev/blob"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// The maximum size, in bytes, of a single cropped feature fragment.
+const max_fragment_size int = 256 * 1024 * 1024
+
+var re_tile_prefix = regexp.MustCompile(`^(\d+)\/(\d+)\/(\d+)\/$`)
+
+// renderTiles renders a tile for each of the tile prefixes in the pipeline's data bucket. Tiles are rendered in
+// parallel, by up to RenderWorkers goroutines, and only the fragments for the tiles currently being rendered are
+// held in memory.
+func (p *Pipeline) renderTiles(ctx context.Context, summary *Summary) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	throttle := make(chan bool, p.renderWorkers())
+	wg := new(sync.WaitGroup)
+
+	err_mu := new(sync.Mutex)
+	var render_err error
+
+	var list func(context.Context, string) error
+
+	list = func(ctx context.Context, prefix string) error {
+
+		iter := p.options.DataBucket.List(&blob.ListOptions{
+			Delimiter: "/",
+			Prefix:    prefix,
+		})
+
+		for {
+			obj, err := iter.Next(ctx)
+
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				return fmt.Errorf("Failed to list '%s', %w", prefix, err)
+			}
+
+			if !obj.IsDir {
+				continue
+			}
+
+			path := obj.Key
+			m := re_tile_prefix.FindStringSubmatch(path)
+
+			if len(m) == 0 {
+
+				err := list(ctx, path)
+
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			z, _ := strconv.Atoi(m[1])
+			x, _ := strconv.Atoi(m[2])
+			y, _ := strconv.Atoi(m[3])
+
+			t := maptile.New(uint32(x), uint32(y), maptile.Zoom(z))
+
+			// If the context was cancelled because a tile failed to render then render_err takes
+			// precedence over the context error returned here.
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case throttle <- true:
+				// pass
+			}
+
+			wg.Add(1)
+
+			go func(t maptile.Tile) {
+
+				defer func() {
+					<-throttle
+					wg.Done()
+				}()
+
+				err := p.renderTile(ctx, summary, t)
+
+				if err != nil {
+
+					err_mu.Lock()
+
+					if render_err == nil {
+						render_err = err
+						cancel()
+					}
+
+					err_mu.Unlock()
+				}
+
+			}(t)
+		}
+
+		return nil
+	}
+
+	err := list(ctx, "")
+	wg.Wait()
+
+	if render_err != nil {
+		return render_err
+	}
+
+	return err
+}
+
+// renderTile renders all the fragments associated with 't' and writes the result to the pipeline's tile writer.
+// Once the tile has been written the fragments are removed from the data bucket.
+func (p *Pipeline) renderTile(ctx context.Context, summary *Summary, t maptile.Tile) error {
+
+	prefix := tilePrefix(t)
+
+	features, fragments, err := p.readFragments(ctx, prefix)
+
+	if err != nil {
+		return err
+	}
+
+	if len(features) == 0 {
+		return nil
+	}
+
+	r := p.options.Renderer
+
+	t_path := fmt.Sprintf("%d/%d/%d.%s", t.Z, t.X, t.Y, r.Extension())
+
+	var buf bytes.Buffer
+
+	err = r.Render(ctx, &buf, p.options.CoverageOptions.Grid, t, features...)
+
+	if err != nil {
+		return fmt.Errorf("Failed to render '%s', %w", t_path, err)
+	}
+
+	err = p.options.TileWriter.WriteTile(ctx, t, r, &buf)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write '%s', %w", t_path, err)
+	}
+
+	incr(&summary.Tiles)
+	p.logger.Println("Wrote", t_path)
+
+	for _, path := range fragments {
+
+		err = p.options.DataBucket.Delete(ctx, path)
+
+		if err != nil {
+			p.logger.Printf("Failed to delete '%s', %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// readFragments returns the list of features, and the paths of the fragments they were read from, for all the
+// fragments in the pipeline's data bucket starting with 'prefix'.
+func (p *Pipeline) readFragments(ctx context.Context, prefix string) ([]*geojson.Feature, []string, error) {
+
+	features := make([]*geojson.Feature, 0)
+	fragments := make([]string, 0)
+
+	iter := p.options.DataBucket.List(&blob.ListOptions{
+		Prefix: prefix,
+	})
+
+	for {
+		obj, err := iter.Next(ctx)
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to list '%s', %w", prefix, err)
+		}
+
+		if obj.IsDir {
+			continue
+		}
+
+		path := obj.Key
+
+		fh, err := p.options.DataBucket.NewReader(ctx, path, nil)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to open '%s', %w", path, err)
+		}
+
+		scanner := bufio.NewScanner(fh)
+		scanner.Buffer(make([]byte, 0, 64*1024), max_fragment_size)
+
+		for scanner.Scan() {
+
+			line := scanner.Bytes()
+
+			if len(line) == 0 {
+				continue
+			}
+
+			f, err := geojson.UnmarshalFeature(line)
+
+			if err != nil {
+				fh.Close()
+				return nil, nil, fmt.Errorf("Failed to unmarshal '%s', %w", path, err)
+			}
+
+			features = append(features, f)
+		}
+
+		err = scanner.Err()
+		fh.Close()
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to read '%s', %w", path, err)
+		}
+
+		fragments = append(fragments, path)
+	}
+
+	return features, fragments, nil
+}
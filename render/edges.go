@@ -0,0 +1,168 @@
+package render
+
+import (
+	"github.com/paulmach/orb"
+	"math"
+)
+
+// The distance, in tile-local units, within which a segment is considered to lie along the edge of a tile's clip bounds.
+const clip_edge_tolerance float64 = 1e-6
+
+// clipBounds returns the tile-local bounds that features are expected to have been cropped to for a tile whose sides
+// are 'size' units long and which extends 'buffer' units beyond each of its edges.
+func clipBounds(size float64, buffer float64) orb.Bound {
+
+	return orb.Bound{
+		Min: orb.Point{-buffer, -buffer},
+		Max: orb.Point{size + buffer, size + buffer},
+	}
+}
+
+// isClipEdge reports whether the segment from 'a' to 'b', in tile-local coordinates, runs along (or beyond) one of the
+// edges of 'clip'. Segments like these are created when a polygon is cropped to a tile and are not part of the
+// polygon's actual outline so they should not be stroked.
+func isClipEdge(a orb.Point, b orb.Point, clip orb.Bound) bool {
+
+	tol := clip_edge_tolerance
+
+	if math.Abs(a.X()-b.X()) <= tol {
+
+		if a.X() <= clip.Min.X()+tol || a.X() >= clip.Max.X()-tol {
+			return true
+		}
+	}
+
+	if math.Abs(a.Y()-b.Y()) <= tol {
+
+		if a.Y() <= clip.Min.Y()+tol || a.Y() >= clip.Max.Y()-tol {
+			return true
+		}
+	}
+
+	return false
+}
+
+// polygonOutlines returns the rings of the polygons in 'g' as lines, omitting the segments for which 'is_clip_edge'
+// returns true. The boolean return value is false if no segments were omitted, in which case the polygons in 'g' can
+// be stroked as-is.
+func polygonOutlines(g orb.Geometry, is_clip_edge func(orb.Point, orb.Point) bool) (orb.MultiLineString, bool) {
+
+	outlines := make(orb.MultiLineString, 0)
+	clipped := false
+
+	switch g := g.(type) {
+	case orb.Ring:
+		return polygonOutlines(orb.Polygon{g}, is_clip_edge)
+	case orb.Polygon:
+
+		for _, r := range g {
+			lines, ok := ringOutline(r, is_clip_edge)
+			outlines = append(outlines, lines...)
+			clipped = clipped || ok
+		}
+
+	case orb.MultiPolygon:
+
+		for _, p := range g {
+			lines, ok := polygonOutlines(p, is_clip_edge)
+			outlines = append(outlines, lines...)
+			clipped = clipped || ok
+		}
+
+	case orb.Collection:
+
+		for _, cg := range g {
+			lines, ok := polygonOutlines(cg, is_clip_edge)
+			outlines = append(outlines, lines...)
+			clipped = clipped || ok
+		}
+
+	case orb.Bound:
+		return polygonOutlines(g.ToPolygon(), is_clip_edge)
+	}
+
+	return outlines, clipped
+}
+
+// ringOutline returns 'r' as one or more lines, omitting the segments for which 'is_clip_edge' returns true. The
+// boolean return value is false if no segments were omitted.
+func ringOutline(r orb.Ring, is_clip_edge func(orb.Point, orb.Point) bool) (orb.MultiLineString, bool) {
+
+	pts := []orb.Point(r)
+
+	if len(pts) > 1 && pts[0] == pts[len(pts)-1] {
+		pts = pts[:len(pts)-1]
+	}
+
+	count := len(pts)
+
+	if count < 2 {
+		return nil, false
+	}
+
+	start := -1
+
+	for i := 0; i < count; i++ {
+
+		if is_clip_edge(pts[i], pts[(i+1)%count]) {
+			start = i
+			break
+		}
+	}
+
+	if start == -1 {
+
+		ls := make(orb.LineString, count+1)
+		copy(ls, pts)
+		ls[count] = pts[0]
+
+		return orb.MultiLineString{ls}, false
+	}
+
+	// Start walking the ring immediately after a clipped segment so that runs of (unclipped) segments which
+	// wrap around the end of the ring are returned as a single line.
+
+	lines := make(orb.MultiLineString, 0)
+	var current orb.LineString
+
+	for j := 1; j <= count; j++ {
+
+		i := (start + j) % count
+
+		a := pts[i]
+		b := pts[(i+1)%count]
+
+		if is_clip_edge(a, b) {
+
+			if len(current) > 1 {
+				lines = append(lines, current)
+			}
+
+			current = nil
+			continue
+		}
+
+		if current == nil {
+			current = orb.LineString{a}
+		}
+
+		current = append(current, b)
+	}
+
+	if len(current) > 1 {
+		lines = append(lines, current)
+	}
+
+	return lines, true
+}
+
+// isPolygonal reports whether 'g' is a polygonal (non-collection) geometry.
+func isPolygonal(g orb.Geometry) bool {
+
+	switch g.(type) {
+	case orb.Ring, orb.Polygon, orb.MultiPolygon, orb.Bound:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,140 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"io"
+	"math"
+	"net/url"
+	"strconv"
+)
+
+// GEOJSON_CONTENT_TYPE is the content type for GeoJSON data.
+const GEOJSON_CONTENT_TYPE string = "application/geo+json"
+
+// The list of simplestyle-spec properties that can be assigned by the GeoJSONRenderer.
+var simplestyle_properties = []string{
+	"stroke",
+	"stroke-width",
+	"stroke-opacity",
+	"fill",
+	"fill-opacity",
+}
+
+// The list of simplestyle-spec properties whose values are numbers rather than strings.
+var simplestyle_numeric_properties = map[string]bool{
+	"stroke-width":   true,
+	"stroke-opacity": true,
+	"fill-opacity":   true,
+}
+
+func init() {
+	ctx := context.Background()
+	RegisterRenderer(ctx, "geojson", NewGeoJSONRenderer)
+}
+
+// GeoJSONRenderer implements the Renderer interface for producing GeoJSON FeatureCollection tiles.
+type GeoJSONRenderer struct {
+	style map[string]interface{}
+}
+
+var _ Renderer = (*GeoJSONRenderer)(nil)
+
+// NewGeoJSONRenderer returns a new GeoJSONRenderer instance configured by 'uri' which is expected to take the form of:
+//
+//	geojson://?{PARAMETERS}
+//
+// Where {PARAMETERS} may be any of the following simplestyle-spec properties which, if present, will be assigned
+// to each feature in the final tile: stroke, stroke-width, stroke-opacity, fill and fill-opacity. The values of
+// stroke-width, stroke-opacity and fill-opacity must be numbers; opacities must be between 0 and 1.
+func NewGeoJSONRenderer(ctx context.Context, uri string) (Renderer, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	style := make(map[string]interface{})
+
+	for _, k := range simplestyle_properties {
+
+		v := q.Get(k)
+
+		if v == "" {
+			continue
+		}
+
+		if !simplestyle_numeric_properties[k] {
+			style[k] = v
+			continue
+		}
+
+		num_v, err := strconv.ParseFloat(v, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?%s= parameter, %w", k, err)
+		}
+
+		if math.IsNaN(num_v) || math.IsInf(num_v, 0) || num_v < 0.0 || (k != "stroke-width" && num_v > 1.0) {
+			return nil, fmt.Errorf("Invalid ?%s= parameter, value out of range", k)
+		}
+
+		style[k] = num_v
+	}
+
+	r := &GeoJSONRenderer{
+		style: style,
+	}
+
+	return r, nil
+}
+
+// Render writes 'features' to 'wr' as a GeoJSON FeatureCollection.
+func (r *GeoJSONRenderer) Render(ctx context.Context, wr io.Writer, g slippy.Grid, t maptile.Tile, features ...*geojson.Feature) error {
+
+	fc := geojson.NewFeatureCollection()
+
+	for _, f := range features {
+
+		if len(r.style) > 0 {
+
+			props := f.Properties.Clone()
+
+			for k, v := range r.style {
+				props[k] = v
+			}
+
+			styled_f := *f
+			styled_f.Properties = props
+
+			f = &styled_f
+		}
+
+		fc.Append(f)
+	}
+
+	enc_fc, err := fc.MarshalJSON()
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal feature collection, %w", err)
+	}
+
+	_, err = wr.Write(enc_fc)
+	return err
+}
+
+// Extension returns the file extension for GeoJSON tiles.
+func (r *GeoJSONRenderer) Extension() string {
+	return "geojson"
+}
+
+// ContentType returns the content type for GeoJSON tiles.
+func (r *GeoJSONRenderer) ContentType() string {
+	return GEOJSON_CONTENT_TYPE
+}
@@ -0,0 +1,98 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+	"testing"
+)
+
+func TestGeoJSONRendererStyle(t *testing.T) {
+
+	ctx := context.Background()
+
+	r, err := NewGeoJSONRenderer(ctx, "geojson://?stroke=%23ff0000&stroke-width=2.5&stroke-opacity=0.5&fill-opacity=1")
+
+	if err != nil {
+		t.Fatalf("Failed to create renderer, %v", err)
+	}
+
+	g, err := tiles.NewGrid(tiles.SRID_WEB_MERCATOR)
+
+	if err != nil {
+		t.Fatalf("Failed to create grid, %v", err)
+	}
+
+	f, err := geojson.UnmarshalFeature(mvtTestFeatureJSON(1, "locality", `{"type":"Point","coordinates":[0,0]}`))
+
+	if err != nil {
+		t.Fatalf("Failed to unmarshal feature, %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	err = r.Render(ctx, &buf, g, maptile.New(0, 0, 0), f)
+
+	if err != nil {
+		t.Fatalf("Failed to render tile, %v", err)
+	}
+
+	var fc struct {
+		Features []struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+
+	err = json.Unmarshal(buf.Bytes(), &fc)
+
+	if err != nil {
+		t.Fatalf("Failed to unmarshal feature collection, %v", err)
+	}
+
+	if len(fc.Features) != 1 {
+		t.Fatalf("Expected a single feature, got %d", len(fc.Features))
+	}
+
+	expected := map[string]interface{}{
+		"stroke":         "#ff0000",
+		"stroke-width":   2.5,
+		"stroke-opacity": 0.5,
+		"fill-opacity":   1.0,
+	}
+
+	props := fc.Features[0].Properties
+
+	for k, v := range expected {
+
+		if props[k] != v {
+			t.Fatalf("Expected %s property to be %v (%T), got %v (%T)", k, v, v, props[k], props[k])
+		}
+	}
+
+	_, ok := props["fill"]
+
+	if ok {
+		t.Fatalf("Unexpected fill property")
+	}
+
+	if len(f.Properties) != 3 {
+		t.Fatalf("Expected the original feature's properties to be left unchanged")
+	}
+}
+
+func TestGeoJSONRendererInvalidStyle(t *testing.T) {
+
+	ctx := context.Background()
+
+	for _, q := range []string{"stroke-width=wide", "stroke-width=-1", "stroke-opacity=1.5", "fill-opacity=NaN", "fill-opacity=-0.1"} {
+
+		_, err := NewGeoJSONRenderer(ctx, "geojson://?"+q)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to be invalid", q)
+		}
+	}
+}
@@ -0,0 +1,787 @@
+package render
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MVT_CONTENT_TYPE is the content type for Mapbox Vector Tile data.
+const MVT_CONTENT_TYPE string = "application/vnd.mapbox-vector-tile"
+
+// The Mapbox Vector Tile (v2.1) specification is here: https://github.com/mapbox/vector-tile-spec/tree/master/2.1
+
+const (
+	mvt_tile_layers protowire.Number = 3
+
+	mvt_layer_version  protowire.Number = 15
+	mvt_layer_name     protowire.Number = 1
+	mvt_layer_features protowire.Number = 2
+	mvt_layer_keys     protowire.Number = 3
+	mvt_layer_values   protowire.Number = 4
+	mvt_layer_extent   protowire.Number = 5
+
+	mvt_feature_id       protowire.Number = 1
+	mvt_feature_tags     protowire.Number = 2
+	mvt_feature_type     protowire.Number = 3
+	mvt_feature_geometry protowire.Number = 4
+
+	mvt_value_string protowire.Number = 1
+	mvt_value_double protowire.Number = 3
+	mvt_value_sint   protowire.Number = 6
+	mvt_value_bool   protowire.Number = 7
+)
+
+const (
+	mvt_geom_point      uint64 = 1
+	mvt_geom_linestring uint64 = 2
+	mvt_geom_polygon    uint64 = 3
+)
+
+const (
+	mvt_cmd_moveto    uint32 = 1
+	mvt_cmd_lineto    uint32 = 2
+	mvt_cmd_closepath uint32 = 7
+)
+
+// MVTOptions defines common configuration options for the RenderMVTWithFeatures method.
+type MVTOptions struct {
+	// The number of integer units along each side of the tile.
+	Extent uint32 `json:"extent"`
+	// The number of units, relative to Extent, that features are allowed to extend beyond the edges of the tile.
+	Buffer uint32 `json:"buffer"`
+	// The geographic (EPSG:4326) extent of the tile being rendered.
+	TileExtent *geom.Extent `json:"tile_extent"`
+	// The grid that TileExtent belongs to. If nil a web mercator (EPSG:3857) grid is assumed.
+	Grid slippy.Grid `json:"-"`
+	// The optional extent of the tile in the native coordinates of Grid. If nil it is derived from TileExtent, which
+	// is only exact for web mercator and geographic grids.
+	NativeExtent *geom.Extent `json:"native_extent"`
+	// The name of the property whose value is used to assign features to a named layer.
+	LayerProperty string `json:"layer_property"`
+	// The name of the layer to assign features whose LayerProperty value is missing or empty.
+	DefaultLayer string `json:"default_layer"`
+	// The list of feature properties to include in the final tile. If empty all (scalar) properties are included.
+	Properties []string `json:"properties"`
+	// A boolean flag signaling whether the final tile should be gzip-compressed.
+	Gzip bool `json:"gzip"`
+	// A valid io.Writer where MVT data will be written to.
+	Writer io.Writer
+}
+
+// DefaultMVTOptions returns default configuration options for using with the RenderMVTWithFeatures method.
+func DefaultMVTOptions() *MVTOptions {
+
+	opts := &MVTOptions{
+		Extent:        4096,
+		Buffer:        64,
+		LayerProperty: "wof:placetype",
+		DefaultLayer:  "wof",
+		Properties: []string{
+			"wof:id",
+			"wof:name",
+			"wof:placetype",
+		},
+		Gzip:   false,
+		Writer: io.Discard,
+	}
+
+	return opts
+}
+
+func init() {
+	ctx := context.Background()
+	RegisterRenderer(ctx, "mvt", NewMVTRenderer)
+}
+
+// MVTRenderer implements the Renderer interface for producing Mapbox Vector Tiles.
+type MVTRenderer struct {
+	options *MVTOptions
+}
+
+var _ BufferedRenderer = (*MVTRenderer)(nil)
+var _ EncodedRenderer = (*MVTRenderer)(nil)
+
+// NewMVTRenderer returns a new MVTRenderer instance configured by 'uri' which is expected to take the form of:
+//
+//	mvt://?{PARAMETERS}
+//
+// Where {PARAMETERS} may be:
+// * `extent` The number of integer units along each side of the tile. Default is 4096.
+// * `buffer` The number of units that features are allowed to extend beyond the edges of the tile. Default is 64.
+// * `layer_property` The name of the property used to assign features to named layers. Default is "wof:placetype".
+// * `default_layer` The name of the layer for features without a layer property. Default is "wof".
+// * `property` Zero or more properties to include in the final tile. Default is "wof:id", "wof:name" and "wof:placetype". If the value is "*" then all properties are included.
+// * `gzip` A boolean flag signaling whether the final tile should be gzip-compressed. Default is false.
+func NewMVTRenderer(ctx context.Context, uri string) (Renderer, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	opts := DefaultMVTOptions()
+
+	uint_params := map[string]*uint32{
+		"extent": &opts.Extent,
+		"buffer": &opts.Buffer,
+	}
+
+	for k, ptr := range uint_params {
+
+		str_v := q.Get(k)
+
+		if str_v == "" {
+			continue
+		}
+
+		v, err := strconv.ParseUint(str_v, 10, 32)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?%s= parameter, %w", k, err)
+		}
+
+		*ptr = uint32(v)
+	}
+
+	if opts.Extent == 0 {
+		return nil, fmt.Errorf("Invalid ?extent= parameter")
+	}
+
+	_, ok := q["layer_property"]
+
+	if ok {
+		opts.LayerProperty = q.Get("layer_property")
+	}
+
+	if q.Get("default_layer") != "" {
+		opts.DefaultLayer = q.Get("default_layer")
+	}
+
+	props, ok := q["property"]
+
+	if ok {
+
+		if len(props) == 1 && props[0] == "*" {
+			props = nil
+		}
+
+		opts.Properties = props
+	}
+
+	str_gzip := q.Get("gzip")
+
+	if str_gzip != "" {
+
+		v, err := strconv.ParseBool(strings.ToLower(str_gzip))
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?gzip= parameter, %w", err)
+		}
+
+		opts.Gzip = v
+	}
+
+	r := &MVTRenderer{
+		options: opts,
+	}
+
+	return r, nil
+}
+
+// Render writes the Mapbox Vector Tile representation of 't', derived from 'features', to 'wr'.
+func (r *MVTRenderer) Render(ctx context.Context, wr io.Writer, g slippy.Grid, t maptile.Tile, features ...*geojson.Feature) error {
+
+	ext, err := extentForTile(g, t)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive tile extent, %w", err)
+	}
+
+	native_ext, err := nativeExtentForTile(g, t)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive native tile extent, %w", err)
+	}
+
+	opts := *r.options
+	opts.Grid = g
+	opts.TileExtent = ext
+	opts.NativeExtent = native_ext
+	opts.Writer = wr
+
+	return RenderMVTWithFeatures(ctx, &opts, features...)
+}
+
+// Extension returns the file extension for Mapbox Vector Tiles.
+func (r *MVTRenderer) Extension() string {
+	return "pbf"
+}
+
+// ContentType returns the content type for Mapbox Vector Tiles.
+func (r *MVTRenderer) ContentType() string {
+	return MVT_CONTENT_TYPE
+}
+
+// ContentEncoding returns "gzip" if the renderer gzip-compresses tiles or an empty string otherwise.
+func (r *MVTRenderer) ContentEncoding() string {
+
+	if r.options.Gzip {
+		return "gzip"
+	}
+
+	return ""
+}
+
+// Buffer returns the number of units, relative to the tile's extent, that features are allowed to extend beyond each
+// edge of a tile.
+func (r *MVTRenderer) Buffer() float64 {
+	return float64(r.options.Buffer)
+}
+
+// TileSize returns the number of integer units along each side of a tile.
+func (r *MVTRenderer) TileSize() float64 {
+	return float64(r.options.Extent)
+}
+
+// mvtLayer is an intermediate representation of a Mapbox Vector Tile layer used to assign the (deduplicated)
+// keys and values tables as features are added to it.
+type mvtLayer struct {
+	name       string
+	features   [][]byte
+	keys       []string
+	key_idx    map[string]uint32
+	values     [][]byte
+	values_idx map[string]uint32
+}
+
+// Render Mapbox Vector Tile (MVT) data for one or more geojson.Feature instances.
+func RenderMVTWithFeatures(ctx context.Context, opts *MVTOptions, features ...*geojson.Feature) error {
+
+	if opts.TileExtent == nil {
+		return fmt.Errorf("Missing tile extent")
+	}
+
+	if opts.Extent == 0 {
+		return fmt.Errorf("Invalid MVT extent")
+	}
+
+	extent := float64(opts.Extent)
+	buffer := float64(opts.Buffer)
+
+	proj, err := tileProjection(opts.Grid, opts.TileExtent, opts.NativeExtent, extent)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive tile projection, %w", err)
+	}
+
+	clip_bounds := orb.Bound{
+		Min: orb.Point{-buffer, -buffer},
+		Max: orb.Point{extent + buffer, extent + buffer},
+	}
+
+	layers := make(map[string]*mvtLayer)
+
+	for idx, f := range features {
+
+		if f.Geometry == nil {
+			continue
+		}
+
+		layer_name := opts.DefaultLayer
+
+		if opts.LayerProperty != "" {
+
+			v, ok := f.Properties[opts.LayerProperty].(string)
+
+			if ok && v != "" {
+				layer_name = v
+			}
+		}
+
+		l, ok := layers[layer_name]
+
+		if !ok {
+
+			l = &mvtLayer{
+				name:       layer_name,
+				features:   make([][]byte, 0),
+				keys:       make([]string, 0),
+				key_idx:    make(map[string]uint32),
+				values:     make([][]byte, 0),
+				values_idx: make(map[string]uint32),
+			}
+
+			layers[layer_name] = l
+		}
+
+		tile_geom := projectGeometry(f.Geometry, proj)
+		tile_geom = clip.Geometry(clip_bounds, tile_geom)
+
+		if tile_geom == nil {
+			continue
+		}
+
+		tags, err := l.tags(f.Properties, opts.Properties)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive tags for feature (at index %d), %w", idx, err)
+		}
+
+		id := mvtFeatureId(f)
+
+		for _, g := range flattenCollection(tile_geom) {
+
+			geom_type, commands := mvtGeometry(g)
+
+			if len(commands) == 0 {
+				continue
+			}
+
+			l.features = append(l.features, mvtFeature(id, tags, geom_type, commands))
+		}
+	}
+
+	names := make([]string, 0)
+
+	for name, l := range layers {
+
+		if len(l.features) == 0 {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var tile []byte
+
+	for _, name := range names {
+		tile = protowire.AppendTag(tile, mvt_tile_layers, protowire.BytesType)
+		tile = protowire.AppendBytes(tile, layers[name].encode(opts.Extent))
+	}
+
+	if !opts.Gzip {
+		_, err := opts.Writer.Write(tile)
+		return err
+	}
+
+	gz := gzip.NewWriter(opts.Writer)
+
+	_, err = gz.Write(tile)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write compressed tile, %w", err)
+	}
+
+	return gz.Close()
+}
+
+// tags returns the list of key/value pairs, as indices in the layer's keys and values tables, for 'props'.
+func (l *mvtLayer) tags(props geojson.Properties, include []string) ([]uint32, error) {
+
+	keys := make([]string, 0)
+
+	if len(include) > 0 {
+		keys = append(keys, include...)
+	} else {
+
+		for k, _ := range props {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+	}
+
+	tags := make([]uint32, 0)
+
+	for _, k := range keys {
+
+		v, ok := props[k]
+
+		if !ok || v == nil {
+			continue
+		}
+
+		enc_v, err := mvtValue(v)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode value for '%s', %w", k, err)
+		}
+
+		if enc_v == nil {
+			continue
+		}
+
+		k_idx, ok := l.key_idx[k]
+
+		if !ok {
+			k_idx = uint32(len(l.keys))
+			l.keys = append(l.keys, k)
+			l.key_idx[k] = k_idx
+		}
+
+		v_idx, ok := l.values_idx[string(enc_v)]
+
+		if !ok {
+			v_idx = uint32(len(l.values))
+			l.values = append(l.values, enc_v)
+			l.values_idx[string(enc_v)] = v_idx
+		}
+
+		tags = append(tags, k_idx, v_idx)
+	}
+
+	return tags, nil
+}
+
+// encode returns the protobuf-encoded representation of 'l'.
+func (l *mvtLayer) encode(extent uint32) []byte {
+
+	var b []byte
+
+	b = protowire.AppendTag(b, mvt_layer_version, protowire.VarintType)
+	b = protowire.AppendVarint(b, 2)
+
+	b = protowire.AppendTag(b, mvt_layer_name, protowire.BytesType)
+	b = protowire.AppendString(b, l.name)
+
+	for _, f := range l.features {
+		b = protowire.AppendTag(b, mvt_layer_features, protowire.BytesType)
+		b = protowire.AppendBytes(b, f)
+	}
+
+	for _, k := range l.keys {
+		b = protowire.AppendTag(b, mvt_layer_keys, protowire.BytesType)
+		b = protowire.AppendString(b, k)
+	}
+
+	for _, v := range l.values {
+		b = protowire.AppendTag(b, mvt_layer_values, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	}
+
+	b = protowire.AppendTag(b, mvt_layer_extent, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(extent))
+
+	return b
+}
+
+// mvtValue returns the protobuf-encoded Value message for 'v'. Non-scalar values are encoded as JSON strings.
+func mvtValue(v interface{}) ([]byte, error) {
+
+	var b []byte
+
+	switch v := v.(type) {
+	case string:
+		b = protowire.AppendTag(b, mvt_value_string, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	case bool:
+		b = protowire.AppendTag(b, mvt_value_bool, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case float64:
+
+		if v == math.Trunc(v) && math.Abs(v) < (1<<53) {
+			b = protowire.AppendTag(b, mvt_value_sint, protowire.VarintType)
+			b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(v)))
+		} else {
+			b = protowire.AppendTag(b, mvt_value_double, protowire.Fixed64Type)
+			b = protowire.AppendFixed64(b, math.Float64bits(v))
+		}
+
+	default:
+
+		enc, err := json.Marshal(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		b = protowire.AppendTag(b, mvt_value_string, protowire.BytesType)
+		b = protowire.AppendBytes(b, enc)
+	}
+
+	return b, nil
+}
+
+// mvtFeature returns the protobuf-encoded Feature message for the values passed in.
+func mvtFeature(id uint64, tags []uint32, geom_type uint64, commands []uint32) []byte {
+
+	var b []byte
+
+	if id > 0 {
+		b = protowire.AppendTag(b, mvt_feature_id, protowire.VarintType)
+		b = protowire.AppendVarint(b, id)
+	}
+
+	if len(tags) > 0 {
+		b = protowire.AppendTag(b, mvt_feature_tags, protowire.BytesType)
+		b = protowire.AppendBytes(b, packUint32(tags))
+	}
+
+	b = protowire.AppendTag(b, mvt_feature_type, protowire.VarintType)
+	b = protowire.AppendVarint(b, geom_type)
+
+	b = protowire.AppendTag(b, mvt_feature_geometry, protowire.BytesType)
+	b = protowire.AppendBytes(b, packUint32(commands))
+
+	return b
+}
+
+// mvtFeatureId returns the value of the "wof:id" property for 'f' or 0 if it is missing or negative.
+func mvtFeatureId(f *geojson.Feature) uint64 {
+
+	v, ok := f.Properties["wof:id"].(float64)
+
+	if !ok || v < 0 {
+		return 0
+	}
+
+	return uint64(v)
+}
+
+func packUint32(values []uint32) []byte {
+
+	var b []byte
+
+	for _, v := range values {
+		b = protowire.AppendVarint(b, uint64(v))
+	}
+
+	return b
+}
+
+// flattenCollection returns the list of non-collection geometries contained by 'g'.
+func flattenCollection(g orb.Geometry) []orb.Geometry {
+
+	c, ok := g.(orb.Collection)
+
+	if !ok {
+		return []orb.Geometry{g}
+	}
+
+	geoms := make([]orb.Geometry, 0)
+
+	for _, cg := range c {
+		geoms = append(geoms, flattenCollection(cg)...)
+	}
+
+	return geoms
+}
+
+// mvtGeometry returns the MVT geometry type and the list of (encoded) drawing commands for 'g' which is expected
+// to be in tile-local coordinates. If 'g' can not be represented, for example because it has collapsed to nothing
+// once rounded to integer coordinates, then an empty list of commands is returned.
+func mvtGeometry(g orb.Geometry) (uint64, []uint32) {
+
+	enc := &mvtEncoder{
+		commands: make([]uint32, 0),
+	}
+
+	switch g := g.(type) {
+	case orb.Point:
+		enc.points(orb.MultiPoint{g})
+		return mvt_geom_point, enc.commands
+	case orb.MultiPoint:
+		enc.points(g)
+		return mvt_geom_point, enc.commands
+	case orb.LineString:
+		enc.line(g)
+		return mvt_geom_linestring, enc.commands
+	case orb.MultiLineString:
+
+		for _, ls := range g {
+			enc.line(ls)
+		}
+
+		return mvt_geom_linestring, enc.commands
+
+	case orb.Ring:
+		enc.polygon(orb.Polygon{g})
+		return mvt_geom_polygon, enc.commands
+	case orb.Polygon:
+		enc.polygon(g)
+		return mvt_geom_polygon, enc.commands
+	case orb.MultiPolygon:
+
+		for _, p := range g {
+			enc.polygon(p)
+		}
+
+		return mvt_geom_polygon, enc.commands
+
+	case orb.Bound:
+		enc.polygon(g.ToPolygon())
+		return mvt_geom_polygon, enc.commands
+	default:
+		return 0, nil
+	}
+}
+
+// mvtEncoder encodes MVT drawing commands keeping track of the cursor position, which all
+// parameters are relative to.
+type mvtEncoder struct {
+	commands []uint32
+	x        int64
+	y        int64
+}
+
+func (enc *mvtEncoder) command(id uint32, count int) {
+	enc.commands = append(enc.commands, (id&0x7)|(uint32(count)<<3))
+}
+
+func (enc *mvtEncoder) parameters(pt [2]int64) {
+	enc.commands = append(enc.commands, uint32(protowire.EncodeZigZag(pt[0]-enc.x)), uint32(protowire.EncodeZigZag(pt[1]-enc.y)))
+	enc.x = pt[0]
+	enc.y = pt[1]
+}
+
+func (enc *mvtEncoder) points(mp orb.MultiPoint) {
+
+	pts := roundPoints(mp)
+
+	if len(pts) == 0 {
+		return
+	}
+
+	enc.command(mvt_cmd_moveto, len(pts))
+
+	for _, pt := range pts {
+		enc.parameters(pt)
+	}
+}
+
+func (enc *mvtEncoder) line(ls orb.LineString) {
+
+	pts := dedupePoints(roundPoints(orb.MultiPoint(ls)))
+
+	if len(pts) < 2 {
+		return
+	}
+
+	enc.command(mvt_cmd_moveto, 1)
+	enc.parameters(pts[0])
+
+	enc.command(mvt_cmd_lineto, len(pts)-1)
+
+	for _, pt := range pts[1:] {
+		enc.parameters(pt)
+	}
+}
+
+func (enc *mvtEncoder) polygon(p orb.Polygon) {
+
+	for i, r := range p {
+
+		pts := dedupePoints(roundPoints(orb.MultiPoint(r)))
+
+		// Drop the closing point, ClosePath takes care of that
+
+		if len(pts) > 1 && pts[0] == pts[len(pts)-1] {
+			pts = pts[:len(pts)-1]
+		}
+
+		if len(pts) < 3 {
+
+			// An exterior ring that has collapsed takes its interior rings with it
+
+			if i == 0 {
+				return
+			}
+
+			continue
+		}
+
+		// The spec requires exterior rings to have a positive area, and interior rings a negative
+		// one, in tile coordinates (where y increases downwards).
+
+		area := ringArea(pts)
+
+		if area == 0 {
+
+			if i == 0 {
+				return
+			}
+
+			continue
+		}
+
+		if (i == 0 && area < 0) || (i > 0 && area > 0) {
+
+			for a, b := 0, len(pts)-1; a < b; a, b = a+1, b-1 {
+				pts[a], pts[b] = pts[b], pts[a]
+			}
+		}
+
+		enc.command(mvt_cmd_moveto, 1)
+		enc.parameters(pts[0])
+
+		enc.command(mvt_cmd_lineto, len(pts)-1)
+
+		for _, pt := range pts[1:] {
+			enc.parameters(pt)
+		}
+
+		enc.command(mvt_cmd_closepath, 1)
+	}
+}
+
+func roundPoints(mp orb.MultiPoint) [][2]int64 {
+
+	pts := make([][2]int64, len(mp))
+
+	for i, pt := range mp {
+		pts[i] = [2]int64{int64(math.Round(pt.X())), int64(math.Round(pt.Y()))}
+	}
+
+	return pts
+}
+
+func dedupePoints(pts [][2]int64) [][2]int64 {
+
+	if len(pts) == 0 {
+		return pts
+	}
+
+	deduped := [][2]int64{pts[0]}
+
+	for _, pt := range pts[1:] {
+
+		if pt != deduped[len(deduped)-1] {
+			deduped = append(deduped, pt)
+		}
+	}
+
+	return deduped
+}
+
+// ringArea returns twice the signed area of the (implicitly closed) ring defined by 'pts'.
+func ringArea(pts [][2]int64) int64 {
+
+	var area int64
+
+	for i := range pts {
+		j := (i + 1) % len(pts)
+		area += pts[i][0]*pts[j][1] - pts[j][0]*pts[i][1]
+	}
+
+	return area
+}
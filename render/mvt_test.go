@@ -0,0 +1,673 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"testing"
+)
+
+// mvtTestLayer is a decoded Mapbox Vector Tile layer.
+type mvtTestLayer struct {
+	Name     string
+	Version  uint64
+	Extent   uint64
+	Keys     []string
+	Values   []interface{}
+	Features []*mvtTestFeature
+}
+
+// mvtTestFeature is a decoded Mapbox Vector Tile feature.
+type mvtTestFeature struct {
+	Id       uint64
+	Tags     []uint32
+	Type     uint64
+	Geometry []uint32
+}
+
+func TestMVTCommands(t *testing.T) {
+
+	// The point at 0,0 is the centre of tile 0/0/0 and the latitude of 66.51326... degrees is one quarter of the way
+	// down the tile so all of the coordinates below fall exactly on tile units.
+
+	lat := 66.51326044311186
+
+	tests := []struct {
+		Name     string
+		Geometry string
+		Type     uint64
+		Commands []uint32
+	}{
+		{
+			Name:     "point",
+			Geometry: `{"type":"Point","coordinates":[0,0]}`,
+			Type:     mvt_geom_point,
+			// MoveTo(1) +2048,+2048
+			Commands: []uint32{9, 4096, 4096},
+		},
+		{
+			Name:     "multipoint",
+			Geometry: `{"type":"MultiPoint","coordinates":[[0,0],[-90,0]]}`,
+			Type:     mvt_geom_point,
+			// MoveTo(2) +2048,+2048 -1024,+0
+			Commands: []uint32{17, 4096, 4096, 2047, 0},
+		},
+		{
+			Name:     "linestring",
+			Geometry: `{"type":"LineString","coordinates":[[-90,0],[90,0]]}`,
+			Type:     mvt_geom_linestring,
+			// MoveTo(1) +1024,+2048 LineTo(1) +2048,+0
+			Commands: []uint32{9, 2048, 4096, 10, 4096, 0},
+		},
+		{
+			Name:     "polygon",
+			Geometry: fmt.Sprintf(`{"type":"Polygon","coordinates":[[[-90,0],[0,0],[0,%f],[-90,%f],[-90,0]]]}`, lat, lat),
+			Type:     mvt_geom_polygon,
+			// The ring is wound anti-clockwise in tile coordinates so it is reversed to give the exterior ring a
+			// positive area: MoveTo(1) +1024,+1024 LineTo(3) +1024,+0 +0,+1024 -1024,+0 ClosePath(1)
+			Commands: []uint32{9, 2048, 2048, 26, 2048, 0, 0, 2048, 2047, 0, 15},
+		},
+	}
+
+	ctx := context.Background()
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			layers := renderMVT(t, ctx, "mvt://", maptile.New(0, 0, 0), mvtTestFeatureJSON(1, "locality", test.Geometry))
+
+			if len(layers) != 1 || len(layers[0].Features) != 1 {
+				t.Fatalf("Expected a single layer with a single feature")
+			}
+
+			f := layers[0].Features[0]
+
+			if f.Type != test.Type {
+				t.Fatalf("Expected geometry type %d, got %d", test.Type, f.Type)
+			}
+
+			if fmt.Sprintf("%v", f.Geometry) != fmt.Sprintf("%v", test.Commands) {
+				t.Fatalf("Expected commands %v, got %v", test.Commands, f.Geometry)
+			}
+		})
+	}
+}
+
+func TestMVTLayers(t *testing.T) {
+
+	features := [][]byte{
+		mvtTestFeatureJSON(3, "neighbourhood", `{"type":"Point","coordinates":[1,1]}`),
+		mvtTestFeatureJSON(1, "locality", `{"type":"Point","coordinates":[-1,-1]}`),
+		mvtTestFeatureJSON(2, "locality", `{"type":"Point","coordinates":[1,-1]}`),
+		mvtTestFeatureJSON(4, "", `{"type":"Point","coordinates":[-1,1]}`),
+	}
+
+	ctx := context.Background()
+
+	layers := renderMVT(t, ctx, "mvt://?extent=512&buffer=8", maptile.New(0, 0, 0), features...)
+
+	expected := []struct {
+		Name string
+		Ids  []uint64
+	}{
+		{Name: "locality", Ids: []uint64{1, 2}},
+		{Name: "neighbourhood", Ids: []uint64{3}},
+		{Name: "wof", Ids: []uint64{4}},
+	}
+
+	if len(layers) != len(expected) {
+		t.Fatalf("Expected %d layers, got %d", len(expected), len(layers))
+	}
+
+	for i, e := range expected {
+
+		l := layers[i]
+
+		if l.Name != e.Name {
+			t.Fatalf("Expected layer %d to be named '%s', got '%s'", i, e.Name, l.Name)
+		}
+
+		if l.Version != 2 {
+			t.Fatalf("Expected version 2 for layer '%s', got %d", l.Name, l.Version)
+		}
+
+		if l.Extent != 512 {
+			t.Fatalf("Expected extent of 512 for layer '%s', got %d", l.Name, l.Extent)
+		}
+
+		if len(l.Features) != len(e.Ids) {
+			t.Fatalf("Expected %d features in layer '%s', got %d", len(e.Ids), l.Name, len(l.Features))
+		}
+
+		for j, f := range l.Features {
+
+			if f.Id != e.Ids[j] {
+				t.Fatalf("Expected feature %d in layer '%s' to have ID %d, got %d", j, l.Name, e.Ids[j], f.Id)
+			}
+
+			props, err := l.properties(f)
+
+			if err != nil {
+				t.Fatalf("Failed to decode properties for feature %d in layer '%s', %v", f.Id, l.Name, err)
+			}
+
+			if props["wof:id"] != int64(f.Id) {
+				t.Fatalf("Expected wof:id property of %d, got %v", f.Id, props["wof:id"])
+			}
+
+			if props["wof:name"] != fmt.Sprintf("Feature %d", f.Id) {
+				t.Fatalf("Unexpected wof:name property '%v' for feature %d", props["wof:name"], f.Id)
+			}
+		}
+	}
+
+	// Keys and values shared by features in the same layer are only encoded once
+
+	locality := layers[0]
+
+	if len(locality.Keys) != 3 {
+		t.Fatalf("Expected 3 keys in locality layer, got %v", locality.Keys)
+	}
+
+	if len(locality.Values) != 5 {
+		t.Fatalf("Expected 5 values in locality layer, got %v", locality.Values)
+	}
+}
+
+func TestMVTBufferClipping(t *testing.T) {
+
+	// Tile 2/1/1 spans -90 to 0 degrees longitude and 0 to 66.51326... degrees latitude so, with an extent of 4096,
+	// each degree of longitude is 45.5 tile units and a buffer of 64 units extends about 1.4 degrees beyond the
+	// western and eastern edges of the tile.
+
+	tests := []struct {
+		Name     string
+		Geometry string
+		Empty    bool
+		Check    func(paths [][][2]int64, closes int) error
+	}{
+		{
+			Name:     "point inside buffer",
+			Geometry: `{"type":"Point","coordinates":[-91,45]}`,
+			Check: func(paths [][][2]int64, closes int) error {
+
+				if paths[0][0][0] != -46 {
+					return fmt.Errorf("Expected x coordinate of -46, got %d", paths[0][0][0])
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:     "point outside buffer",
+			Geometry: `{"type":"Point","coordinates":[-92,45]}`,
+			Empty:    true,
+		},
+		{
+			Name:     "line crossing buffer",
+			Geometry: `{"type":"LineString","coordinates":[[-180,45],[-45,45]]}`,
+			Check: func(paths [][][2]int64, closes int) error {
+
+				if len(paths) != 1 || len(paths[0]) != 2 {
+					return fmt.Errorf("Expected a single line with two points, got %v", paths)
+				}
+
+				start := paths[0][0]
+				end := paths[0][1]
+
+				if start[0] != -64 || end[0] != 2048 || start[1] != end[1] {
+					return fmt.Errorf("Expected line to be clipped to the buffer, got %v", paths[0])
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:     "polygon larger than tile",
+			Geometry: `{"type":"Polygon","coordinates":[[[-100,-10],[10,-10],[10,80],[-100,80],[-100,-10]]]}`,
+			Check: func(paths [][][2]int64, closes int) error {
+
+				if len(paths) != 1 || closes != 1 {
+					return fmt.Errorf("Expected a single closed ring, got %v", paths)
+				}
+
+				for _, pt := range paths[0] {
+
+					for _, v := range pt {
+
+						if v != -64 && v != 4160 {
+							return fmt.Errorf("Expected ring to be clipped to the buffer, got %v", paths[0])
+						}
+					}
+				}
+
+				return nil
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			layers := renderMVT(t, ctx, "mvt://?buffer=64", maptile.New(1, 1, 2), mvtTestFeatureJSON(1, "locality", test.Geometry))
+
+			if test.Empty {
+
+				if len(layers) != 0 {
+					t.Fatalf("Expected feature to be clipped from the tile")
+				}
+
+				return
+			}
+
+			if len(layers) != 1 || len(layers[0].Features) != 1 {
+				t.Fatalf("Expected a single layer with a single feature")
+			}
+
+			paths, closes, err := decodeMVTGeometry(layers[0].Features[0].Geometry)
+
+			if err != nil {
+				t.Fatalf("Failed to decode geometry, %v", err)
+			}
+
+			err = test.Check(paths, closes)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// mvtTestFeatureJSON returns a GeoJSON Feature, with ID 'id' and placetype 'placetype', for 'geom'.
+func mvtTestFeatureJSON(id int64, placetype string, geom string) []byte {
+	return []byte(fmt.Sprintf(`{"type":"Feature","properties":{"wof:id":%d,"wof:name":"Feature %d","wof:placetype":"%s"},"geometry":%s}`, id, id, placetype, geom))
+}
+
+// renderMVT renders 'features' for 't', on a web mercator grid, using a renderer created from 'uri' and returns the
+// decoded layers.
+func renderMVT(t *testing.T, ctx context.Context, uri string, tile maptile.Tile, features ...[]byte) []*mvtTestLayer {
+
+	r, err := NewMVTRenderer(ctx, uri)
+
+	if err != nil {
+		t.Fatalf("Failed to create renderer, %v", err)
+	}
+
+	g, err := tiles.NewGrid(tiles.SRID_WEB_MERCATOR)
+
+	if err != nil {
+		t.Fatalf("Failed to create grid, %v", err)
+	}
+
+	geojson_features := make([]*geojson.Feature, len(features))
+
+	for i, body := range features {
+
+		f, err := geojson.UnmarshalFeature(body)
+
+		if err != nil {
+			t.Fatalf("Failed to unmarshal feature, %v", err)
+		}
+
+		geojson_features[i] = f
+	}
+
+	var buf bytes.Buffer
+
+	err = r.Render(ctx, &buf, g, tile, geojson_features...)
+
+	if err != nil {
+		t.Fatalf("Failed to render tile, %v", err)
+	}
+
+	layers, err := decodeMVT(buf.Bytes())
+
+	if err != nil {
+		t.Fatalf("Failed to decode tile, %v", err)
+	}
+
+	return layers
+}
+
+// decodeMVT decodes the layers in the Mapbox Vector Tile 'b'.
+func decodeMVT(b []byte) ([]*mvtTestLayer, error) {
+
+	layers := make([]*mvtTestLayer, 0)
+
+	err := consumeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+
+		if num != mvt_tile_layers || typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+
+		v, n := protowire.ConsumeBytes(b)
+
+		if n < 0 {
+			return n, nil
+		}
+
+		l, err := decodeMVTLayer(v)
+
+		if err != nil {
+			return 0, err
+		}
+
+		layers = append(layers, l)
+		return n, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return layers, nil
+}
+
+// decodeMVTLayer decodes the Layer message 'b'.
+func decodeMVTLayer(b []byte) (*mvtTestLayer, error) {
+
+	l := &mvtTestLayer{
+		Keys:     make([]string, 0),
+		Values:   make([]interface{}, 0),
+		Features: make([]*mvtTestFeature, 0),
+	}
+
+	err := consumeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+
+		switch num {
+		case mvt_layer_version, mvt_layer_extent:
+
+			v, n := protowire.ConsumeVarint(b)
+
+			if num == mvt_layer_version {
+				l.Version = v
+			} else {
+				l.Extent = v
+			}
+
+			return n, nil
+
+		case mvt_layer_name, mvt_layer_keys:
+
+			v, n := protowire.ConsumeString(b)
+
+			if num == mvt_layer_name {
+				l.Name = v
+			} else {
+				l.Keys = append(l.Keys, v)
+			}
+
+			return n, nil
+
+		case mvt_layer_values:
+
+			v, n := protowire.ConsumeBytes(b)
+
+			if n < 0 {
+				return n, nil
+			}
+
+			value, err := decodeMVTValue(v)
+
+			if err != nil {
+				return 0, err
+			}
+
+			l.Values = append(l.Values, value)
+			return n, nil
+
+		case mvt_layer_features:
+
+			v, n := protowire.ConsumeBytes(b)
+
+			if n < 0 {
+				return n, nil
+			}
+
+			f, err := decodeMVTFeature(v)
+
+			if err != nil {
+				return 0, err
+			}
+
+			l.Features = append(l.Features, f)
+			return n, nil
+
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// decodeMVTValue decodes the Value message 'b'.
+func decodeMVTValue(b []byte) (interface{}, error) {
+
+	var value interface{}
+
+	err := consumeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+
+		switch num {
+		case mvt_value_string:
+			v, n := protowire.ConsumeString(b)
+			value = v
+			return n, nil
+		case mvt_value_double:
+			v, n := protowire.ConsumeFixed64(b)
+			value = math.Float64frombits(v)
+			return n, nil
+		case mvt_value_sint:
+			v, n := protowire.ConsumeVarint(b)
+			value = protowire.DecodeZigZag(v)
+			return n, nil
+		case mvt_value_bool:
+			v, n := protowire.ConsumeVarint(b)
+			value = protowire.DecodeBool(v)
+			return n, nil
+		default:
+			return 0, fmt.Errorf("Unexpected value type %d", num)
+		}
+	})
+
+	return value, err
+}
+
+// decodeMVTFeature decodes the Feature message 'b'.
+func decodeMVTFeature(b []byte) (*mvtTestFeature, error) {
+
+	f := &mvtTestFeature{}
+
+	err := consumeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+
+		switch num {
+		case mvt_feature_id, mvt_feature_type:
+
+			v, n := protowire.ConsumeVarint(b)
+
+			if num == mvt_feature_id {
+				f.Id = v
+			} else {
+				f.Type = v
+			}
+
+			return n, nil
+
+		case mvt_feature_tags, mvt_feature_geometry:
+
+			v, n := protowire.ConsumeBytes(b)
+
+			if n < 0 {
+				return n, nil
+			}
+
+			packed, err := decodePackedUint32(v)
+
+			if err != nil {
+				return 0, err
+			}
+
+			if num == mvt_feature_tags {
+				f.Tags = packed
+			} else {
+				f.Geometry = packed
+			}
+
+			return n, nil
+
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// decodeMVTGeometry decodes the drawing commands in 'commands' returning the list of paths, in absolute tile
+// coordinates, started by each MoveTo command and the number of ClosePath commands.
+func decodeMVTGeometry(commands []uint32) ([][][2]int64, int, error) {
+
+	paths := make([][][2]int64, 0)
+	closes := 0
+
+	var x int64
+	var y int64
+
+	for i := 0; i < len(commands); {
+
+		id := commands[i] & 0x7
+		count := int(commands[i] >> 3)
+		i += 1
+
+		if id == mvt_cmd_closepath {
+
+			if count != 1 || len(paths) == 0 {
+				return nil, 0, fmt.Errorf("Invalid ClosePath command")
+			}
+
+			closes += 1
+			continue
+		}
+
+		if id != mvt_cmd_moveto && id != mvt_cmd_lineto {
+			return nil, 0, fmt.Errorf("Unknown command %d", id)
+		}
+
+		if count == 0 || i+count*2 > len(commands) {
+			return nil, 0, fmt.Errorf("Invalid parameter count for command %d", id)
+		}
+
+		if id == mvt_cmd_lineto && len(paths) == 0 {
+			return nil, 0, fmt.Errorf("LineTo command before MoveTo command")
+		}
+
+		for j := 0; j < count; j++ {
+
+			x += protowire.DecodeZigZag(uint64(commands[i]))
+			y += protowire.DecodeZigZag(uint64(commands[i+1]))
+			i += 2
+
+			pt := [2]int64{x, y}
+
+			if id == mvt_cmd_moveto {
+				paths = append(paths, [][2]int64{pt})
+			} else {
+				paths[len(paths)-1] = append(paths[len(paths)-1], pt)
+			}
+		}
+	}
+
+	return paths, closes, nil
+}
+
+// properties returns the properties for 'f' derived from its tags and the keys and values tables of 'l'.
+func (l *mvtTestLayer) properties(f *mvtTestFeature) (map[string]interface{}, error) {
+
+	if len(f.Tags)%2 != 0 {
+		return nil, fmt.Errorf("Odd number of tags")
+	}
+
+	props := make(map[string]interface{})
+
+	for i := 0; i < len(f.Tags); i += 2 {
+
+		k := int(f.Tags[i])
+		v := int(f.Tags[i+1])
+
+		if k >= len(l.Keys) || v >= len(l.Values) {
+			return nil, fmt.Errorf("Tag index out of range")
+		}
+
+		props[l.Keys[k]] = l.Values[v]
+	}
+
+	return props, nil
+}
+
+// decodePackedUint32 decodes the packed list of varints in 'b'.
+func decodePackedUint32(b []byte) ([]uint32, error) {
+
+	values := make([]uint32, 0)
+
+	for len(b) > 0 {
+
+		v, n := protowire.ConsumeVarint(b)
+
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+
+		values = append(values, uint32(v))
+		b = b[n:]
+	}
+
+	return values, nil
+}
+
+// consumeMessage invokes 'cb' for each field in the protobuf message 'b'. The callback returns the number of bytes
+// consumed for the field's value, or a negative value if the field could not be parsed.
+func consumeMessage(b []byte, cb func(protowire.Number, protowire.Type, []byte) (int, error)) error {
+
+	for len(b) > 0 {
+
+		num, typ, n := protowire.ConsumeTag(b)
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		b = b[n:]
+
+		n, err := cb(num, typ, b)
+
+		if err != nil {
+			return err
+		}
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		b = b[n:]
+	}
+
+	return nil
+}
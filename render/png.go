@@ -0,0 +1,416 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PNG_CONTENT_TYPE is the content type for PNG data.
+const PNG_CONTENT_TYPE string = "image/png"
+
+// The number of sides used to approximate circles (points and round line joins).
+const circle_segments int = 16
+
+// The radius, in pixels, used to draw points. This matches the value used by go-geojson-svg.
+const point_radius float64 = 1.0
+
+func init() {
+	ctx := context.Background()
+	RegisterRenderer(ctx, "png", NewPNGRenderer)
+}
+
+// PNGRenderer implements the Renderer interface for producing PNG tiles.
+type PNGRenderer struct {
+	options *SVGOptions
+}
+
+var _ BufferedRenderer = (*PNGRenderer)(nil)
+
+// NewPNGRenderer returns a new PNGRenderer instance configured by 'uri' which is expected to take the form of:
+//
+//	png://?{PARAMETERS}
+//
+// Where {PARAMETERS} are any of the query parameters supported by the SVGOptionsWithURI method.
+func NewPNGRenderer(ctx context.Context, uri string) (Renderer, error) {
+
+	opts, err := SVGOptionsWithURI(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive PNG options, %w", err)
+	}
+
+	_, err = parseColor(opts.Stroke)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid stroke colour, %w", err)
+	}
+
+	_, err = parseColor(opts.Fill)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid fill colour, %w", err)
+	}
+
+	r := &PNGRenderer{
+		options: opts,
+	}
+
+	return r, nil
+}
+
+// Render writes the PNG representation of 't', derived from 'features', to 'wr'.
+func (r *PNGRenderer) Render(ctx context.Context, wr io.Writer, g slippy.Grid, t maptile.Tile, features ...*geojson.Feature) error {
+
+	ext, err := extentForTile(g, t)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive tile extent, %w", err)
+	}
+
+	native_ext, err := nativeExtentForTile(g, t)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive native tile extent, %w", err)
+	}
+
+	opts := *r.options
+	opts.Grid = g
+	opts.TileExtent = ext
+	opts.NativeExtent = native_ext
+	opts.Writer = wr
+
+	return RenderPNGWithFeatures(ctx, &opts, features...)
+}
+
+// Extension returns the file extension for PNG tiles.
+func (r *PNGRenderer) Extension() string {
+	return "png"
+}
+
+// ContentType returns the content type for PNG tiles.
+func (r *PNGRenderer) ContentType() string {
+	return PNG_CONTENT_TYPE
+}
+
+// Buffer returns the number of pixels that features are expected to extend beyond each edge of a tile.
+func (r *PNGRenderer) Buffer() float64 {
+	return r.options.Buffer
+}
+
+// TileSize returns the size, in pixels, of PNG tiles.
+func (r *PNGRenderer) TileSize() float64 {
+	return r.options.TileSize
+}
+
+// Render PNG data for one or more geojson.Feature instances. Features are drawn using the same styling rules
+// (stroke, fill, opacities, tile size and buffer) as the RenderSVGWithFeatures method. Unlike RenderSVGWithFeatures a
+// valid opts.TileExtent is required.
+func RenderPNGWithFeatures(ctx context.Context, opts *SVGOptions, features ...*geojson.Feature) error {
+
+	if opts.TileExtent == nil {
+		return fmt.Errorf("Missing tile extent")
+	}
+
+	stroke, err := parseColor(opts.Stroke)
+
+	if err != nil {
+		return fmt.Errorf("Invalid stroke colour, %w", err)
+	}
+
+	fill, err := parseColor(opts.Fill)
+
+	if err != nil {
+		return fmt.Errorf("Invalid fill colour, %w", err)
+	}
+
+	size := int(opts.TileSize)
+
+	if size <= 0 {
+		return fmt.Errorf("Invalid tile size")
+	}
+
+	proj, err := tileProjection(opts.Grid, opts.TileExtent, opts.NativeExtent, opts.TileSize)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive tile projection, %w", err)
+	}
+
+	im := image.NewRGBA(image.Rect(0, 0, size, size))
+	r := newRasterizer(size, size)
+
+	half_width := opts.StrokeWidth / 2.0
+
+	clip := clipBounds(opts.TileSize, opts.Buffer)
+
+	is_clip_edge := func(a orb.Point, b orb.Point) bool {
+		return isClipEdge(a, b, clip)
+	}
+
+	for _, f := range features {
+
+		if f.Geometry == nil {
+			continue
+		}
+
+		tile_geom := projectGeometry(f.Geometry, proj)
+
+		for _, g := range flattenCollection(tile_geom) {
+
+			fills, strokes := rasterPaths(g)
+
+			// Don't stroke the edges of polygons that were created by cropping them to the tile.
+
+			outlines, clipped := polygonOutlines(g, is_clip_edge)
+
+			if clipped {
+
+				strokes = make([][][2]float64, len(outlines))
+
+				for i, ls := range outlines {
+					strokes[i] = toPath(ls)
+				}
+			}
+
+			if fill[3] > 0 && opts.FillOpacity > 0 && len(fills) > 0 {
+
+				r.reset()
+
+				for _, p := range fills {
+					r.path(p)
+				}
+
+				r.composite(im, fill, opts.FillOpacity)
+			}
+
+			if stroke[3] > 0 && opts.StrokeOpacity > 0 && half_width > 0 && len(strokes) > 0 {
+
+				r.reset()
+
+				for _, p := range strokes {
+					strokePath(r, p, half_width)
+				}
+
+				r.composite(im, stroke, opts.StrokeOpacity)
+			}
+		}
+	}
+
+	return png.Encode(opts.Writer, im)
+}
+
+// rasterPaths returns the list of closed paths to fill and the list of open paths to stroke for 'g' which is
+// expected to be in tile-local (pixel) coordinates. Polygon rings are oriented so that interior rings wind in the
+// opposite direction of their exterior ring, which is what allows the (non-zero) rasterizer to punch holes.
+func rasterPaths(g orb.Geometry) ([][][2]float64, [][][2]float64) {
+
+	fills := make([][][2]float64, 0)
+	strokes := make([][][2]float64, 0)
+
+	switch g := g.(type) {
+	case orb.Point:
+		c := circlePath(g, point_radius)
+		fills = append(fills, c)
+		strokes = append(strokes, append(c, c[0]))
+	case orb.MultiPoint:
+
+		for _, pt := range g {
+			c := circlePath(pt, point_radius)
+			fills = append(fills, c)
+			strokes = append(strokes, append(c, c[0]))
+		}
+
+	case orb.LineString:
+		strokes = append(strokes, toPath(g))
+	case orb.MultiLineString:
+
+		for _, ls := range g {
+			strokes = append(strokes, toPath(ls))
+		}
+
+	case orb.Ring:
+		return rasterPaths(orb.Polygon{g})
+	case orb.Polygon:
+
+		for i, ring := range g {
+
+			p := toPath(ring)
+
+			if len(p) > 1 && p[0] == p[len(p)-1] {
+				p = p[:len(p)-1]
+			}
+
+			if len(p) < 3 {
+				continue
+			}
+
+			area := pathArea(p)
+
+			if (i == 0 && area < 0) || (i > 0 && area > 0) {
+				reversePath(p)
+			}
+
+			fills = append(fills, p)
+			strokes = append(strokes, append(p, p[0]))
+		}
+
+	case orb.MultiPolygon:
+
+		for _, poly := range g {
+			poly_fills, poly_strokes := rasterPaths(poly)
+			fills = append(fills, poly_fills...)
+			strokes = append(strokes, poly_strokes...)
+		}
+
+	case orb.Bound:
+		return rasterPaths(g.ToPolygon())
+	}
+
+	return fills, strokes
+}
+
+// strokePath adds the outline of the (open) path 'p', with a width of 'half_width' * 2, to 'r'. Each segment is
+// added as a quadrilateral and each vertex as a circle (round joins and caps) all with the same orientation so the
+// rasterizer unions them.
+func strokePath(r *rasterizer, p [][2]float64, half_width float64) {
+
+	for i, pt := range p {
+
+		r.path(circlePath(orb.Point(pt), half_width))
+
+		if i == 0 {
+			continue
+		}
+
+		prev := p[i-1]
+
+		dx := pt[0] - prev[0]
+		dy := pt[1] - prev[1]
+		l := math.Hypot(dx, dy)
+
+		if l == 0 {
+			continue
+		}
+
+		nx := -dy / l * half_width
+		ny := dx / l * half_width
+
+		quad := [][2]float64{
+			{prev[0] + nx, prev[1] + ny},
+			{pt[0] + nx, pt[1] + ny},
+			{pt[0] - nx, pt[1] - ny},
+			{prev[0] - nx, prev[1] - ny},
+		}
+
+		if pathArea(quad) < 0 {
+			reversePath(quad)
+		}
+
+		r.path(quad)
+	}
+}
+
+func circlePath(center orb.Point, radius float64) [][2]float64 {
+
+	p := make([][2]float64, circle_segments)
+
+	for i := 0; i < circle_segments; i++ {
+		a := 2 * math.Pi * float64(i) / float64(circle_segments)
+		p[i] = [2]float64{center.X() + radius*math.Cos(a), center.Y() + radius*math.Sin(a)}
+	}
+
+	return p
+}
+
+func toPath(ls []orb.Point) [][2]float64 {
+
+	p := make([][2]float64, len(ls))
+
+	for i, pt := range ls {
+		p[i] = [2]float64(pt)
+	}
+
+	return p
+}
+
+// pathArea returns twice the signed area of the (implicitly closed) path 'p'.
+func pathArea(p [][2]float64) float64 {
+
+	area := 0.0
+
+	for i := range p {
+		j := (i + 1) % len(p)
+		area += p[i][0]*p[j][1] - p[j][0]*p[i][1]
+	}
+
+	return area
+}
+
+func reversePath(p [][2]float64) {
+
+	for a, b := 0, len(p)-1; a < b; a, b = a+1, b-1 {
+		p[a], p[b] = p[b], p[a]
+	}
+}
+
+// parseColor returns the (non-premultiplied) RGBA values, in the range of 0-1, for an SVG colour string. Hex
+// values (#rgb and #rrggbb), a handful of common colour names and "none" are supported.
+func parseColor(str_color string) ([4]float64, error) {
+
+	str_color = strings.ToLower(strings.TrimSpace(str_color))
+
+	switch str_color {
+	case "", "none", "transparent":
+		return [4]float64{0, 0, 0, 0}, nil
+	case "black":
+		str_color = "#000000"
+	case "white":
+		str_color = "#ffffff"
+	case "red":
+		str_color = "#ff0000"
+	case "green":
+		str_color = "#008000"
+	case "blue":
+		str_color = "#0000ff"
+	case "gray", "grey":
+		str_color = "#808080"
+	}
+
+	if !strings.HasPrefix(str_color, "#") {
+		return [4]float64{}, fmt.Errorf("Unsupported colour '%s'", str_color)
+	}
+
+	hex := strings.TrimPrefix(str_color, "#")
+
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	if len(hex) != 6 {
+		return [4]float64{}, fmt.Errorf("Invalid colour '%s'", str_color)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+
+	if err != nil {
+		return [4]float64{}, fmt.Errorf("Invalid colour '%s', %w", str_color, err)
+	}
+
+	rgba := [4]float64{
+		float64((v>>16)&0xff) / 255.0,
+		float64((v>>8)&0xff) / 255.0,
+		float64(v&0xff) / 255.0,
+		1.0,
+	}
+
+	return rgba, nil
+}
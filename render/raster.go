@@ -0,0 +1,187 @@
+package render
+
+import (
+	"image"
+	"math"
+)
+
+// rasterizer is a minimal anti-aliasing scanline rasterizer. It accumulates the signed area covered by each
+// line segment in a path (the same technique used by font-rs and golang.org/x/image/vector) so that the coverage
+// for every pixel can be derived with a single pass over each row. Paths are filled using the non-zero winding
+// rule so overlapping shapes with the same orientation are unioned.
+type rasterizer struct {
+	width  int
+	height int
+	stride int
+	acc    []float64
+	min_y  int
+	max_y  int
+}
+
+func newRasterizer(width int, height int) *rasterizer {
+
+	stride := width + 2
+
+	r := &rasterizer{
+		width:  width,
+		height: height,
+		stride: stride,
+		acc:    make([]float64, stride*height),
+	}
+
+	r.reset()
+	return r
+}
+
+// reset clears any accumulated paths.
+func (r *rasterizer) reset() {
+
+	if r.min_y <= r.max_y {
+
+		for i := r.min_y * r.stride; i < (r.max_y+1)*r.stride; i++ {
+			r.acc[i] = 0
+		}
+	}
+
+	r.min_y = r.height
+	r.max_y = -1
+}
+
+// path adds the (implicitly closed) path defined by 'pts' to the rasterizer.
+func (r *rasterizer) path(pts [][2]float64) {
+
+	if len(pts) < 2 {
+		return
+	}
+
+	for i := range pts {
+		j := (i + 1) % len(pts)
+		r.line(pts[i], pts[j])
+	}
+}
+
+// line adds the line segment from 'p0' to 'p1' to the rasterizer.
+func (r *rasterizer) line(p0 [2]float64, p1 [2]float64) {
+
+	if p0[1] == p1[1] || math.IsNaN(p0[0]) || math.IsNaN(p0[1]) || math.IsNaN(p1[0]) || math.IsNaN(p1[1]) {
+		return
+	}
+
+	dir := 1.0
+
+	if p0[1] > p1[1] {
+		dir = -1.0
+		p0, p1 = p1, p0
+	}
+
+	dxdy := (p1[0] - p0[0]) / (p1[1] - p0[1])
+	x := p0[0]
+
+	if p0[1] < 0 {
+		x -= p0[1] * dxdy
+	}
+
+	y_start := int(math.Max(0, math.Floor(p0[1])))
+	y_end := int(math.Min(float64(r.height), math.Ceil(p1[1])))
+
+	if y_start < r.min_y {
+		r.min_y = y_start
+	}
+
+	if y_end-1 > r.max_y {
+		r.max_y = y_end - 1
+	}
+
+	w := float64(r.width)
+
+	for y := y_start; y < y_end; y++ {
+
+		row := y * r.stride
+
+		dy := math.Min(float64(y+1), p1[1]) - math.Max(float64(y), p0[1])
+		x_next := x + dxdy*dy
+		d := dy * dir
+
+		x0 := math.Min(math.Max(math.Min(x, x_next), 0), w)
+		x1 := math.Min(math.Max(math.Max(x, x_next), 0), w)
+
+		x0_floor := math.Floor(x0)
+		x0_i := int(x0_floor)
+		x1_ceil := math.Ceil(x1)
+		x1_i := int(x1_ceil)
+
+		if x1_i <= x0_i+1 {
+
+			xmf := 0.5*(x0+x1) - x0_floor
+			r.acc[row+x0_i] += d - d*xmf
+			r.acc[row+x0_i+1] += d * xmf
+
+		} else {
+
+			s := 1.0 / (x1 - x0)
+			x0_f := x0 - x0_floor
+			a0 := 0.5 * s * (1.0 - x0_f) * (1.0 - x0_f)
+			x1_f := x1 - x1_ceil + 1.0
+			am := 0.5 * s * x1_f * x1_f
+
+			r.acc[row+x0_i] += d * a0
+
+			if x1_i == x0_i+2 {
+				r.acc[row+x0_i+1] += d * (1.0 - a0 - am)
+			} else {
+
+				a1 := s * (1.5 - x0_f)
+				r.acc[row+x0_i+1] += d * (a1 - a0)
+
+				for xi := x0_i + 2; xi < x1_i-1; xi++ {
+					r.acc[row+xi] += d * s
+				}
+
+				a2 := a1 + float64(x1_i-x0_i-3)*s
+				r.acc[row+x1_i-1] += d * (1.0 - a2 - am)
+			}
+
+			r.acc[row+x1_i] += d * am
+		}
+
+		x = x_next
+	}
+}
+
+// composite blends 'c' (a non-premultiplied colour) with an opacity of 'opacity' in to 'im' using the coverage
+// accumulated by the rasterizer as a mask.
+func (r *rasterizer) composite(im *image.RGBA, c [4]float64, opacity float64) {
+
+	for y := r.min_y; y <= r.max_y; y++ {
+
+		row := y * r.stride
+		total := 0.0
+
+		for x := 0; x < r.width; x++ {
+
+			total += r.acc[row+x]
+
+			coverage := math.Min(math.Abs(total), 1.0)
+
+			if coverage == 0 {
+				continue
+			}
+
+			alpha := coverage * opacity * c[3]
+
+			if alpha <= 0 {
+				continue
+			}
+
+			i := im.PixOffset(x, y)
+
+			for j := 0; j < 3; j++ {
+				dst := float64(im.Pix[i+j]) / 255.0
+				im.Pix[i+j] = uint8(math.Round((c[j]*alpha + dst*(1.0-alpha)) * 255.0))
+			}
+
+			dst_a := float64(im.Pix[i+3]) / 255.0
+			im.Pix[i+3] = uint8(math.Round((alpha + dst_a*(1.0-alpha)) * 255.0))
+		}
+	}
+}
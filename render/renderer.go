@@ -0,0 +1,112 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+	"github.com/sfomuseum/go-whosonfirst-tiles/internal/registry"
+	"io"
+)
+
+// Renderer is an interface for rendering map tiles derived from one or more geojson.Feature instances.
+type Renderer interface {
+	// Render writes the tile 't', in a given slippy.Grid and derived from zero or more features, to an io.Writer
+	// instance. If the grid is nil a web mercator (EPSG:3857) grid is assumed.
+	Render(context.Context, io.Writer, slippy.Grid, maptile.Tile, ...*geojson.Feature) error
+	// Extension returns the file extension (without a leading ".") for tiles produced by the renderer.
+	Extension() string
+	// ContentType returns the content (mime) type for tiles produced by the renderer.
+	ContentType() string
+}
+
+// BufferedRenderer is an optional interface for Renderer implementations that expect the features they are passed to
+// extend beyond the edges of a tile, for example so that strokes are not cut off at the edges of a tile. Callers should
+// crop features to the extent of a tile expanded by Buffer pixels, relative to TileSize, on each side.
+type BufferedRenderer interface {
+	Renderer
+	// Buffer returns the number of pixels that features are expected to extend beyond each edge of a tile.
+	Buffer() float64
+	// TileSize returns the size, in pixels, of the tiles that Buffer is measured against.
+	TileSize() float64
+}
+
+// EncodedRenderer is an optional interface for Renderer implementations whose output may be compressed, or otherwise
+// encoded, beyond its content type. Callers storing or serving tiles should record the encoding (for example as the
+// Content-Encoding header of an HTTP response) so that clients can decode them.
+type EncodedRenderer interface {
+	Renderer
+	// ContentEncoding returns the content encoding (for example "gzip") of tiles produced by the renderer or an empty
+	// string if they are not encoded.
+	ContentEncoding() string
+}
+
+// RendererInitializeFunc is a function used to initialize an implementation of the Renderer interface.
+type RendererInitializeFunc func(context.Context, string) (Renderer, error)
+
+var renderers = registry.NewRegistry()
+
+// RegisterRenderer registers 'scheme' as a key pointing to 'f' in an internal lookup table of renderers.
+func RegisterRenderer(ctx context.Context, scheme string, f RendererInitializeFunc) error {
+	return renderers.Register(ctx, scheme, f)
+}
+
+// Schemes returns the list of schemes that have been registered with the RegisterRenderer method.
+func Schemes() []string {
+	return renderers.Schemes()
+}
+
+// NewRenderer returns a new Renderer instance for 'uri' whose scheme must match a renderer previously registered
+// with the RegisterRenderer method.
+func NewRenderer(ctx context.Context, uri string) (Renderer, error) {
+
+	i, ok, err := renderers.Lookup(ctx, uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("Failed to find renderer for '%s'", uri)
+	}
+
+	f := i.(RendererInitializeFunc)
+	return f(ctx, uri)
+}
+
+// extentForTile returns the geographic (EPSG:4326) extent for 't' in 'g'.
+func extentForTile(g slippy.Grid, t maptile.Tile) (*geom.Extent, error) {
+
+	b, err := tiles.TileBound(g, t)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ext := geom.NewExtent(
+		[2]float64{b.Min.X(), b.Min.Y()},
+		[2]float64{b.Max.X(), b.Max.Y()},
+	)
+
+	return ext, nil
+}
+
+// nativeExtentForTile returns the extent for 't' in the native coordinates of 'g'.
+func nativeExtentForTile(g slippy.Grid, t maptile.Tile) (*geom.Extent, error) {
+
+	b, err := tiles.TileExtent(g, t)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ext := geom.NewExtent(
+		[2]float64{b.Min.X(), b.Min.Y()},
+		[2]float64{b.Max.X(), b.Max.Y()},
+	)
+
+	return ext, nil
+}
@@ -4,19 +4,50 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
 	"github.com/tidwall/sjson"
 	"github.com/whosonfirst/go-geojson-svg"
 	"io"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
 )
 
+// SVG_CONTENT_TYPE is the content type for SVG data.
+const SVG_CONTENT_TYPE string = "image/svg+xml"
+
+func init() {
+	ctx := context.Background()
+	RegisterRenderer(ctx, "svg", NewSVGRenderer)
+}
+
+// SVGRenderer implements the Renderer interface for producing SVG tiles.
+type SVGRenderer struct {
+	options *SVGOptions
+}
+
+var _ BufferedRenderer = (*SVGRenderer)(nil)
+
 // SVGOptions defines common configuration options for the RenderSVGWithFeatures method.
 type SVGOptions struct {
 	// The size of the tile to render
 	TileSize float64 `json:"tile_size"`
 	// An optional extent to assign the final SVG output.
 	TileExtent *geom.Extent `json:"tile_extent"`
+	// The grid that TileExtent belongs to. If nil a web mercator (EPSG:3857) grid is assumed.
+	Grid slippy.Grid `json:"-"`
+	// The optional extent of the tile in the native coordinates of Grid. If nil it is derived from TileExtent, which
+	// is only exact for web mercator and geographic grids.
+	NativeExtent *geom.Extent `json:"native_extent"`
+	// The number of pixels, relative to TileSize, that features are expected to extend beyond each edge of the tile.
+	// Polygon edges which run along (or beyond) the edges of the tile expanded by Buffer are assumed to have been
+	// created by cropping and are not stroked.
+	Buffer float64 `json:"buffer"`
 	// A valid io.Writer where SVG data will be written to.
 	Writer io.Writer
 	// A valid SVG stroke value.
@@ -47,7 +78,128 @@ func DefaultSVGOptions() *SVGOptions {
 	return opts
 }
 
-// Render SVG data for one or more geojson.Feature instances.
+// SVGOptionsWithURI returns a new SVGOptions instance, derived from DefaultSVGOptions, with values assigned from
+// the query parameters in 'uri'. Valid parameters are: tile_size, stroke, stroke_width, stroke_opacity, fill,
+// fill_opacity and buffer. Remember that colour values starting with "#" need to be URL-escaped (for example "%23ff0000").
+func SVGOptionsWithURI(uri string) (*SVGOptions, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	opts := DefaultSVGOptions()
+
+	if q.Get("stroke") != "" {
+		opts.Stroke = q.Get("stroke")
+	}
+
+	if q.Get("fill") != "" {
+		opts.Fill = q.Get("fill")
+	}
+
+	float_params := map[string]*float64{
+		"tile_size":      &opts.TileSize,
+		"stroke_width":   &opts.StrokeWidth,
+		"stroke_opacity": &opts.StrokeOpacity,
+		"fill_opacity":   &opts.FillOpacity,
+		"buffer":         &opts.Buffer,
+	}
+
+	for k, ptr := range float_params {
+
+		str_v := q.Get(k)
+
+		if str_v == "" {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(str_v, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ?%s= parameter, %w", k, err)
+		}
+
+		*ptr = v
+	}
+
+	if opts.Buffer < 0 {
+		return nil, fmt.Errorf("Invalid ?buffer= parameter")
+	}
+
+	return opts, nil
+}
+
+// NewSVGRenderer returns a new SVGRenderer instance configured by 'uri' which is expected to take the form of:
+//
+//	svg://?{PARAMETERS}
+//
+// Where {PARAMETERS} are any of the query parameters supported by the SVGOptionsWithURI method.
+func NewSVGRenderer(ctx context.Context, uri string) (Renderer, error) {
+
+	opts, err := SVGOptionsWithURI(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive SVG options, %w", err)
+	}
+
+	r := &SVGRenderer{
+		options: opts,
+	}
+
+	return r, nil
+}
+
+// Render writes the SVG representation of 't', derived from 'features', to 'wr'.
+func (r *SVGRenderer) Render(ctx context.Context, wr io.Writer, g slippy.Grid, t maptile.Tile, features ...*geojson.Feature) error {
+
+	ext, err := extentForTile(g, t)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive tile extent, %w", err)
+	}
+
+	native_ext, err := nativeExtentForTile(g, t)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive native tile extent, %w", err)
+	}
+
+	opts := *r.options
+	opts.Grid = g
+	opts.TileExtent = ext
+	opts.NativeExtent = native_ext
+	opts.Writer = wr
+
+	return RenderSVGWithFeatures(ctx, &opts, features...)
+}
+
+// Extension returns the file extension for SVG tiles.
+func (r *SVGRenderer) Extension() string {
+	return "svg"
+}
+
+// ContentType returns the content type for SVG tiles.
+func (r *SVGRenderer) ContentType() string {
+	return SVG_CONTENT_TYPE
+}
+
+// Buffer returns the number of pixels that features are expected to extend beyond each edge of a tile.
+func (r *SVGRenderer) Buffer() float64 {
+	return r.options.Buffer
+}
+
+// TileSize returns the size, in pixels, of SVG tiles.
+func (r *SVGRenderer) TileSize() float64 {
+	return r.options.TileSize
+}
+
+// Render SVG data for one or more geojson.Feature instances. If opts.TileExtent is defined then the edges of polygons
+// which run along (or beyond) the edges of the tile, expanded by opts.Buffer, are not stroked since they were created
+// by cropping the polygon to the tile rather than being part of its actual outline.
 func RenderSVGWithFeatures(ctx context.Context, opts *SVGOptions, features ...*geojson.Feature) error {
 
 	s := svg.New()
@@ -66,29 +218,88 @@ func RenderSVGWithFeatures(ctx context.Context, opts *SVGOptions, features ...*g
 		"stroke-width":   strconv.FormatFloat(stroke_width, 'f', -1, 64),
 		"stroke-opacity": strconv.FormatFloat(stroke_opacity, 'f', -1, 64),
 		"fill-opacity":   strconv.FormatFloat(fill_opacity, 'f', -1, 64),
+		// Rings are drawn as subpaths of a single path and are not guaranteed to be wound in any particular
+		// direction (for example after being cropped) so the even-odd rule is used to make sure holes are not filled.
+		"fill-rule": "evenodd",
 	}
 
-	for idx, f := range features {
+	// go-geojson-svg only knows how to scale features to a (web) mercator extent so tiles in other grids
+	// are drawn using the tile's own projection.
+
+	if opts.TileExtent != nil && !tiles.IsWebMercator(opts.Grid) {
+		return renderSVGWithProjection(opts, use_props, features...)
+	}
+
+	tile_size := opts.TileSize
+
+	// Polygon edges created by cropping features to the tile are only detected when the tile's extent is known.
+
+	var is_clip_edge func(orb.Point, orb.Point) bool
+
+	if opts.TileExtent != nil {
 
-		enc_f, err := f.MarshalJSON()
+		proj, err := tileProjection(opts.Grid, opts.TileExtent, opts.NativeExtent, tile_size)
 
 		if err != nil {
-			return fmt.Errorf("Failed to unmarshal feature (at index %d) to render, %w", idx, err)
+			return fmt.Errorf("Failed to derive tile projection, %w", err)
 		}
 
-		for k, v := range use_props {
-			path := fmt.Sprintf("properties.%s", k)
-			enc_f, _ = sjson.SetBytes(enc_f, path, v)
+		clip := clipBounds(tile_size, opts.Buffer)
+
+		is_clip_edge = func(a orb.Point, b orb.Point) bool {
+			return isClipEdge(proj(a), proj(b), clip)
 		}
+	}
 
-		err = s.AddFeature(string(enc_f))
+	fill_props, stroke_props := outlineProperties(use_props)
 
-		if err != nil {
-			return fmt.Errorf("Failed to add feature (at index %d) to render, %w", idx, err)
+	for idx, f := range features {
+
+		var outlines orb.MultiLineString
+		clipped := false
+
+		if is_clip_edge != nil && f.Geometry != nil {
+			outlines, clipped = polygonOutlines(f.Geometry, is_clip_edge)
 		}
-	}
 
-	tile_size := opts.TileSize
+		if !clipped {
+
+			err := addSVGFeature(s, f, use_props)
+
+			if err != nil {
+				return fmt.Errorf("Failed to add feature (at index %d) to render, %w", idx, err)
+			}
+
+			continue
+		}
+
+		// Polygons are filled, but not stroked, and their outlines (less the edges created by cropping) are
+		// stroked separately.
+
+		for _, g := range flattenCollection(f.Geometry) {
+
+			props := use_props
+
+			if isPolygonal(g) {
+				props = fill_props
+			}
+
+			err := addSVGFeature(s, partialFeature(f, g), props)
+
+			if err != nil {
+				return fmt.Errorf("Failed to add feature (at index %d) to render, %w", idx, err)
+			}
+		}
+
+		if len(outlines) > 0 {
+
+			err := addSVGFeature(s, partialFeature(f, outlines), stroke_props)
+
+			if err != nil {
+				return fmt.Errorf("Failed to add outline for feature (at index %d) to render, %w", idx, err)
+			}
+		}
+	}
 
 	if opts.TileExtent != nil {
 
@@ -115,3 +326,187 @@ func RenderSVGWithFeatures(ctx context.Context, opts *SVGOptions, features ...*g
 	_, err := opts.Writer.Write([]byte(rsp))
 	return err
 }
+
+// renderSVGWithProjection draws 'features' as SVG elements, using the same markup as the go-geojson-svg package,
+// after converting them to tile-local coordinates with the projection for opts.Grid and opts.TileExtent.
+func renderSVGWithProjection(opts *SVGOptions, use_props map[string]interface{}, features ...*geojson.Feature) error {
+
+	tile_size := opts.TileSize
+
+	proj, err := tileProjection(opts.Grid, opts.TileExtent, opts.NativeExtent, tile_size)
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive tile projection, %w", err)
+	}
+
+	fill_props, stroke_props := outlineProperties(use_props)
+
+	attrs := svgAttributes(use_props)
+	fill_attrs := svgAttributes(fill_props)
+	stroke_attrs := svgAttributes(stroke_props)
+
+	clip := clipBounds(tile_size, opts.Buffer)
+
+	is_clip_edge := func(a orb.Point, b orb.Point) bool {
+		return isClipEdge(a, b, clip)
+	}
+
+	var content strings.Builder
+
+	for _, f := range features {
+
+		if f.Geometry == nil {
+			continue
+		}
+
+		tile_geom := projectGeometry(f.Geometry, proj)
+
+		outlines, clipped := polygonOutlines(tile_geom, is_clip_edge)
+
+		if !clipped {
+			drawSVGGeometry(&content, tile_geom, attrs)
+			continue
+		}
+
+		for _, g := range flattenCollection(tile_geom) {
+
+			if isPolygonal(g) {
+				drawSVGGeometry(&content, g, fill_attrs)
+			} else {
+				drawSVGGeometry(&content, g, attrs)
+			}
+		}
+
+		drawSVGGeometry(&content, outlines, stroke_attrs)
+	}
+
+	rsp := fmt.Sprintf(`<svg width="%f" height="%f" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg">%s</svg>`, tile_size, tile_size, int(tile_size), int(tile_size), content.String())
+
+	_, err = opts.Writer.Write([]byte(rsp))
+	return err
+}
+
+// addSVGFeature adds 'f', with 'props' assigned to its properties, to 's'.
+func addSVGFeature(s *svg.SVG, f *geojson.Feature, props map[string]interface{}) error {
+
+	enc_f, err := f.MarshalJSON()
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal feature, %w", err)
+	}
+
+	for k, v := range props {
+		path := fmt.Sprintf("properties.%s", k)
+		enc_f, _ = sjson.SetBytes(enc_f, path, v)
+	}
+
+	return s.AddFeature(string(enc_f))
+}
+
+// partialFeature returns a new feature, with the same ID and properties as 'f', whose geometry is 'g'.
+func partialFeature(f *geojson.Feature, g orb.Geometry) *geojson.Feature {
+
+	partial := geojson.NewFeature(g)
+	partial.ID = f.ID
+	partial.Properties = f.Properties
+
+	return partial
+}
+
+// outlineProperties returns copies of 'props' for drawing the fill of a polygon without its outline and for drawing
+// the outline of a polygon without its fill.
+func outlineProperties(props map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+
+	fill_props := make(map[string]interface{})
+	stroke_props := make(map[string]interface{})
+
+	for k, v := range props {
+		fill_props[k] = v
+		stroke_props[k] = v
+	}
+
+	fill_props["stroke"] = "none"
+	stroke_props["fill"] = "none"
+
+	return fill_props, stroke_props
+}
+
+// svgAttributes returns 'props' encoded as a string of SVG attributes, sorted by name.
+func svgAttributes(props map[string]interface{}) string {
+
+	keys := make([]string, 0)
+
+	for k, _ := range props {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var attrs strings.Builder
+
+	for _, k := range keys {
+		fmt.Fprintf(&attrs, ` %s="%v"`, k, props[k])
+	}
+
+	return attrs.String()
+}
+
+// drawSVGGeometry writes the SVG elements for 'g', which is expected to be in tile-local coordinates, to 'wr'.
+func drawSVGGeometry(wr *strings.Builder, g orb.Geometry, attrs string) {
+
+	switch g := g.(type) {
+	case orb.Point:
+		fmt.Fprintf(wr, `<circle cx="%f" cy="%f" r="1"%s/>`, g.X(), g.Y(), attrs)
+	case orb.MultiPoint:
+
+		for _, pt := range g {
+			drawSVGGeometry(wr, pt, attrs)
+		}
+
+	case orb.LineString:
+		fmt.Fprintf(wr, `<path d="%s"%s/>`, svgPath(g), attrs)
+	case orb.MultiLineString:
+
+		for _, ls := range g {
+			drawSVGGeometry(wr, ls, attrs)
+		}
+
+	case orb.Ring:
+		drawSVGGeometry(wr, orb.Polygon{g}, attrs)
+	case orb.Polygon:
+
+		paths := make([]string, len(g))
+
+		for i, r := range g {
+			paths[i] = svgPath(r) + " Z"
+		}
+
+		fmt.Fprintf(wr, `<path d="%s"%s/>`, strings.Join(paths, " "), attrs)
+
+	case orb.MultiPolygon:
+
+		for _, p := range g {
+			drawSVGGeometry(wr, p, attrs)
+		}
+
+	case orb.Collection:
+
+		for _, cg := range g {
+			drawSVGGeometry(wr, cg, attrs)
+		}
+
+	case orb.Bound:
+		drawSVGGeometry(wr, g.ToPolygon(), attrs)
+	}
+}
+
+func svgPath(pts []orb.Point) string {
+
+	coords := make([]string, len(pts))
+
+	for i, pt := range pts {
+		coords[i] = fmt.Sprintf("%f %f", pt.X(), pt.Y())
+	}
+
+	return "M" + strings.Join(coords, ",")
+}
@@ -0,0 +1,55 @@
+package render
+
+import (
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/project"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+)
+
+// tileProjection returns an orb.Projection for converting geographic (EPSG:4326) coordinates in to tile-local
+// coordinates, with an origin in the upper-left corner, for a tile in 'g' whose geographic bounds are 'extent' and
+// whose sides are 'size' units long. If 'native_extent' is not nil it is used as the extent of the tile in the
+// native coordinates of 'g', otherwise it is derived from 'extent'. If 'g' is nil a web mercator (EPSG:3857) grid
+// is assumed.
+func tileProjection(g slippy.Grid, extent *geom.Extent, native_extent *geom.Extent, size float64) (orb.Projection, error) {
+
+	to_native, err := tiles.ToNativeProjection(g)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sw orb.Point
+	var ne orb.Point
+
+	if native_extent != nil {
+		sw = orb.Point{native_extent.MinX(), native_extent.MinY()}
+		ne = orb.Point{native_extent.MaxX(), native_extent.MaxY()}
+	} else {
+		sw = to_native(orb.Point{extent.MinX(), extent.MinY()})
+		ne = to_native(orb.Point{extent.MaxX(), extent.MaxY()})
+	}
+
+	x_res := (ne.X() - sw.X()) / size
+	y_res := (ne.Y() - sw.Y()) / size
+
+	proj := func(pt orb.Point) orb.Point {
+
+		native := to_native(pt)
+
+		x := (native.X() - sw.X()) / x_res
+		y := (ne.Y() - native.Y()) / y_res
+
+		return orb.Point{x, y}
+	}
+
+	return proj, nil
+}
+
+// projectGeometry returns a copy of 'g' with 'proj' applied to all its coordinates. The original geometry is
+// left untouched.
+func projectGeometry(g orb.Geometry, proj orb.Projection) orb.Geometry {
+	return project.Geometry(orb.Clone(g), proj)
+}
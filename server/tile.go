@@ -0,0 +1,242 @@
+// package server provides net/http handlers for rendering map tiles derived from Who's On First records on demand.
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+	"github.com/sfomuseum/go-whosonfirst-tiles/crop"
+	"github.com/sfomuseum/go-whosonfirst-tiles/index"
+	"github.com/sfomuseum/go-whosonfirst-tiles/render"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// The maximum zoom level for which tiles will be rendered.
+const MAX_ZOOM int = 24
+
+var re_tile_path = regexp.MustCompile(`^\/(\d+)\/(\d+)\/(\d+)\.([a-z]+)$`)
+
+// TileHandlerOptions defines configuration options for the TileHandler method.
+type TileHandlerOptions struct {
+	// An index.Index instance used to find the features that intersect a requested tile.
+	Index *index.Index
+	// The go-spatial/geom/slippy.Grid that requested tiles belong to. If nil a web mercator (EPSG:3857) grid is assumed.
+	Grid slippy.Grid
+	// A dictionary of render.Renderer instances keyed by the file extension they are used for.
+	Renderers map[string]render.Renderer
+	// An optional gocloud.dev/blob.Bucket instance where rendered tiles are cached. If nil tiles are not cached.
+	Cache *blob.Bucket
+	// An optional *log.Logger instance for reporting non-fatal errors. If nil nothing is logged.
+	Logger *log.Logger
+}
+
+// TileHandler returns an http.Handler instance for serving requests in the form of /{Z}/{X}/{Y}.{EXTENSION} where
+// {EXTENSION} is one of the keys in opts.Renderers. Tiles are rendered on demand by cropping the features that
+// intersect the requested tile and passing the results to the corresponding renderer. If opts.Cache is defined
+// rendered tiles are written to, and subsequently read from, {Z}/{X}/{Y}.{EXTENSION} in that bucket.
+func TileHandler(opts *TileHandlerOptions) (http.Handler, error) {
+
+	if opts.Index == nil {
+		return nil, fmt.Errorf("Missing index")
+	}
+
+	if len(opts.Renderers) == 0 {
+		return nil, fmt.Errorf("Missing renderers")
+	}
+
+	logger := opts.Logger
+
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+
+	fn := func(rsp http.ResponseWriter, req *http.Request) {
+
+		ctx := req.Context()
+
+		m := re_tile_path.FindStringSubmatch(req.URL.Path)
+
+		if len(m) == 0 {
+			http.Error(rsp, "Not found", http.StatusNotFound)
+			return
+		}
+
+		z, z_err := strconv.Atoi(m[1])
+		x, x_err := strconv.Atoi(m[2])
+		y, y_err := strconv.Atoi(m[3])
+		ext := m[4]
+
+		if z_err != nil || x_err != nil || y_err != nil {
+			http.Error(rsp, "Invalid tile", http.StatusBadRequest)
+			return
+		}
+
+		if z < 0 || z > MAX_ZOOM {
+			http.Error(rsp, "Invalid tile", http.StatusBadRequest)
+			return
+		}
+
+		cols, rows, err := tiles.GridSize(opts.Grid, maptile.Zoom(z))
+
+		if err != nil {
+			http.Error(rsp, "Invalid tile", http.StatusBadRequest)
+			return
+		}
+
+		// Compare columns and rows before they are converted to uint32 values so that large numbers are not
+		// wrapped around in to valid tiles.
+
+		if x < 0 || uint64(x) >= uint64(cols) || y < 0 || uint64(y) >= uint64(rows) {
+			http.Error(rsp, "Invalid tile", http.StatusBadRequest)
+			return
+		}
+
+		r, ok := opts.Renderers[ext]
+
+		if !ok {
+			http.Error(rsp, "Unsupported format", http.StatusNotFound)
+			return
+		}
+
+		t := maptile.New(uint32(x), uint32(y), maptile.Zoom(z))
+		cache_path := fmt.Sprintf("%d/%d/%d.%s", t.Z, t.X, t.Y, ext)
+
+		if opts.Cache != nil {
+
+			body, err := opts.Cache.ReadAll(ctx, cache_path)
+
+			if err == nil {
+				writeTile(rsp, r, body)
+				return
+			}
+
+			if gcerrors.Code(err) != gcerrors.NotFound {
+				logger.Printf("Failed to read '%s' from cache, %v", cache_path, err)
+			}
+		}
+
+		body, err := renderTile(ctx, opts.Index, opts.Grid, r, t, logger)
+
+		if err != nil {
+			logger.Printf("Failed to render '%s', %v", cache_path, err)
+			http.Error(rsp, "Failed to render tile", http.StatusInternalServerError)
+			return
+		}
+
+		if opts.Cache != nil {
+
+			wr_opts := &blob.WriterOptions{
+				ContentType:     r.ContentType(),
+				ContentEncoding: contentEncoding(r),
+			}
+
+			err := opts.Cache.WriteAll(ctx, cache_path, body, wr_opts)
+
+			if err != nil {
+				logger.Printf("Failed to write '%s' to cache, %v", cache_path, err)
+			}
+		}
+
+		writeTile(rsp, r, body)
+	}
+
+	return http.HandlerFunc(fn), nil
+}
+
+// renderTile crops the features in 'idx' which intersect 't' in 'g' and returns the output of 'r' for the results.
+// If 'r' is a render.BufferedRenderer then features are cropped to the extent of 't' expanded by its buffer. Features
+// that can not be cropped are logged and skipped.
+func renderTile(ctx context.Context, idx *index.Index, g slippy.Grid, r render.Renderer, t maptile.Tile, logger *log.Logger) ([]byte, error) {
+
+	crop_opts := &crop.CropOptions{
+		Grid: g,
+	}
+
+	// Renderers that draw features beyond the edges of a tile need them to be cropped to a buffered extent.
+
+	br, ok := r.(render.BufferedRenderer)
+
+	if ok {
+		crop_opts.Buffer = br.Buffer()
+		crop_opts.TileSize = br.TileSize()
+	}
+
+	bounds, err := crop.TileBoundWithOptions(t, crop_opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive tile bounds, %w", err)
+	}
+
+	candidates, err := idx.Intersects(ctx, bounds)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find features, %w", err)
+	}
+
+	cropped := make([]*geojson.Feature, 0)
+
+	for _, f := range candidates {
+
+		c, err := crop.CropGeoJSONFeatureWithBounds(ctx, f, bounds)
+
+		if errors.Is(err, crop.ErrNoIntersection) {
+			continue
+		}
+
+		if err != nil {
+			logger.Printf("Failed to crop feature '%v' for %d/%d/%d, %v", f.Properties["wof:id"], t.Z, t.X, t.Y, err)
+			continue
+		}
+
+		cropped = append(cropped, c)
+	}
+
+	var buf bytes.Buffer
+
+	err = r.Render(ctx, &buf, g, t, cropped...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeTile(rsp http.ResponseWriter, r render.Renderer, body []byte) {
+
+	rsp.Header().Set("Content-Type", r.ContentType())
+
+	enc := contentEncoding(r)
+
+	if enc != "" {
+		rsp.Header().Set("Content-Encoding", enc)
+	}
+
+	rsp.Header().Set("Content-Length", strconv.Itoa(len(body)))
+
+	rsp.Write(body)
+}
+
+// contentEncoding returns the content encoding for tiles produced by 'r' if it implements the render.EncodedRenderer
+// interface or an empty string otherwise.
+func contentEncoding(r render.Renderer) string {
+
+	er, ok := r.(render.EncodedRenderer)
+
+	if !ok {
+		return ""
+	}
+
+	return er.ContentEncoding()
+}
@@ -0,0 +1,333 @@
+// package stats provides methods for deriving tile coverage statistics for Who's On First records, and estimating the
+// number and size of the tiles they will produce, without cropping or rendering anything.
+package stats
+
+import (
+	"context"
+	"fmt"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles/coverage"
+	"github.com/sfomuseum/go-whosonfirst-tiles/internal/wof"
+	"github.com/whosonfirst/go-whosonfirst-iterate/iterator"
+	"io"
+	"sync"
+)
+
+// The default estimated size, in bytes, of an empty tile.
+const DEFAULT_TILE_OVERHEAD int64 = 256
+
+// The default estimated size, in bytes, of a single (cropped) record in a tile.
+const DEFAULT_FEATURE_SIZE int64 = 2048
+
+// StatsOptions defines configuration options for a Collector instance.
+type StatsOptions struct {
+	// The CoverageOptions used to determine which tiles each record covers.
+	CoverageOptions *coverage.CoverageOptions
+	// The estimated size, in bytes, of an empty tile. If 0 then DEFAULT_TILE_OVERHEAD is used.
+	TileOverhead int64
+	// The estimated size, in bytes, of a single (cropped) record in a tile. If 0 then DEFAULT_FEATURE_SIZE is used.
+	FeatureSize int64
+	// The maximum number of records to derive coverage for concurrently when using the StatsWithIterator method. If 0
+	// then runtime.NumCPU() is used.
+	Workers int
+}
+
+// TileStats reports tile coverage statistics for a group of records.
+type TileStats struct {
+	// The number of records.
+	Records int64 `json:"records"`
+	// The number of distinct tiles covered by the records.
+	Tiles int64 `json:"tiles"`
+	// The number of (record, tile) pairs. This is the number of cropped features that would be produced.
+	Pairs int64 `json:"pairs"`
+	// The largest number of tiles covered by a single record.
+	MaxTilesPerRecord int64 `json:"max_tiles_per_record"`
+	// The Who's On First ID of the record covering the largest number of tiles.
+	MaxTilesRecord int64 `json:"max_tiles_record"`
+	// The estimated size, in bytes, of all the tiles. This is (Tiles * TileOverhead) + (Pairs * FeatureSize) and is
+	// only meant to be a rough guide.
+	EstimatedSize int64 `json:"estimated_size"`
+}
+
+// ZoomStats reports tile coverage statistics for a single zoom level.
+type ZoomStats struct {
+	TileStats
+	// The zoom level being reported.
+	Zoom uint `json:"zoom"`
+	// Tile coverage statistics for each placetype at zoom level 'Zoom'. Records without a placetype are included in
+	// the statistics for the zoom level but not reported here.
+	Placetypes map[string]*TileStats `json:"placetypes"`
+}
+
+// Stats reports tile coverage statistics for all the records added to a Collector instance.
+type Stats struct {
+	// Tile coverage statistics for all zoom levels. The Records and MaxTilesPerRecord properties are reported
+	// for the zoom level with the largest number of tiles.
+	Total *TileStats `json:"total"`
+	// Tile coverage statistics for each zoom level.
+	Zooms []*ZoomStats `json:"zooms"`
+}
+
+// Collector accumulates tile coverage statistics for one or more records. It is safe to use a Collector concurrently.
+type Collector struct {
+	options  *coverage.CoverageOptions
+	overhead int64
+	size     int64
+	mu       *sync.Mutex
+	zooms    map[uint]*zoomCollector
+}
+
+// zoomCollector accumulates tile coverage statistics for a single zoom level.
+type zoomCollector struct {
+	*tileCollector
+	placetypes map[string]*tileCollector
+}
+
+// tileCollector accumulates tile coverage statistics, and the set of distinct tiles covered, for a group of records.
+type tileCollector struct {
+	stats *TileStats
+	tiles maptile.Set
+}
+
+// NewCollector returns a new Collector instance configured by 'opts'.
+func NewCollector(ctx context.Context, opts *StatsOptions) (*Collector, error) {
+
+	if opts.CoverageOptions == nil {
+		return nil, fmt.Errorf("Missing coverage options")
+	}
+
+	if opts.TileOverhead < 0 || opts.FeatureSize < 0 {
+		return nil, fmt.Errorf("Invalid size estimate")
+	}
+
+	overhead := opts.TileOverhead
+
+	if overhead == 0 {
+		overhead = DEFAULT_TILE_OVERHEAD
+	}
+
+	size := opts.FeatureSize
+
+	if size == 0 {
+		size = DEFAULT_FEATURE_SIZE
+	}
+
+	// Relations are not needed to count tiles so make a copy of the coverage options without them.
+
+	cover_opts := *opts.CoverageOptions
+	cover_opts.Relations = false
+
+	c := &Collector{
+		options:  &cover_opts,
+		overhead: overhead,
+		size:     size,
+		mu:       new(sync.Mutex),
+		zooms:    make(map[uint]*zoomCollector),
+	}
+
+	return c, nil
+}
+
+// StatsWithIterator returns tile coverage statistics, configured by 'opts', for all the records emitted by
+// 'iter_uri' for 'uris'.
+func StatsWithIterator(ctx context.Context, opts *StatsOptions, iter_uri string, uris ...string) (*Stats, error) {
+
+	c, err := NewCollector(ctx, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	batch_opts := &coverage.BatchOptions{
+		CoverageOptions: c.options,
+		Workers:         opts.Workers,
+	}
+
+	batch, err := coverage.NewBatch(ctx, batch_opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	iter_cb := func(ctx context.Context, fh io.ReadSeeker, args ...interface{}) error {
+
+		body, err := io.ReadAll(fh)
+
+		if err != nil {
+			return fmt.Errorf("Failed to read record, %w", err)
+		}
+
+		placetype, err := wof.Placetype(body)
+
+		if err != nil {
+			return err
+		}
+
+		tile_cb := func(ctx context.Context, rsp *coverage.Coverage) error {
+			return c.addCoverage(placetype, rsp)
+		}
+
+		return batch.Add(ctx, body, tile_cb)
+	}
+
+	iter, err := iterator.NewIterator(ctx, iter_uri, iter_cb)
+
+	if err != nil {
+		batch.Wait()
+		return nil, fmt.Errorf("Failed to create new iterator, %w", err)
+	}
+
+	err = iter.IterateURIs(ctx, uris...)
+
+	if err != nil {
+		batch.Wait()
+		return nil, fmt.Errorf("Failed to iterate URIs, %w", err)
+	}
+
+	err = batch.Wait()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to derive coverage, %w", err)
+	}
+
+	return c.Stats(), nil
+}
+
+// AddFeature adds the tile coverage for the Who's On First record defined by 'body' to the collector.
+func (c *Collector) AddFeature(ctx context.Context, body []byte) error {
+
+	placetype, err := wof.Placetype(body)
+
+	if err != nil {
+		return err
+	}
+
+	tile_cb := func(ctx context.Context, rsp *coverage.Coverage) error {
+		return c.addCoverage(placetype, rsp)
+	}
+
+	return coverage.CoverageWithFeatureAndCallback(ctx, c.options, body, tile_cb)
+}
+
+// Stats returns the tile coverage statistics accumulated so far.
+func (c *Collector) Stats() *Stats {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := &Stats{
+		Total: new(TileStats),
+		Zooms: make([]*ZoomStats, 0, len(c.zooms)),
+	}
+
+	for _, z := range c.options.ZoomLevels {
+
+		zc, ok := c.zooms[z]
+
+		if !ok {
+			continue
+		}
+
+		zs := &ZoomStats{
+			TileStats:  *zc.stats,
+			Zoom:       z,
+			Placetypes: make(map[string]*TileStats),
+		}
+
+		zs.EstimatedSize = c.estimate(zs.Tiles, zs.Pairs)
+
+		for pt, pt_c := range zc.placetypes {
+
+			pt_zs := *pt_c.stats
+			pt_zs.EstimatedSize = c.estimate(pt_zs.Tiles, pt_zs.Pairs)
+
+			zs.Placetypes[pt] = &pt_zs
+		}
+
+		s.Zooms = append(s.Zooms, zs)
+
+		s.Total.Tiles += zs.Tiles
+		s.Total.Pairs += zs.Pairs
+		s.Total.EstimatedSize += zs.EstimatedSize
+
+		if zs.Records > s.Total.Records {
+			s.Total.Records = zs.Records
+		}
+
+		if zs.MaxTilesPerRecord > s.Total.MaxTilesPerRecord {
+			s.Total.MaxTilesPerRecord = zs.MaxTilesPerRecord
+			s.Total.MaxTilesRecord = zs.MaxTilesRecord
+		}
+	}
+
+	return s
+}
+
+func (c *Collector) addCoverage(placetype string, rsp *coverage.Coverage) error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	zc, ok := c.zooms[rsp.Zoom]
+
+	if !ok {
+
+		zc = &zoomCollector{
+			tileCollector: newTileCollector(),
+			placetypes:    make(map[string]*tileCollector),
+		}
+
+		c.zooms[rsp.Zoom] = zc
+	}
+
+	zc.add(rsp)
+
+	if placetype == "" {
+		return nil
+	}
+
+	pt_c, ok := zc.placetypes[placetype]
+
+	if !ok {
+		pt_c = newTileCollector()
+		zc.placetypes[placetype] = pt_c
+	}
+
+	pt_c.add(rsp)
+	return nil
+}
+
+// newTileCollector returns a new, empty tileCollector instance.
+func newTileCollector() *tileCollector {
+
+	return &tileCollector{
+		stats: new(TileStats),
+		tiles: make(maptile.Set),
+	}
+}
+
+// add adds the tiles covered by a single record, defined by 'rsp', to the collector.
+func (tc *tileCollector) add(rsp *coverage.Coverage) {
+
+	count := int64(len(rsp.Tiles))
+
+	for t, _ := range rsp.Tiles {
+
+		if !tc.tiles[t] {
+			tc.tiles[t] = true
+			tc.stats.Tiles += 1
+		}
+	}
+
+	tc.stats.Records += 1
+	tc.stats.Pairs += count
+
+	if count > tc.stats.MaxTilesPerRecord {
+		tc.stats.MaxTilesPerRecord = count
+		tc.stats.MaxTilesRecord = rsp.Id
+	}
+}
+
+func (c *Collector) estimate(tiles int64, pairs int64) int64 {
+	return (tiles * c.overhead) + (pairs * c.size)
+}
@@ -0,0 +1,87 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"github.com/sfomuseum/go-whosonfirst-tiles/coverage"
+	"testing"
+)
+
+// placetypeFeature returns a GeoJSON Point feature with ID 'id' and placetype 'placetype' at the coordinates
+// defined by 'lon' and 'lat'.
+func placetypeFeature(id int64, placetype string, lon float64, lat float64) []byte {
+	return []byte(fmt.Sprintf(`{"type":"Feature","properties":{"wof:id":%d,"wof:placetype":"%s"},"geometry":{"type":"Point","coordinates":[%f,%f]}}`, id, placetype, lon, lat))
+}
+
+func TestCollectorPlacetypes(t *testing.T) {
+
+	cover_opts, err := coverage.DefaultCoverageOptions()
+
+	if err != nil {
+		t.Fatalf("Failed to create coverage options, %v", err)
+	}
+
+	cover_opts.ZoomLevels = []uint{0}
+
+	opts := &StatsOptions{
+		CoverageOptions: cover_opts,
+	}
+
+	ctx := context.Background()
+
+	c, err := NewCollector(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create collector, %v", err)
+	}
+
+	count := 100
+
+	for i := 0; i < count; i++ {
+
+		err := c.AddFeature(ctx, placetypeFeature(int64(i), fmt.Sprintf("placetype%d", i), 0, 0))
+
+		if err != nil {
+			t.Fatalf("Failed to add record %d, %v", i, err)
+		}
+	}
+
+	err = c.AddFeature(ctx, placetypeFeature(int64(count), "", 0, 0))
+
+	if err != nil {
+		t.Fatalf("Failed to add record without a placetype, %v", err)
+	}
+
+	s := c.Stats()
+
+	if len(s.Zooms) != 1 {
+		t.Fatalf("Expected stats for 1 zoom level, got %d", len(s.Zooms))
+	}
+
+	zs := s.Zooms[0]
+
+	if zs.Records != int64(count+1) {
+		t.Fatalf("Expected %d records, got %d", count+1, zs.Records)
+	}
+
+	if zs.Tiles != 1 {
+		t.Fatalf("Expected 1 tile, got %d", zs.Tiles)
+	}
+
+	if len(zs.Placetypes) != count {
+		t.Fatalf("Expected %d placetypes, got %d", count, len(zs.Placetypes))
+	}
+
+	_, ok := zs.Placetypes[""]
+
+	if ok {
+		t.Fatalf("Expected records without a placetype not to be reported as a placetype")
+	}
+
+	for pt, pt_stats := range zs.Placetypes {
+
+		if pt_stats.Records != 1 || pt_stats.Tiles != 1 {
+			t.Fatalf("Expected 1 record and 1 tile for %s, got %d and %d", pt, pt_stats.Records, pt_stats.Tiles)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package tiles
+
+import (
+	"fmt"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/project"
+	"strings"
+)
+
+// The maximum zoom level supported by the tile utility methods. This is the maximum zoom level for which tile
+// coordinates (and quadkeys) can be represented by the paulmach/orb/maptile package.
+const MAX_TILE_ZOOM uint32 = 31
+
+// The maximum number of tiles that the ChildrenAtZoom and Children methods will return. Use the maptile.Tile.Range
+// method to enumerate the descendants of tiles that exceed this limit.
+const MAX_TILE_CHILDREN uint64 = 1 << 24
+
+// ToMapTile returns the paulmach/orb/maptile.Tile equivalent of 't'.
+func ToMapTile(t *slippy.Tile) maptile.Tile {
+	return maptile.New(uint32(t.X), uint32(t.Y), maptile.Zoom(t.Z))
+}
+
+// ToSlippyTile returns the go-spatial/geom/slippy.Tile equivalent of 't'.
+func ToSlippyTile(t maptile.Tile) *slippy.Tile {
+	return slippy.NewTile(uint(t.Z), uint(t.X), uint(t.Y))
+}
+
+// Extent3857 returns a EPSG:3857 (web mercator) extent, in metres, for 't'.
+func Extent3857(t *slippy.Tile) *geom.Extent {
+
+	b := project.Bound(ToMapTile(t).Bound(), project.WGS84.ToMercator)
+
+	return geom.NewExtent(
+		[2]float64{b.Min.X(), b.Min.Y()},
+		[2]float64{b.Max.X(), b.Max.Y()},
+	)
+}
+
+// ParentAtZoom returns the ancestor of 't' at zoom level 'z'. If 'z' is greater than or equal to the zoom level of
+// 't' then 't' is returned.
+func ParentAtZoom(t maptile.Tile, z maptile.Zoom) maptile.Tile {
+
+	if z >= t.Z {
+		return t
+	}
+
+	delta := uint32(t.Z - z)
+	return maptile.New(t.X>>delta, t.Y>>delta, z)
+}
+
+// Parent returns the ancestor of 't' that is 'delta' zoom levels above it. If 'delta' is greater than the zoom
+// level of 't' the tile at zoom level 0 is returned.
+func Parent(t maptile.Tile, delta uint32) maptile.Tile {
+
+	if delta > uint32(t.Z) {
+		delta = uint32(t.Z)
+	}
+
+	return ParentAtZoom(t, t.Z-maptile.Zoom(delta))
+}
+
+// ChildrenAtZoom returns all the descendants of 't' at zoom level 'z', ordered by column and then row. It is an
+// error if 'z' is less than the zoom level of 't' or greater than MAX_TILE_ZOOM or if there are more than
+// MAX_TILE_CHILDREN descendants.
+func ChildrenAtZoom(t maptile.Tile, z maptile.Zoom) (maptile.Tiles, error) {
+
+	if z < t.Z {
+		return nil, fmt.Errorf("Zoom level %d is less than the tile's zoom level (%d)", z, t.Z)
+	}
+
+	if uint32(z) > MAX_TILE_ZOOM {
+		return nil, fmt.Errorf("Zoom level %d exceeds the maximum zoom level (%d)", z, MAX_TILE_ZOOM)
+	}
+
+	min, max := t.Range(z)
+
+	count := (uint64(max.X) - uint64(min.X) + 1) * (uint64(max.Y) - uint64(min.Y) + 1)
+
+	if count > MAX_TILE_CHILDREN {
+		return nil, fmt.Errorf("Tile has %d descendants at zoom level %d which exceeds the maximum (%d)", count, z, MAX_TILE_CHILDREN)
+	}
+
+	children := make(maptile.Tiles, 0, count)
+
+	for x := min.X; x <= max.X; x++ {
+
+		for y := min.Y; y <= max.Y; y++ {
+			children = append(children, maptile.New(x, y, z))
+		}
+	}
+
+	return children, nil
+}
+
+// Children returns all the descendants of 't' that are 'delta' zoom levels below it. See ChildrenAtZoom for details.
+func Children(t maptile.Tile, delta uint32) (maptile.Tiles, error) {
+
+	if uint64(t.Z)+uint64(delta) > uint64(MAX_TILE_ZOOM) {
+		return nil, fmt.Errorf("Zoom level %d exceeds the maximum zoom level (%d)", uint64(t.Z)+uint64(delta), MAX_TILE_ZOOM)
+	}
+
+	return ChildrenAtZoom(t, t.Z+maptile.Zoom(delta))
+}
+
+// Neighbor returns the tile that is 'dx' columns and 'dy' rows away from 't' in a web mercator grid. Columns wrap
+// around the antimeridian. Rows do not wrap around the poles so the boolean value returned will be false if the
+// neighbor would be above the first row or below the last row.
+func Neighbor(t maptile.Tile, dx int, dy int) (maptile.Tile, bool) {
+
+	n := int64(1) << uint32(t.Z)
+	return neighbor(t, dx, dy, n, n, true)
+}
+
+// Neighbors returns the (up to) eight tiles surrounding 't' in a web mercator grid, clockwise starting from the tile
+// directly above it. Columns wrap around the antimeridian so tiles in the first and last columns are neighbors.
+// Each neighbor is only returned once, which matters at low zoom levels where the grid is narrower than three columns.
+func Neighbors(t maptile.Tile) maptile.Tiles {
+
+	neighbors, _ := NeighborsWithGrid(nil, t)
+	return neighbors
+}
+
+// NeighborsWithGrid returns the (up to) eight tiles surrounding 't' in 'g', clockwise starting from the tile
+// directly above it. Columns wrap around the antimeridian for global (web mercator and geographic) grids but not for
+// ProjectedGrid instances (for example a TileMatrixSet). If 'g' is nil a web mercator grid is assumed.
+func NeighborsWithGrid(g slippy.Grid, t maptile.Tile) (maptile.Tiles, error) {
+
+	cols, rows, err := GridSize(g, t.Z)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, projected := g.(ProjectedGrid)
+	wrap := !projected
+
+	offsets := [][2]int{
+		{0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1},
+	}
+
+	neighbors := make(maptile.Tiles, 0, len(offsets))
+	seen := make(map[maptile.Tile]bool)
+
+	for _, o := range offsets {
+
+		n, ok := neighbor(t, o[0], o[1], int64(cols), int64(rows), wrap)
+
+		if !ok || n == t || seen[n] {
+			continue
+		}
+
+		seen[n] = true
+		neighbors = append(neighbors, n)
+	}
+
+	return neighbors, nil
+}
+
+func neighbor(t maptile.Tile, dx int, dy int, cols int64, rows int64, wrap bool) (maptile.Tile, bool) {
+
+	x := int64(t.X) + int64(dx)
+	y := int64(t.Y) + int64(dy)
+
+	if y < 0 || y >= rows {
+		return t, false
+	}
+
+	if x < 0 || x >= cols {
+
+		if !wrap {
+			return t, false
+		}
+
+		x = ((x % cols) + cols) % cols
+	}
+
+	return maptile.New(uint32(x), uint32(y), t.Z), true
+}
+
+// ToQuadkey returns the (Bing Maps) quadkey string for 't'. Tiles at zoom level 0 have an empty quadkey.
+func ToQuadkey(t maptile.Tile) string {
+
+	var sb strings.Builder
+
+	for i := uint32(t.Z); i > 0; i-- {
+
+		digit := byte('0')
+		mask := uint32(1) << (i - 1)
+
+		if t.X&mask != 0 {
+			digit += 1
+		}
+
+		if t.Y&mask != 0 {
+			digit += 2
+		}
+
+		sb.WriteByte(digit)
+	}
+
+	return sb.String()
+}
+
+// FromQuadkey returns the tile for the (Bing Maps) quadkey string 'qk'.
+func FromQuadkey(qk string) (maptile.Tile, error) {
+
+	if uint32(len(qk)) > MAX_TILE_ZOOM {
+		return maptile.Tile{}, fmt.Errorf("Quadkey exceeds the maximum zoom level (%d)", MAX_TILE_ZOOM)
+	}
+
+	var x uint32
+	var y uint32
+
+	z := uint32(len(qk))
+
+	for i, c := range qk {
+
+		mask := uint32(1) << (z - uint32(i) - 1)
+
+		switch c {
+		case '0':
+			// pass
+		case '1':
+			x |= mask
+		case '2':
+			y |= mask
+		case '3':
+			x |= mask
+			y |= mask
+		default:
+			return maptile.Tile{}, fmt.Errorf("Invalid quadkey digit '%c'", c)
+		}
+	}
+
+	return maptile.New(x, y, maptile.Zoom(z)), nil
+}
+
+// FlipY returns a copy of 't' with its row flipped between the XYZ ("slippy", origin in the top left corner) and
+// TMS (origin in the bottom left corner) tiling schemes. The operation is its own inverse.
+func FlipY(t maptile.Tile) maptile.Tile {
+
+	rows := uint32(1) << uint32(t.Z)
+	return maptile.New(t.X, rows-1-t.Y, t.Z)
+}
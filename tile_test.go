@@ -0,0 +1,198 @@
+package tiles
+
+import (
+	"github.com/paulmach/orb/maptile"
+	"testing"
+)
+
+func TestQuadkey(t *testing.T) {
+
+	tests := []struct {
+		Tile    maptile.Tile
+		Quadkey string
+	}{
+		{maptile.New(0, 0, 0), ""},
+		{maptile.New(1, 0, 1), "1"},
+		{maptile.New(0, 1, 1), "2"},
+		{maptile.New(3, 5, 3), "213"},
+		{maptile.New(35210, 21493, 16), "1202102332221212"},
+		{maptile.New(1<<31-1, 1<<31-1, 31), "3333333333333333333333333333333"},
+	}
+
+	for _, test := range tests {
+
+		qk := ToQuadkey(test.Tile)
+
+		if qk != test.Quadkey {
+			t.Fatalf("Expected quadkey '%s' for %d/%d/%d, got '%s'", test.Quadkey, test.Tile.Z, test.Tile.X, test.Tile.Y, qk)
+		}
+
+		tile, err := FromQuadkey(qk)
+
+		if err != nil {
+			t.Fatalf("Failed to parse quadkey '%s', %v", qk, err)
+		}
+
+		if tile != test.Tile {
+			t.Fatalf("Expected tile %d/%d/%d for quadkey '%s', got %d/%d/%d", test.Tile.Z, test.Tile.X, test.Tile.Y, qk, tile.Z, tile.X, tile.Y)
+		}
+	}
+
+	for _, qk := range []string{"4", "12a", "33333333333333333333333333333333"} {
+
+		_, err := FromQuadkey(qk)
+
+		if err == nil {
+			t.Fatalf("Expected quadkey '%s' to be invalid", qk)
+		}
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+
+	tests := []struct {
+		Name      string
+		Tile      maptile.Tile
+		Neighbors maptile.Tiles
+	}{
+		{
+			Name: "interior",
+			Tile: maptile.New(2, 2, 3),
+			Neighbors: maptile.Tiles{
+				maptile.New(2, 1, 3), maptile.New(3, 1, 3), maptile.New(3, 2, 3), maptile.New(3, 3, 3),
+				maptile.New(2, 3, 3), maptile.New(1, 3, 3), maptile.New(1, 2, 3), maptile.New(1, 1, 3),
+			},
+		},
+		{
+			Name: "first column",
+			Tile: maptile.New(0, 2, 3),
+			Neighbors: maptile.Tiles{
+				maptile.New(0, 1, 3), maptile.New(1, 1, 3), maptile.New(1, 2, 3), maptile.New(1, 3, 3),
+				maptile.New(0, 3, 3), maptile.New(7, 3, 3), maptile.New(7, 2, 3), maptile.New(7, 1, 3),
+			},
+		},
+		{
+			Name: "last column",
+			Tile: maptile.New(7, 2, 3),
+			Neighbors: maptile.Tiles{
+				maptile.New(7, 1, 3), maptile.New(0, 1, 3), maptile.New(0, 2, 3), maptile.New(0, 3, 3),
+				maptile.New(7, 3, 3), maptile.New(6, 3, 3), maptile.New(6, 2, 3), maptile.New(6, 1, 3),
+			},
+		},
+		{
+			Name: "first row",
+			Tile: maptile.New(0, 0, 3),
+			Neighbors: maptile.Tiles{
+				maptile.New(1, 0, 3), maptile.New(1, 1, 3), maptile.New(0, 1, 3), maptile.New(7, 1, 3),
+				maptile.New(7, 0, 3),
+			},
+		},
+		{
+			Name: "zoom level 1",
+			Tile: maptile.New(0, 0, 1),
+			Neighbors: maptile.Tiles{
+				maptile.New(1, 0, 1), maptile.New(1, 1, 1), maptile.New(0, 1, 1),
+			},
+		},
+		{
+			Name:      "zoom level 0",
+			Tile:      maptile.New(0, 0, 0),
+			Neighbors: maptile.Tiles{},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			neighbors := Neighbors(test.Tile)
+
+			if len(neighbors) != len(test.Neighbors) {
+				t.Fatalf("Expected %d neighbors, got %d (%v)", len(test.Neighbors), len(neighbors), neighbors)
+			}
+
+			for i, n := range test.Neighbors {
+
+				if neighbors[i] != n {
+					t.Fatalf("Expected neighbor %d to be %d/%d/%d, got %d/%d/%d", i, n.Z, n.X, n.Y, neighbors[i].Z, neighbors[i].X, neighbors[i].Y)
+				}
+			}
+		})
+	}
+}
+
+func TestFlipY(t *testing.T) {
+
+	tests := []struct {
+		Tile    maptile.Tile
+		Flipped maptile.Tile
+	}{
+		{maptile.New(0, 0, 0), maptile.New(0, 0, 0)},
+		{maptile.New(0, 0, 1), maptile.New(0, 1, 1)},
+		{maptile.New(3, 1, 3), maptile.New(3, 6, 3)},
+		{maptile.New(0, 0, 31), maptile.New(0, 1<<31-1, 31)},
+	}
+
+	for _, test := range tests {
+
+		flipped := FlipY(test.Tile)
+
+		if flipped != test.Flipped {
+			t.Fatalf("Expected %d/%d/%d for %d/%d/%d, got %d/%d/%d", test.Flipped.Z, test.Flipped.X, test.Flipped.Y, test.Tile.Z, test.Tile.X, test.Tile.Y, flipped.Z, flipped.X, flipped.Y)
+		}
+
+		if FlipY(flipped) != test.Tile {
+			t.Fatalf("Flipping %d/%d/%d twice did not return the original tile", test.Tile.Z, test.Tile.X, test.Tile.Y)
+		}
+	}
+}
+
+func TestChildren(t *testing.T) {
+
+	tests := []struct {
+		Name  string
+		Tile  maptile.Tile
+		Delta uint32
+		Count int
+		Error bool
+	}{
+		{Name: "same zoom", Tile: maptile.New(1, 1, 1), Delta: 0, Count: 1},
+		{Name: "one level", Tile: maptile.New(1, 1, 1), Delta: 1, Count: 4},
+		{Name: "three levels", Tile: maptile.New(5, 9, 4), Delta: 3, Count: 64},
+		{Name: "too many children", Tile: maptile.New(0, 0, 0), Delta: 16, Error: true},
+		{Name: "maximum zoom exceeded", Tile: maptile.New(0, 0, 30), Delta: 2, Error: true},
+		{Name: "zoom overflow", Tile: maptile.New(0, 0, 4), Delta: 1<<32 - 1, Error: true},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.Name, func(t *testing.T) {
+
+			children, err := Children(test.Tile, test.Delta)
+
+			if test.Error {
+
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Failed to derive children, %v", err)
+			}
+
+			if len(children) != test.Count {
+				t.Fatalf("Expected %d children, got %d", test.Count, len(children))
+			}
+
+			for _, c := range children {
+
+				if ParentAtZoom(c, test.Tile.Z) != test.Tile {
+					t.Fatalf("Tile %d/%d/%d is not a descendant of %d/%d/%d", c.Z, c.X, c.Y, test.Tile.Z, test.Tile.X, test.Tile.Y)
+				}
+			}
+		})
+	}
+}
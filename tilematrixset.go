@@ -0,0 +1,444 @@
+package tiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-spatial/geom"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/project"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The size, in metres, of a "standardized rendering pixel" used to derive cell sizes from scale denominators in
+// version 1.0 Tile Matrix Set definitions.
+const tms_pixel_size float64 = 0.00028
+
+var re_epsg = regexp.MustCompile(`(?i)EPSG(?:\/0\/|::|:)(\d+)$`)
+
+// ProjectedGrid is an interface for slippy.Grid implementations that define their own projection between
+// geographic (EPSG:4326) coordinates and the native coordinates of the grid.
+type ProjectedGrid interface {
+	slippy.Grid
+	// ToNativeProjection returns an orb.Projection for converting geographic coordinates in to native coordinates.
+	ToNativeProjection() orb.Projection
+	// FromNativeProjection returns an orb.Projection for converting native coordinates in to geographic coordinates.
+	FromNativeProjection() orb.Projection
+}
+
+// TileMatrixSet implements the slippy.Grid and ProjectedGrid interfaces for tile grids defined by an OGC Two
+// Dimensional Tile Matrix Set (https://docs.ogc.org/is/17-083r4/17-083r4.html) document. Zoom levels are the
+// position of each tile matrix, ordered from the largest to the smallest cell size, rather than the tile matrix
+// identifiers. Unlike slippy grids the tile matrices are not required to be quadtree subdivisions of one another.
+type TileMatrixSet struct {
+	// The identifier of the tile matrix set.
+	Id string
+	// The URI of the coordinate reference system of the tile matrix set.
+	CRS string
+	// The tile matrices in the set ordered by zoom level.
+	Matrices    []*TileMatrix
+	srid        uint
+	to_native   orb.Projection
+	from_native orb.Projection
+}
+
+var _ ProjectedGrid = (*TileMatrixSet)(nil)
+
+// TileMatrix defines a single zoom level in a TileMatrixSet.
+type TileMatrix struct {
+	// The identifier of the tile matrix.
+	Id string
+	// The size of a single cell (pixel), in native units.
+	CellSize float64
+	// The native coordinates of the tile matrix origin.
+	Origin orb.Point
+	// A boolean flag indicating whether the tile matrix origin is its bottom left corner rather than its top left corner.
+	BottomLeft bool
+	// The width, in cells, of each tile.
+	TileWidth uint
+	// The height, in cells, of each tile.
+	TileHeight uint
+	// The number of tiles along the X axis of the tile matrix.
+	MatrixWidth uint
+	// The number of tiles along the Y axis of the tile matrix.
+	MatrixHeight uint
+}
+
+type tmsDocument struct {
+	Id           string          `json:"id"`
+	Identifier   string          `json:"identifier"`
+	CRS          json.RawMessage `json:"crs"`
+	SupportedCRS string          `json:"supportedCRS"`
+	OrderedAxes  []string        `json:"orderedAxes"`
+	TileMatrices []*tmsMatrix    `json:"tileMatrices"`
+	TileMatrix   []*tmsMatrix    `json:"tileMatrix"`
+}
+
+type tmsMatrix struct {
+	Id               string    `json:"id"`
+	Identifier       string    `json:"identifier"`
+	ScaleDenominator float64   `json:"scaleDenominator"`
+	CellSize         float64   `json:"cellSize"`
+	CornerOfOrigin   string    `json:"cornerOfOrigin"`
+	PointOfOrigin    []float64 `json:"pointOfOrigin"`
+	TopLeftCorner    []float64 `json:"topLeftCorner"`
+	TileWidth        uint      `json:"tileWidth"`
+	TileHeight       uint      `json:"tileHeight"`
+	MatrixWidth      uint      `json:"matrixWidth"`
+	MatrixHeight     uint      `json:"matrixHeight"`
+}
+
+// NewTileMatrixSetFromFile returns a new TileMatrixSet instance derived from the Tile Matrix Set JSON document in
+// 'path'. The document's coordinate reference system must be one of EPSG:3857 or EPSG:4326 (or OGC:CRS84). This is
+// the method used by the -tile-matrix-set flag of the command line tools so they share the same limitation; tile
+// matrix sets in other systems need to be created with the NewTileMatrixSetWithProjection method.
+func NewTileMatrixSetFromFile(path string) (*TileMatrixSet, error) {
+
+	r, err := os.Open(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open '%s', %w", path, err)
+	}
+
+	defer r.Close()
+
+	return NewTileMatrixSetWithReader(r)
+}
+
+// NewTileMatrixSetWithReader returns a new TileMatrixSet instance derived from the Tile Matrix Set JSON document
+// in 'r'. Both version 1.0 and version 2.0 documents are supported. The document's coordinate reference system must
+// be one of EPSG:3857 or EPSG:4326 (or OGC:CRS84); use the NewTileMatrixSetWithProjection method for other systems.
+func NewTileMatrixSetWithReader(r io.Reader) (*TileMatrixSet, error) {
+	return NewTileMatrixSetWithProjection(r, nil, nil)
+}
+
+// NewTileMatrixSetWithProjection returns a new TileMatrixSet instance derived from the Tile Matrix Set JSON document
+// in 'r' using 'to_native' and 'from_native' to convert between geographic coordinates and the native coordinates of
+// the document's coordinate reference system. If both are nil the projection is derived from the document's
+// coordinate reference system.
+func NewTileMatrixSetWithProjection(r io.Reader, to_native orb.Projection, from_native orb.Projection) (*TileMatrixSet, error) {
+
+	var doc tmsDocument
+
+	dec := json.NewDecoder(r)
+	err := dec.Decode(&doc)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode tile matrix set, %w", err)
+	}
+
+	crs, err := doc.crs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	srid := sridForCRS(crs)
+
+	if (to_native == nil) != (from_native == nil) {
+		return nil, fmt.Errorf("Both native projections must be defined")
+	}
+
+	if to_native == nil {
+
+		switch srid {
+		case SRID_WEB_MERCATOR:
+			to_native = project.WGS84.ToMercator
+			from_native = project.Mercator.ToWGS84
+		case SRID_GEOGRAPHIC:
+			to_native = identityProjection
+			from_native = identityProjection
+		default:
+			return nil, fmt.Errorf("Unsupported coordinate reference system '%s', native projections must be provided for systems other than EPSG:3857 and EPSG:4326", crs)
+		}
+	}
+
+	// Geographic coordinates are expected to be (longitude, latitude) but EPSG:4326 defines its axes
+	// as (latitude, longitude) so check whether points in the document need to be swapped.
+
+	swap_axes := false
+
+	if len(doc.OrderedAxes) > 0 {
+
+		switch strings.ToUpper(doc.OrderedAxes[0]) {
+		case "LAT", "LATITUDE", "Y", "N", "NORTHING":
+			swap_axes = true
+		}
+
+	} else if srid == SRID_GEOGRAPHIC && !strings.Contains(strings.ToUpper(crs), "CRS84") {
+		swap_axes = true
+	}
+
+	doc_matrices := doc.TileMatrices
+
+	if len(doc_matrices) == 0 {
+		doc_matrices = doc.TileMatrix
+	}
+
+	if len(doc_matrices) == 0 {
+		return nil, fmt.Errorf("Tile matrix set does not define any tile matrices")
+	}
+
+	matrices := make([]*TileMatrix, len(doc_matrices))
+
+	for i, m := range doc_matrices {
+
+		tm, err := m.tileMatrix(srid, swap_axes)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid tile matrix at offset %d, %w", i, err)
+		}
+
+		matrices[i] = tm
+	}
+
+	sort.SliceStable(matrices, func(i, j int) bool {
+		return matrices[i].CellSize > matrices[j].CellSize
+	})
+
+	id := doc.Id
+
+	if id == "" {
+		id = doc.Identifier
+	}
+
+	tms := &TileMatrixSet{
+		Id:          id,
+		CRS:         crs,
+		Matrices:    matrices,
+		srid:        srid,
+		to_native:   to_native,
+		from_native: from_native,
+	}
+
+	return tms, nil
+}
+
+// SRID returns the EPSG code of the tile matrix set's coordinate reference system or 0 if it could not be determined.
+func (tms *TileMatrixSet) SRID() uint {
+	return tms.srid
+}
+
+// Size returns a tile whose X and Y values are the number of columns and rows in the tile matrix for zoom level 'z'.
+func (tms *TileMatrixSet) Size(z uint) (*slippy.Tile, bool) {
+
+	m, ok := tms.matrix(z)
+
+	if !ok {
+		return nil, false
+	}
+
+	return slippy.NewTile(z, m.MatrixWidth, m.MatrixHeight), true
+}
+
+// FromNative returns the tile at zoom level 'z' containing 'pt' which is expected to be in native coordinates.
+func (tms *TileMatrixSet) FromNative(z uint, pt geom.Point) (*slippy.Tile, bool) {
+
+	m, ok := tms.matrix(z)
+
+	if !ok {
+		return nil, false
+	}
+
+	w := m.CellSize * float64(m.TileWidth)
+	h := m.CellSize * float64(m.TileHeight)
+
+	fx := (pt.X() - m.Origin.X()) / w
+	fy := (m.Origin.Y() - pt.Y()) / h
+
+	if m.BottomLeft {
+		fy = (pt.Y() - m.Origin.Y()) / h
+	}
+
+	if fx < 0 || fy < 0 || fx >= float64(m.MatrixWidth) || fy >= float64(m.MatrixHeight) {
+		return nil, false
+	}
+
+	return slippy.NewTile(z, uint(fx), uint(fy)), true
+}
+
+// ToNative returns the corner of 't' nearest the tile matrix origin, in native coordinates. For tile matrices with a
+// top left origin this is the upper left corner of the tile. As with other slippy.Grid implementations tiles whose
+// X and Y values are one more than the size of the tile matrix are allowed in order to derive the far corner of
+// the matrix.
+func (tms *TileMatrixSet) ToNative(t *slippy.Tile) (geom.Point, bool) {
+
+	m, ok := tms.matrix(t.Z)
+
+	if !ok || t.X > m.MatrixWidth || t.Y > m.MatrixHeight {
+		return geom.Point{}, false
+	}
+
+	w := m.CellSize * float64(m.TileWidth)
+	h := m.CellSize * float64(m.TileHeight)
+
+	x := m.Origin.X() + float64(t.X)*w
+	y := m.Origin.Y() - float64(t.Y)*h
+
+	if m.BottomLeft {
+		y = m.Origin.Y() + float64(t.Y)*h
+	}
+
+	return geom.Point{x, y}, true
+}
+
+// ToNativeProjection returns an orb.Projection for converting geographic coordinates in to native coordinates.
+func (tms *TileMatrixSet) ToNativeProjection() orb.Projection {
+	return tms.to_native
+}
+
+// FromNativeProjection returns an orb.Projection for converting native coordinates in to geographic coordinates.
+func (tms *TileMatrixSet) FromNativeProjection() orb.Projection {
+	return tms.from_native
+}
+
+func (tms *TileMatrixSet) matrix(z uint) (*TileMatrix, bool) {
+
+	if z >= uint(len(tms.Matrices)) {
+		return nil, false
+	}
+
+	return tms.Matrices[z], true
+}
+
+// crs returns the URI of the document's coordinate reference system. Version 2.0 documents define this as either
+// a string or an object with a "uri" property. Version 1.0 documents use the "supportedCRS" property.
+func (doc *tmsDocument) crs() (string, error) {
+
+	if len(doc.CRS) == 0 {
+
+		if doc.SupportedCRS == "" {
+			return "", fmt.Errorf("Tile matrix set is missing a coordinate reference system")
+		}
+
+		return doc.SupportedCRS, nil
+	}
+
+	var str_crs string
+
+	err := json.Unmarshal(doc.CRS, &str_crs)
+
+	if err == nil {
+		return str_crs, nil
+	}
+
+	var obj_crs struct {
+		URI string `json:"uri"`
+	}
+
+	err = json.Unmarshal(doc.CRS, &obj_crs)
+
+	if err != nil || obj_crs.URI == "" {
+		return "", fmt.Errorf("Unsupported coordinate reference system definition")
+	}
+
+	return obj_crs.URI, nil
+}
+
+func (m *tmsMatrix) tileMatrix(srid uint, swap_axes bool) (*TileMatrix, error) {
+
+	id := m.Id
+
+	if id == "" {
+		id = m.Identifier
+	}
+
+	cell_size := m.CellSize
+
+	if cell_size == 0 {
+
+		if m.ScaleDenominator == 0 {
+			return nil, fmt.Errorf("Missing cell size")
+		}
+
+		cell_size = m.ScaleDenominator * tms_pixel_size / metersPerUnit(srid)
+	}
+
+	origin := m.PointOfOrigin
+
+	if len(origin) == 0 {
+		origin = m.TopLeftCorner
+	}
+
+	if len(origin) != 2 {
+		return nil, fmt.Errorf("Invalid point of origin")
+	}
+
+	pt := orb.Point{origin[0], origin[1]}
+
+	if swap_axes {
+		pt = orb.Point{origin[1], origin[0]}
+	}
+
+	bottom_left := false
+
+	switch m.CornerOfOrigin {
+	case "", "topLeft":
+		// pass
+	case "bottomLeft":
+		bottom_left = true
+	default:
+		return nil, fmt.Errorf("Unsupported corner of origin '%s'", m.CornerOfOrigin)
+	}
+
+	if m.TileWidth == 0 || m.TileHeight == 0 || m.MatrixWidth == 0 || m.MatrixHeight == 0 {
+		return nil, fmt.Errorf("Invalid tile or matrix dimensions")
+	}
+
+	tm := &TileMatrix{
+		Id:           id,
+		CellSize:     cell_size,
+		Origin:       pt,
+		BottomLeft:   bottom_left,
+		TileWidth:    m.TileWidth,
+		TileHeight:   m.TileHeight,
+		MatrixWidth:  m.MatrixWidth,
+		MatrixHeight: m.MatrixHeight,
+	}
+
+	return tm, nil
+}
+
+// sridForCRS returns the EPSG code for 'crs' or 0 if it can not be determined.
+func sridForCRS(crs string) uint {
+
+	if strings.Contains(strings.ToUpper(crs), "CRS84") {
+		return SRID_GEOGRAPHIC
+	}
+
+	m := re_epsg.FindStringSubmatch(crs)
+
+	if len(m) == 0 {
+		return 0
+	}
+
+	v, err := strconv.ParseUint(m[1], 10, 32)
+
+	if err != nil {
+		return 0
+	}
+
+	switch v {
+	case 900913, 3785:
+		return SRID_WEB_MERCATOR
+	default:
+		return uint(v)
+	}
+}
+
+// metersPerUnit returns the number of metres in one unit of the coordinate reference system for 'srid'.
+func metersPerUnit(srid uint) float64 {
+
+	switch srid {
+	case SRID_GEOGRAPHIC:
+		return 2 * math.Pi * 6378137.0 / 360.0
+	default:
+		return 1.0
+	}
+}
@@ -0,0 +1,79 @@
+package writer
+
+import (
+	"context"
+	"fmt"
+	"github.com/paulmach/orb/maptile"
+	"gocloud.dev/blob"
+	"io"
+)
+
+// BlobWriter implements the Writer interface for writing tiles to a gocloud.dev/blob bucket as individual
+// {Z}/{X}/{Y}.{EXTENSION} objects.
+type BlobWriter struct {
+	bucket *blob.Bucket
+}
+
+var _ Writer = (*BlobWriter)(nil)
+
+// NewBlobWriter returns a new BlobWriter instance for 'uri' which is expected to be a valid gocloud.dev/blob bucket
+// URI. The relevant gocloud.dev/blob driver (for example gocloud.dev/blob/fileblob) needs to have been imported.
+func NewBlobWriter(ctx context.Context, uri string) (Writer, error) {
+
+	bucket, err := blob.OpenBucket(ctx, uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open bucket, %w", err)
+	}
+
+	return NewBlobWriterWithBucket(ctx, bucket)
+}
+
+// NewBlobWriterWithBucket returns a new BlobWriter instance for 'bucket'. The bucket will be closed when the
+// writer's Close method is invoked.
+func NewBlobWriterWithBucket(ctx context.Context, bucket *blob.Bucket) (Writer, error) {
+
+	wr := &BlobWriter{
+		bucket: bucket,
+	}
+
+	return wr, nil
+}
+
+// WriteTile writes 'body' to {Z}/{X}/{Y}.{EXTENSION} in the writer's bucket. If 'format' implements the
+// EncodedTileFormat interface its content encoding is recorded with the object.
+func (wr *BlobWriter) WriteTile(ctx context.Context, t maptile.Tile, format TileFormat, body io.Reader) error {
+
+	path := fmt.Sprintf("%d/%d/%d.%s", t.Z, t.X, t.Y, format.Extension())
+
+	wr_opts := &blob.WriterOptions{
+		ContentType:     format.ContentType(),
+		ContentEncoding: ContentEncoding(format),
+	}
+
+	bucket_wr, err := wr.bucket.NewWriter(ctx, path, wr_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create new writer for '%s', %w", path, err)
+	}
+
+	_, err = io.Copy(bucket_wr, body)
+
+	if err != nil {
+		bucket_wr.Close()
+		return fmt.Errorf("Failed to write '%s', %w", path, err)
+	}
+
+	err = bucket_wr.Close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to close '%s', %w", path, err)
+	}
+
+	return nil
+}
+
+// Close closes the writer's underlying bucket.
+func (wr *BlobWriter) Close(ctx context.Context) error {
+	return wr.bucket.Close()
+}
@@ -0,0 +1,348 @@
+package writer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+	"github.com/sfomuseum/go-whosonfirst-tiles/internal/sqlite"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// The MBTiles (v1.3) specification is here: https://github.com/mapbox/mbtiles-spec/blob/master/1.3/spec.md
+
+// The default database/sql driver used to open MBTiles databases.
+const MBTILES_DEFAULT_DRIVER string = "sqlite3"
+
+// The default number of tiles to write in a single database transaction.
+const MBTILES_DEFAULT_BATCH_SIZE int = 1000
+
+const mbtiles_schema string = `CREATE TABLE IF NOT EXISTS metadata (name TEXT, value TEXT);
+CREATE UNIQUE INDEX IF NOT EXISTS metadata_name ON metadata (name);
+CREATE TABLE IF NOT EXISTS tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB);
+CREATE UNIQUE INDEX IF NOT EXISTS tile_index ON tiles (zoom_level, tile_column, tile_row);`
+
+func init() {
+	ctx := context.Background()
+	RegisterWriter(ctx, "mbtiles", NewMBTilesWriter)
+}
+
+// MBTilesWriter implements the Writer interface for writing tiles to an MBTiles (SQLite) database. Tiles
+// are assumed to follow the web mercator (EPSG:3857) tiling scheme required by the MBTiles specification.
+type MBTilesWriter struct {
+	db            *sql.DB
+	batch         *sqlite.Batch
+	mu            *sync.Mutex
+	name          string
+	description   string
+	attribution   string
+	layer_type    string
+	format        string
+	min_zoom      int
+	max_zoom      int
+	bounds        *orb.Bound
+	vector_layers vectorLayers
+}
+
+var _ GridWriter = (*MBTilesWriter)(nil)
+
+// NewMBTilesWriter returns a new MBTilesWriter instance configured by 'uri' which is expected to take the form of:
+//
+//	mbtiles://{PATH}?{PARAMETERS}
+//
+// Where {PATH} is the path to the MBTiles database to create (or update) and {PARAMETERS} may be:
+// * `driver` The name of the database/sql driver used to open the database. Default is "sqlite3". The driver needs to have been imported by the calling code.
+// * `name` The name of the tileset. Default is the basename of {PATH}.
+// * `description` An optional description of the tileset.
+// * `attribution` An optional attribution string for the tileset.
+// * `type` The type of tileset. Valid options are "overlay" or "baselayer". Default is "overlay".
+// * `batch_size` The number of tiles to write in a single database transaction. Default is 1000.
+func NewMBTilesWriter(ctx context.Context, uri string) (Writer, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	path := u.Path
+
+	if u.Host != "" {
+		path = u.Host + u.Path
+	}
+
+	if path == "" {
+		return nil, fmt.Errorf("Missing MBTiles path")
+	}
+
+	q := u.Query()
+
+	driver := MBTILES_DEFAULT_DRIVER
+
+	if q.Get("driver") != "" {
+		driver = q.Get("driver")
+	}
+
+	name := q.Get("name")
+
+	if name == "" {
+		name = baseName(path)
+	}
+
+	layer_type := "overlay"
+
+	switch q.Get("type") {
+	case "":
+		// pass
+	case "overlay", "baselayer":
+		layer_type = q.Get("type")
+	default:
+		return nil, fmt.Errorf("Invalid ?type= parameter")
+	}
+
+	batch_size := MBTILES_DEFAULT_BATCH_SIZE
+
+	if q.Get("batch_size") != "" {
+
+		v, err := strconv.Atoi(q.Get("batch_size"))
+
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("Invalid ?batch_size= parameter")
+		}
+
+		batch_size = v
+	}
+
+	db, err := sqlite.OpenDatabase(ctx, driver, path, mbtiles_schema)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create MBTiles database, %w", err)
+	}
+
+	wr := &MBTilesWriter{
+		db:            db,
+		batch:         sqlite.NewBatch(db, batch_size),
+		mu:            new(sync.Mutex),
+		name:          name,
+		description:   q.Get("description"),
+		attribution:   q.Get("attribution"),
+		layer_type:    layer_type,
+		min_zoom:      -1,
+		max_zoom:      -1,
+		vector_layers: make(vectorLayers),
+	}
+
+	return wr, nil
+}
+
+// WriteTile writes 'body' to the "tiles" table in the writer's database. Tile rows are flipped to follow the TMS
+// scheme required by the MBTiles specification.
+func (wr *MBTilesWriter) WriteTile(ctx context.Context, t maptile.Tile, format TileFormat, body io.Reader) error {
+
+	if !isWebMercatorTile(t) {
+		return fmt.Errorf("Tile %d/%d/%d is not a valid web mercator tile", t.Z, t.X, t.Y)
+	}
+
+	data, err := io.ReadAll(body)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read tile, %w", err)
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	// The "format" metadata key applies to every tile so they must all be in the same format.
+
+	tile_format := mbtilesFormat(format)
+
+	if wr.format == "" {
+		wr.format = tile_format
+	} else if wr.format != tile_format {
+		return fmt.Errorf("Tile %d/%d/%d does not use the same format as previous tiles", t.Z, t.X, t.Y)
+	}
+
+	tms_t := tiles.FlipY(t)
+
+	err = wr.batch.Exec(ctx, "INSERT OR REPLACE INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)", int(tms_t.Z), int(tms_t.X), int(tms_t.Y), data)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write tile %d/%d/%d, %w", t.Z, t.X, t.Y, err)
+	}
+
+	z := int(t.Z)
+
+	if wr.min_zoom == -1 || z < wr.min_zoom {
+		wr.min_zoom = z
+	}
+
+	if z > wr.max_zoom {
+		wr.max_zoom = z
+	}
+
+	b := t.Bound()
+
+	if wr.bounds == nil {
+		wr.bounds = &b
+	} else {
+		union := wr.bounds.Union(b)
+		wr.bounds = &union
+	}
+
+	if wr.format == "pbf" {
+
+		layers, err := mvtLayerFields(data)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive vector layers for tile %d/%d/%d, %w", t.Z, t.X, t.Y, err)
+		}
+
+		wr.vector_layers.add(z, layers)
+	}
+
+	return nil
+}
+
+// SupportsGrid reports whether 'g' is a web mercator (EPSG:3857) grid, which is the only tiling scheme supported by the
+// MBTiles specification.
+func (wr *MBTilesWriter) SupportsGrid(g slippy.Grid) bool {
+	return tiles.IsWebMercator(g)
+}
+
+// Close commits any pending tiles, writes the "metadata" table and closes the writer's database.
+func (wr *MBTilesWriter) Close(ctx context.Context) error {
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	err := wr.batch.Commit()
+
+	if err != nil {
+		return err
+	}
+
+	metadata, err := wr.metadata()
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive metadata, %w", err)
+	}
+
+	keys := make([]string, 0)
+
+	for k, _ := range metadata {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+
+		_, err := wr.db.ExecContext(ctx, "INSERT OR REPLACE INTO metadata (name, value) VALUES (?, ?)", k, metadata[k])
+
+		if err != nil {
+			return fmt.Errorf("Failed to write metadata for '%s', %w", k, err)
+		}
+	}
+
+	return wr.db.Close()
+}
+
+func (wr *MBTilesWriter) metadata() (map[string]string, error) {
+
+	metadata := map[string]string{
+		"name":    wr.name,
+		"type":    wr.layer_type,
+		"version": "1.0",
+	}
+
+	if wr.description != "" {
+		metadata["description"] = wr.description
+	}
+
+	if wr.attribution != "" {
+		metadata["attribution"] = wr.attribution
+	}
+
+	if wr.format != "" {
+		metadata["format"] = wr.format
+	}
+
+	if wr.min_zoom == -1 {
+		return metadata, nil
+	}
+
+	metadata["minzoom"] = strconv.Itoa(wr.min_zoom)
+	metadata["maxzoom"] = strconv.Itoa(wr.max_zoom)
+
+	b := wr.bounds
+	c := b.Center()
+
+	metadata["bounds"] = fmt.Sprintf("%s,%s,%s,%s", formatCoord(b.Min.X()), formatCoord(b.Min.Y()), formatCoord(b.Max.X()), formatCoord(b.Max.Y()))
+	metadata["center"] = fmt.Sprintf("%s,%s,%d", formatCoord(c.X()), formatCoord(c.Y()), wr.min_zoom)
+
+	if wr.format == "pbf" {
+
+		enc, err := json.Marshal(map[string]interface{}{
+			"vector_layers": wr.vector_layers.sorted(),
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to marshal vector layers, %w", err)
+		}
+
+		metadata["json"] = string(enc)
+	}
+
+	return metadata, nil
+}
+
+// mbtilesFormat returns the value of the MBTiles "format" metadata key for 'format'. The specification defines
+// "pbf", "jpg", "png" and "webp" and otherwise expects an IETF media type.
+func mbtilesFormat(format TileFormat) string {
+
+	switch format.Extension() {
+	case "pbf", "mvt":
+		return "pbf"
+	case "jpg", "jpeg":
+		return "jpg"
+	case "png":
+		return "png"
+	case "webp":
+		return "webp"
+	default:
+		return format.ContentType()
+	}
+}
+
+// isWebMercatorTile reports whether the column and row of 't' are within the bounds of its zoom level in the web
+// mercator (EPSG:3857) tiling scheme.
+func isWebMercatorTile(t maptile.Tile) bool {
+
+	if t.Z > 31 {
+		return false
+	}
+
+	n := uint64(1) << t.Z
+
+	return uint64(t.X) < n && uint64(t.Y) < n
+}
+
+// baseName returns the filename of 'path' without its extension.
+func baseName(path string) string {
+
+	fname := filepath.Base(path)
+	return fname[:len(fname)-len(filepath.Ext(fname))]
+}
+
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', 6, 64)
+}
@@ -0,0 +1,273 @@
+package writer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io"
+	"sort"
+)
+
+// vectorLayer describes a single layer in the "vector_layers" metadata that some tile formats require.
+type vectorLayer struct {
+	Id      string            `json:"id"`
+	Fields  map[string]string `json:"fields"`
+	MinZoom int               `json:"minzoom"`
+	MaxZoom int               `json:"maxzoom"`
+}
+
+// vectorLayers accumulates the "vector_layers" metadata for the Mapbox Vector Tiles in a tileset, keyed by layer name.
+type vectorLayers map[string]*vectorLayer
+
+// add merges 'layers', as returned by mvtLayerFields for a tile at zoom level 'z', in to 'vl'.
+func (vl vectorLayers) add(z int, layers map[string]map[string]string) {
+
+	for name, fields := range layers {
+
+		l, ok := vl[name]
+
+		if !ok {
+
+			l = &vectorLayer{
+				Id:      name,
+				Fields:  make(map[string]string),
+				MinZoom: z,
+				MaxZoom: z,
+			}
+
+			vl[name] = l
+		}
+
+		for k, v := range fields {
+			l.Fields[k] = v
+		}
+
+		if z < l.MinZoom {
+			l.MinZoom = z
+		}
+
+		if z > l.MaxZoom {
+			l.MaxZoom = z
+		}
+	}
+}
+
+// sorted returns the layers in 'vl' sorted by name.
+func (vl vectorLayers) sorted() []*vectorLayer {
+
+	names := make([]string, 0)
+
+	for name, _ := range vl {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	layers := make([]*vectorLayer, len(names))
+
+	for i, name := range names {
+		layers[i] = vl[name]
+	}
+
+	return layers
+}
+
+// mvtLayerFields returns a dictionary of layer names, and the names and types ("String", "Number" or "Boolean") of
+// the properties in each layer, for the (optionally gzip-compressed) Mapbox Vector Tile data in 'body'. This is used
+// to derive the "vector_layers" metadata that some tile formats require.
+func mvtLayerFields(body []byte) (map[string]map[string]string, error) {
+
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create gzip reader, %w", err)
+		}
+
+		defer gz.Close()
+
+		body, err = io.ReadAll(gz)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decompress tile, %w", err)
+		}
+	}
+
+	layers := make(map[string]map[string]string)
+
+	err := consumeFields(body, func(num protowire.Number, typ protowire.Type, v []byte) error {
+
+		// Tile.layers
+
+		if num != 3 || typ != protowire.BytesType {
+			return nil
+		}
+
+		name, fields, err := mvtLayer(v)
+
+		if err != nil {
+			return err
+		}
+
+		_, ok := layers[name]
+
+		if !ok {
+			layers[name] = make(map[string]string)
+		}
+
+		for k, t := range fields {
+			layers[name][k] = t
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return layers, nil
+}
+
+func mvtLayer(body []byte) (string, map[string]string, error) {
+
+	var name string
+
+	keys := make([]string, 0)
+	values := make([]string, 0)
+	tags := make([]uint64, 0)
+
+	err := consumeFields(body, func(num protowire.Number, typ protowire.Type, v []byte) error {
+
+		if typ != protowire.BytesType {
+			return nil
+		}
+
+		switch num {
+		case 1:
+			name = string(v)
+		case 3:
+			keys = append(keys, string(v))
+		case 4:
+			values = append(values, mvtValueType(v))
+		case 2:
+
+			return consumeFields(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+
+				// Feature.tags
+
+				if num != 2 || typ != protowire.BytesType {
+					return nil
+				}
+
+				for len(v) > 0 {
+
+					t, n := protowire.ConsumeVarint(v)
+
+					if n < 0 {
+						return protowire.ParseError(n)
+					}
+
+					tags = append(tags, t)
+					v = v[n:]
+				}
+
+				return nil
+			})
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to parse layer, %w", err)
+	}
+
+	fields := make(map[string]string)
+
+	for i := 0; i+1 < len(tags); i += 2 {
+
+		k := tags[i]
+		v := tags[i+1]
+
+		if k >= uint64(len(keys)) || v >= uint64(len(values)) {
+			return "", nil, fmt.Errorf("Invalid tag (%d, %d) in layer '%s'", k, v, name)
+		}
+
+		fields[keys[k]] = values[v]
+	}
+
+	return name, fields, nil
+}
+
+// mvtValueType returns the type of the (encoded) Value message 'body' as used in "vector_layers" metadata.
+func mvtValueType(body []byte) string {
+
+	t := "String"
+
+	consumeFields(body, func(num protowire.Number, typ protowire.Type, v []byte) error {
+
+		switch num {
+		case 1:
+			t = "String"
+		case 7:
+			t = "Boolean"
+		default:
+			t = "Number"
+		}
+
+		return nil
+	})
+
+	return t
+}
+
+// consumeFields invokes 'cb' for each top-level field in the protobuf-encoded message 'body'. The value passed to
+// 'cb' is only meaningful for length-delimited (BytesType) fields.
+func consumeFields(body []byte, cb func(protowire.Number, protowire.Type, []byte) error) error {
+
+	for len(body) > 0 {
+
+		num, typ, n := protowire.ConsumeTag(body)
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		body = body[n:]
+
+		var v []byte
+
+		if typ == protowire.BytesType {
+
+			b, n := protowire.ConsumeBytes(body)
+
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+
+			v = b
+			body = body[n:]
+
+		} else {
+
+			n := protowire.ConsumeFieldValue(num, typ, body)
+
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+
+			body = body[n:]
+		}
+
+		err := cb(num, typ, v)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,680 @@
+package writer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles"
+	"gocloud.dev/blob"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+)
+
+// The PMTiles (v3) specification is here: https://github.com/protomaps/PMTiles/blob/main/spec/v3/spec.md
+
+// PMTILES_CONTENT_TYPE is the content type for PMTiles archives.
+const PMTILES_CONTENT_TYPE string = "application/vnd.pmtiles"
+
+const pmtiles_header_length int = 127
+
+// The header and the root directory need to fit in the first 16KB of an archive.
+const pmtiles_max_root_length int = 16384 - pmtiles_header_length
+
+const (
+	pmtiles_compression_unknown uint8 = 0
+	pmtiles_compression_none    uint8 = 1
+	pmtiles_compression_gzip    uint8 = 2
+)
+
+const (
+	pmtiles_type_unknown uint8 = 0
+	pmtiles_type_mvt     uint8 = 1
+	pmtiles_type_png     uint8 = 2
+	pmtiles_type_jpeg    uint8 = 3
+	pmtiles_type_webp    uint8 = 4
+)
+
+func init() {
+	ctx := context.Background()
+	RegisterWriter(ctx, "pmtiles", NewPMTilesWriter)
+}
+
+// PMTilesWriter implements the Writer interface for writing tiles to a single PMTiles (v3) archive. Tile bodies are
+// spooled to a temporary file, with identical bodies only being stored once, and the final archive (header,
+// directories, metadata and clustered tile data) is assembled and written to a gocloud.dev/blob bucket when the
+// writer's Close method is invoked. Tiles are assumed to follow the web mercator (EPSG:3857) tiling scheme required by
+// the PMTiles specification.
+type PMTilesWriter struct {
+	bucket_uri    string
+	key           string
+	name          string
+	description   string
+	attribution   string
+	layer_type    string
+	mu            *sync.Mutex
+	spool         *os.File
+	spool_length  uint64
+	contents      map[[32]byte]*pmtilesContent
+	tiles         map[uint64]*pmtilesContent
+	tile_type     uint8
+	compression   uint8
+	format        string
+	min_zoom      int
+	max_zoom      int
+	bounds        *orb.Bound
+	vector_layers vectorLayers
+}
+
+var _ GridWriter = (*PMTilesWriter)(nil)
+
+// pmtilesContent is a unique tile body in the writer's spool file.
+type pmtilesContent struct {
+	spool_offset uint64
+	length       uint64
+	// The offset of the tile body in the final archive's tile data section, assigned when the archive is assembled.
+	offset uint64
+	placed bool
+}
+
+// pmtilesEntry is a PMTiles directory entry.
+type pmtilesEntry struct {
+	TileId    uint64
+	Offset    uint64
+	Length    uint32
+	RunLength uint32
+}
+
+// NewPMTilesWriter returns a new PMTilesWriter instance configured by 'uri' which is expected to take the form of:
+//
+//	pmtiles://?{PARAMETERS}
+//
+// Where {PARAMETERS} may be:
+// * `bucket_uri` A valid gocloud.dev/blob bucket URI where the final archive will be written. Required.
+// * `key` The name of the final archive in the bucket. Default is "tiles.pmtiles".
+// * `name` The name of the tileset. Default is the basename of `key`.
+// * `description` An optional description of the tileset.
+// * `attribution` An optional attribution string for the tileset.
+// * `type` The type of tileset. Valid options are "overlay" or "baselayer". Default is "overlay".
+func NewPMTilesWriter(ctx context.Context, uri string) (Writer, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse URI, %w", err)
+	}
+
+	q := u.Query()
+
+	bucket_uri := q.Get("bucket_uri")
+
+	if bucket_uri == "" {
+		return nil, fmt.Errorf("Missing ?bucket_uri= parameter")
+	}
+
+	key := q.Get("key")
+
+	if key == "" {
+		key = "tiles.pmtiles"
+	}
+
+	name := q.Get("name")
+
+	if name == "" {
+		name = baseName(key)
+	}
+
+	layer_type := "overlay"
+
+	switch q.Get("type") {
+	case "":
+		// pass
+	case "overlay", "baselayer":
+		layer_type = q.Get("type")
+	default:
+		return nil, fmt.Errorf("Invalid ?type= parameter")
+	}
+
+	spool, err := os.CreateTemp("", "pmtiles-*")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create spool file, %w", err)
+	}
+
+	wr := &PMTilesWriter{
+		bucket_uri:    bucket_uri,
+		key:           key,
+		name:          name,
+		description:   q.Get("description"),
+		attribution:   q.Get("attribution"),
+		layer_type:    layer_type,
+		mu:            new(sync.Mutex),
+		spool:         spool,
+		contents:      make(map[[32]byte]*pmtilesContent),
+		tiles:         make(map[uint64]*pmtilesContent),
+		compression:   pmtiles_compression_unknown,
+		min_zoom:      -1,
+		max_zoom:      -1,
+		vector_layers: make(vectorLayers),
+	}
+
+	return wr, nil
+}
+
+// WriteTile adds 'body' to the writer's spool file, unless an identical tile body has already been written, and
+// records its position in the final archive.
+func (wr *PMTilesWriter) WriteTile(ctx context.Context, t maptile.Tile, format TileFormat, body io.Reader) error {
+
+	if !isWebMercatorTile(t) {
+		return fmt.Errorf("Tile %d/%d/%d is not a valid web mercator tile", t.Z, t.X, t.Y)
+	}
+
+	data, err := io.ReadAll(body)
+
+	if err != nil {
+		return fmt.Errorf("Failed to read tile, %w", err)
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	if len(data) > math.MaxUint32 {
+		return fmt.Errorf("Tile %d/%d/%d is too large", t.Z, t.X, t.Y)
+	}
+
+	compression := pmtiles_compression_none
+
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		compression = pmtiles_compression_gzip
+	}
+
+	hash := sha256.Sum256(data)
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if wr.compression == pmtiles_compression_unknown {
+		wr.compression = compression
+	} else if wr.compression != compression {
+		return fmt.Errorf("Tile %d/%d/%d does not use the same compression as previous tiles", t.Z, t.X, t.Y)
+	}
+
+	// A PMTiles archive has a single tile type so every tile must be in the same format.
+
+	tile_type := pmtilesTileType(format)
+	tile_format := mbtilesFormat(format)
+
+	if wr.format == "" {
+		wr.tile_type = tile_type
+		wr.format = tile_format
+	} else if wr.tile_type != tile_type || wr.format != tile_format {
+		return fmt.Errorf("Tile %d/%d/%d does not use the same format as previous tiles", t.Z, t.X, t.Y)
+	}
+
+	c, ok := wr.contents[hash]
+
+	if !ok {
+
+		_, err := wr.spool.Write(data)
+
+		if err != nil {
+			return fmt.Errorf("Failed to write tile %d/%d/%d to spool, %w", t.Z, t.X, t.Y, err)
+		}
+
+		c = &pmtilesContent{
+			spool_offset: wr.spool_length,
+			length:       uint64(len(data)),
+		}
+
+		wr.spool_length += uint64(len(data))
+		wr.contents[hash] = c
+	}
+
+	wr.tiles[pmtilesTileId(t)] = c
+
+	z := int(t.Z)
+
+	if wr.min_zoom == -1 || z < wr.min_zoom {
+		wr.min_zoom = z
+	}
+
+	if z > wr.max_zoom {
+		wr.max_zoom = z
+	}
+
+	b := t.Bound()
+
+	if wr.bounds == nil {
+		wr.bounds = &b
+	} else {
+		union := wr.bounds.Union(b)
+		wr.bounds = &union
+	}
+
+	if wr.tile_type == pmtiles_type_mvt {
+
+		layers, err := mvtLayerFields(data)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive vector layers for tile %d/%d/%d, %w", t.Z, t.X, t.Y, err)
+		}
+
+		wr.vector_layers.add(z, layers)
+	}
+
+	return nil
+}
+
+// SupportsGrid reports whether 'g' is a web mercator (EPSG:3857) grid, which is the only tiling scheme supported by the
+// PMTiles specification.
+func (wr *PMTilesWriter) SupportsGrid(g slippy.Grid) bool {
+	return tiles.IsWebMercator(g)
+}
+
+// Close assembles the final PMTiles archive, writes it to the writer's bucket and removes the spool file.
+func (wr *PMTilesWriter) Close(ctx context.Context) error {
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	defer func() {
+		wr.spool.Close()
+		os.Remove(wr.spool.Name())
+	}()
+
+	// Tile bodies are written in the order of the (Hilbert curve) tile IDs that first reference them so
+	// that the archive is "clustered".
+
+	tile_ids := make([]uint64, 0, len(wr.tiles))
+
+	for id, _ := range wr.tiles {
+		tile_ids = append(tile_ids, id)
+	}
+
+	sort.Slice(tile_ids, func(i, j int) bool {
+		return tile_ids[i] < tile_ids[j]
+	})
+
+	order := make([]*pmtilesContent, 0, len(wr.contents))
+	entries := make([]*pmtilesEntry, 0, len(tile_ids))
+
+	var data_length uint64
+	var addressed uint64
+
+	for _, id := range tile_ids {
+
+		c := wr.tiles[id]
+
+		if !c.placed {
+			c.offset = data_length
+			c.placed = true
+			data_length += c.length
+			order = append(order, c)
+		}
+
+		addressed += 1
+
+		if len(entries) > 0 {
+
+			last := entries[len(entries)-1]
+
+			if last.TileId+uint64(last.RunLength) == id && last.Offset == c.offset && last.RunLength < math.MaxUint32 {
+				last.RunLength += 1
+				continue
+			}
+		}
+
+		e := &pmtilesEntry{
+			TileId:    id,
+			Offset:    c.offset,
+			Length:    uint32(c.length),
+			RunLength: 1,
+		}
+
+		entries = append(entries, e)
+	}
+
+	root, leaves, err := pmtilesDirectories(entries)
+
+	if err != nil {
+		return fmt.Errorf("Failed to build directories, %w", err)
+	}
+
+	metadata, err := wr.metadata()
+
+	if err != nil {
+		return fmt.Errorf("Failed to derive metadata, %w", err)
+	}
+
+	root_offset := uint64(pmtiles_header_length)
+	metadata_offset := root_offset + uint64(len(root))
+	leaves_offset := metadata_offset + uint64(len(metadata))
+	data_offset := leaves_offset + uint64(len(leaves))
+
+	header := make([]byte, pmtiles_header_length)
+
+	copy(header[0:7], "PMTiles")
+	header[7] = 3
+
+	binary.LittleEndian.PutUint64(header[8:16], root_offset)
+	binary.LittleEndian.PutUint64(header[16:24], uint64(len(root)))
+	binary.LittleEndian.PutUint64(header[24:32], metadata_offset)
+	binary.LittleEndian.PutUint64(header[32:40], uint64(len(metadata)))
+	binary.LittleEndian.PutUint64(header[40:48], leaves_offset)
+	binary.LittleEndian.PutUint64(header[48:56], uint64(len(leaves)))
+	binary.LittleEndian.PutUint64(header[56:64], data_offset)
+	binary.LittleEndian.PutUint64(header[64:72], data_length)
+	binary.LittleEndian.PutUint64(header[72:80], addressed)
+	binary.LittleEndian.PutUint64(header[80:88], uint64(len(entries)))
+	binary.LittleEndian.PutUint64(header[88:96], uint64(len(order)))
+
+	header[96] = 1 // clustered
+	header[97] = pmtiles_compression_gzip
+	header[98] = wr.compression
+	header[99] = wr.tile_type
+
+	if wr.bounds != nil {
+
+		b := wr.bounds
+		c := b.Center()
+
+		header[100] = uint8(wr.min_zoom)
+		header[101] = uint8(wr.max_zoom)
+
+		binary.LittleEndian.PutUint32(header[102:106], uint32(e7(b.Min.X())))
+		binary.LittleEndian.PutUint32(header[106:110], uint32(e7(b.Min.Y())))
+		binary.LittleEndian.PutUint32(header[110:114], uint32(e7(b.Max.X())))
+		binary.LittleEndian.PutUint32(header[114:118], uint32(e7(b.Max.Y())))
+
+		header[118] = uint8(wr.min_zoom)
+
+		binary.LittleEndian.PutUint32(header[119:123], uint32(e7(c.X())))
+		binary.LittleEndian.PutUint32(header[123:127], uint32(e7(c.Y())))
+	}
+
+	bucket, err := blob.OpenBucket(ctx, wr.bucket_uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to open bucket, %w", err)
+	}
+
+	defer bucket.Close()
+
+	wr_opts := &blob.WriterOptions{
+		ContentType: PMTILES_CONTENT_TYPE,
+	}
+
+	bucket_wr, err := bucket.NewWriter(ctx, wr.key, wr_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create new writer for '%s', %w", wr.key, err)
+	}
+
+	for _, b := range [][]byte{header, root, metadata, leaves} {
+
+		_, err := bucket_wr.Write(b)
+
+		if err != nil {
+			bucket_wr.Close()
+			return fmt.Errorf("Failed to write '%s', %w", wr.key, err)
+		}
+	}
+
+	for _, c := range order {
+
+		r := io.NewSectionReader(wr.spool, int64(c.spool_offset), int64(c.length))
+
+		_, err := io.Copy(bucket_wr, r)
+
+		if err != nil {
+			bucket_wr.Close()
+			return fmt.Errorf("Failed to write tile data to '%s', %w", wr.key, err)
+		}
+	}
+
+	err = bucket_wr.Close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to close '%s', %w", wr.key, err)
+	}
+
+	return nil
+}
+
+// metadata returns the gzip-compressed JSON metadata for the archive.
+func (wr *PMTilesWriter) metadata() ([]byte, error) {
+
+	metadata := map[string]interface{}{
+		"name":    wr.name,
+		"type":    wr.layer_type,
+		"version": "1.0",
+	}
+
+	if wr.description != "" {
+		metadata["description"] = wr.description
+	}
+
+	if wr.attribution != "" {
+		metadata["attribution"] = wr.attribution
+	}
+
+	if wr.format != "" {
+		metadata["format"] = wr.format
+	}
+
+	if wr.tile_type == pmtiles_type_mvt {
+
+		metadata["vector_layers"] = wr.vector_layers.sorted()
+	}
+
+	enc, err := json.Marshal(metadata)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal metadata, %w", err)
+	}
+
+	return gzipBytes(enc)
+}
+
+// pmtilesDirectories returns the (compressed) root directory and leaf directories for 'entries'. If all the entries
+// fit in the root directory then no leaf directories are created. Otherwise entries are divided in to leaf
+// directories, and the root directory points to those, increasing the number of entries per leaf until the root
+// directory fits.
+func pmtilesDirectories(entries []*pmtilesEntry) ([]byte, []byte, error) {
+
+	root, err := pmtilesDirectory(entries)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(root) <= pmtiles_max_root_length {
+		return root, []byte{}, nil
+	}
+
+	leaf_size := 4096
+
+	for {
+
+		root_entries := make([]*pmtilesEntry, 0)
+		var leaves bytes.Buffer
+
+		for i := 0; i < len(entries); i += leaf_size {
+
+			j := i + leaf_size
+
+			if j > len(entries) {
+				j = len(entries)
+			}
+
+			leaf, err := pmtilesDirectory(entries[i:j])
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			e := &pmtilesEntry{
+				TileId:    entries[i].TileId,
+				Offset:    uint64(leaves.Len()),
+				Length:    uint32(len(leaf)),
+				RunLength: 0,
+			}
+
+			root_entries = append(root_entries, e)
+			leaves.Write(leaf)
+		}
+
+		root, err := pmtilesDirectory(root_entries)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(root) <= pmtiles_max_root_length {
+			return root, leaves.Bytes(), nil
+		}
+
+		leaf_size = leaf_size * 2
+	}
+}
+
+// pmtilesDirectory returns the serialized, gzip-compressed, representation of 'entries'.
+func pmtilesDirectory(entries []*pmtilesEntry) ([]byte, error) {
+
+	var b bytes.Buffer
+
+	writeUvarint(&b, uint64(len(entries)))
+
+	var last_id uint64
+
+	for _, e := range entries {
+		writeUvarint(&b, e.TileId-last_id)
+		last_id = e.TileId
+	}
+
+	for _, e := range entries {
+		writeUvarint(&b, uint64(e.RunLength))
+	}
+
+	for _, e := range entries {
+		writeUvarint(&b, uint64(e.Length))
+	}
+
+	for i, e := range entries {
+
+		if i > 0 && e.Offset == entries[i-1].Offset+uint64(entries[i-1].Length) {
+			writeUvarint(&b, 0)
+		} else {
+			writeUvarint(&b, e.Offset+1)
+		}
+	}
+
+	return gzipBytes(b.Bytes())
+}
+
+func writeUvarint(b *bytes.Buffer, v uint64) {
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, v)
+	b.Write(buf[:n])
+}
+
+// pmtilesTileId returns the PMTiles tile ID for 't', which is the position of 't' along a Hilbert curve at its
+// zoom level plus the number of tiles in all the zoom levels before it.
+func pmtilesTileId(t maptile.Tile) uint64 {
+
+	z := uint64(t.Z)
+
+	var acc uint64
+
+	for i := uint64(0); i < z; i++ {
+		acc += (uint64(1) << i) * (uint64(1) << i)
+	}
+
+	n := uint64(1) << z
+
+	x := uint64(t.X)
+	y := uint64(t.Y)
+
+	var d uint64
+
+	for s := n / 2; s > 0; s /= 2 {
+
+		var rx, ry uint64
+
+		if x&s > 0 {
+			rx = 1
+		}
+
+		if y&s > 0 {
+			ry = 1
+		}
+
+		d += s * s * ((3 * rx) ^ ry)
+
+		if ry == 0 {
+
+			if rx == 1 {
+				x = n - 1 - x
+				y = n - 1 - y
+			}
+
+			x, y = y, x
+		}
+	}
+
+	return acc + d
+}
+
+// pmtilesTileType returns the PMTiles tile type for 'format'.
+func pmtilesTileType(format TileFormat) uint8 {
+
+	switch format.Extension() {
+	case "pbf", "mvt":
+		return pmtiles_type_mvt
+	case "png":
+		return pmtiles_type_png
+	case "jpg", "jpeg":
+		return pmtiles_type_jpeg
+	case "webp":
+		return pmtiles_type_webp
+	default:
+		return pmtiles_type_unknown
+	}
+}
+
+func gzipBytes(body []byte) ([]byte, error) {
+
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+
+	_, err := gz.Write(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compress data, %w", err)
+	}
+
+	err = gz.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to close compressor, %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func e7(v float64) int32 {
+	return int32(math.Round(v * 1e7))
+}
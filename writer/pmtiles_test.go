@@ -0,0 +1,323 @@
+package writer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"github.com/paulmach/orb/maptile"
+	_ "gocloud.dev/blob/memblob"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testFormat implements the TileFormat interface for tiles with a given extension and content type.
+type testFormat struct {
+	extension    string
+	content_type string
+}
+
+func (f *testFormat) Extension() string {
+	return f.extension
+}
+
+func (f *testFormat) ContentType() string {
+	return f.content_type
+}
+
+func TestPMTilesTileId(t *testing.T) {
+
+	// Tile IDs for zoom levels 0 and 1 are from the PMTiles v3 reference implementation. The rest follow the
+	// Hilbert curve, which starts at 0,0 and ends at {MAX},0 for each zoom level, offset by the number of tiles in
+	// the preceding zoom levels.
+
+	tests := []struct {
+		Tile     maptile.Tile
+		Expected uint64
+	}{
+		{maptile.New(0, 0, 0), 0},
+		{maptile.New(0, 0, 1), 1},
+		{maptile.New(0, 1, 1), 2},
+		{maptile.New(1, 1, 1), 3},
+		{maptile.New(1, 0, 1), 4},
+		{maptile.New(0, 0, 2), 5},
+		{maptile.New(1, 0, 2), 6},
+		{maptile.New(1, 1, 2), 7},
+		{maptile.New(0, 1, 2), 8},
+		{maptile.New(0, 3, 2), 10},
+		{maptile.New(3, 0, 2), 20},
+		{maptile.New(0, 0, 3), 21},
+		{maptile.New(0, 0, 12), 5592405},
+	}
+
+	for _, test := range tests {
+
+		id := pmtilesTileId(test.Tile)
+
+		if id != test.Expected {
+			t.Fatalf("Expected tile ID %d for %d/%d/%d, got %d", test.Expected, test.Tile.Z, test.Tile.X, test.Tile.Y, id)
+		}
+
+		tile := pmtilesTile(id)
+
+		if tile != test.Tile {
+			t.Fatalf("Expected tile %d/%d/%d for tile ID %d, got %d/%d/%d", test.Tile.Z, test.Tile.X, test.Tile.Y, id, tile.Z, tile.X, tile.Y)
+		}
+	}
+}
+
+func TestPMTilesTileIdRoundTrip(t *testing.T) {
+
+	var expected uint64
+
+	for z := maptile.Zoom(0); z <= 6; z++ {
+
+		n := uint32(1) << z
+		seen := make(map[uint64]bool)
+
+		for x := uint32(0); x < n; x++ {
+
+			for y := uint32(0); y < n; y++ {
+
+				tile := maptile.New(x, y, z)
+				id := pmtilesTileId(tile)
+
+				if seen[id] {
+					t.Fatalf("Duplicate tile ID %d for %d/%d/%d", id, z, x, y)
+				}
+
+				seen[id] = true
+
+				if pmtilesTile(id) != tile {
+					t.Fatalf("Failed to round trip tile %d/%d/%d (%d)", z, x, y, id)
+				}
+
+				if id < expected || id >= expected+uint64(n)*uint64(n) {
+					t.Fatalf("Tile ID %d for %d/%d/%d is outside of zoom level %d", id, z, x, y, z)
+				}
+			}
+		}
+
+		expected += uint64(n) * uint64(n)
+	}
+
+	for z := maptile.Zoom(0); z <= 31; z++ {
+
+		max := (uint32(1) << z) - 1
+
+		for _, tile := range []maptile.Tile{maptile.New(0, 0, z), maptile.New(max, 0, z), maptile.New(0, max, z), maptile.New(max, max, z)} {
+
+			if pmtilesTile(pmtilesTileId(tile)) != tile {
+				t.Fatalf("Failed to round trip tile %d/%d/%d", tile.Z, tile.X, tile.Y)
+			}
+		}
+	}
+}
+
+func TestPMTilesDirectory(t *testing.T) {
+
+	entries := []*pmtilesEntry{
+		{TileId: 0, Offset: 0, Length: 10, RunLength: 1},
+		{TileId: 1, Offset: 10, Length: 20, RunLength: 2},
+		{TileId: 5, Offset: 100, Length: 300, RunLength: 1},
+		{TileId: 6, Offset: 400, Length: 1, RunLength: 0},
+	}
+
+	// The number of entries, then the delta encoded tile IDs, run lengths, lengths and offsets (where 0 means
+	// the entry immediately follows the previous one and any other value is the offset plus one) as varints.
+
+	expected := []byte{
+		0x04,
+		0x00, 0x01, 0x04, 0x01,
+		0x01, 0x02, 0x01, 0x00,
+		0x0a, 0x14, 0xac, 0x02, 0x01,
+		0x01, 0x00, 0x65, 0x00,
+	}
+
+	body, err := pmtilesDirectory(entries)
+
+	if err != nil {
+		t.Fatalf("Failed to encode directory, %v", err)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+
+	if err != nil {
+		t.Fatalf("Failed to create gzip reader, %v", err)
+	}
+
+	raw, err := io.ReadAll(gz)
+
+	if err != nil {
+		t.Fatalf("Failed to decompress directory, %v", err)
+	}
+
+	if !bytes.Equal(raw, expected) {
+		t.Fatalf("Unexpected directory encoding, %x", raw)
+	}
+
+	decoded, err := decodePMTilesDirectory(raw)
+
+	if err != nil {
+		t.Fatalf("Failed to decode directory, %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, entries) {
+		t.Fatalf("Decoded directory does not match entries")
+	}
+}
+
+// pmtilesTile returns the tile for the PMTiles tile ID 'id'. It is the inverse of pmtilesTileId.
+func pmtilesTile(id uint64) maptile.Tile {
+
+	var acc uint64
+
+	for z := uint64(0); z < 32; z++ {
+
+		n := uint64(1) << z
+
+		if acc+n*n > id {
+
+			d := id - acc
+
+			var x, y uint64
+
+			for s := uint64(1); s < n; s *= 2 {
+
+				rx := 1 & (d / 2)
+				ry := 1 & (d ^ rx)
+
+				if ry == 0 {
+
+					if rx == 1 {
+						x = s - 1 - x
+						y = s - 1 - y
+					}
+
+					x, y = y, x
+				}
+
+				x += s * rx
+				y += s * ry
+				d /= 4
+			}
+
+			return maptile.New(uint32(x), uint32(y), maptile.Zoom(z))
+		}
+
+		acc += n * n
+	}
+
+	return maptile.Tile{}
+}
+
+// decodePMTilesDirectory decodes the (uncompressed) PMTiles directory in 'raw'.
+func decodePMTilesDirectory(raw []byte) ([]*pmtilesEntry, error) {
+
+	r := bytes.NewReader(raw)
+
+	count, err := binary.ReadUvarint(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*pmtilesEntry, count)
+
+	var last_id uint64
+
+	for i := range entries {
+
+		v, err := binary.ReadUvarint(r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		last_id += v
+		entries[i] = &pmtilesEntry{TileId: last_id}
+	}
+
+	for _, e := range entries {
+
+		v, err := binary.ReadUvarint(r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e.RunLength = uint32(v)
+	}
+
+	for _, e := range entries {
+
+		v, err := binary.ReadUvarint(r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e.Length = uint32(v)
+	}
+
+	for i, e := range entries {
+
+		v, err := binary.ReadUvarint(r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if v == 0 && i > 0 {
+			e.Offset = entries[i-1].Offset + uint64(entries[i-1].Length)
+		} else {
+			e.Offset = v - 1
+		}
+	}
+
+	if r.Len() != 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return entries, nil
+}
+
+func TestPMTilesWriterMixedFormats(t *testing.T) {
+
+	ctx := context.Background()
+
+	wr, err := NewPMTilesWriter(ctx, "pmtiles://?bucket_uri=mem://")
+
+	if err != nil {
+		t.Fatalf("Failed to create writer, %v", err)
+	}
+
+	png := &testFormat{extension: "png", content_type: "image/png"}
+	svg := &testFormat{extension: "svg", content_type: "image/svg+xml"}
+
+	err = wr.WriteTile(ctx, maptile.New(0, 0, 1), png, strings.NewReader("png"))
+
+	if err != nil {
+		t.Fatalf("Failed to write tile, %v", err)
+	}
+
+	err = wr.WriteTile(ctx, maptile.New(1, 0, 1), svg, strings.NewReader("svg"))
+
+	if err == nil {
+		t.Fatalf("Expected writing a tile in a different format to fail")
+	}
+
+	err = wr.WriteTile(ctx, maptile.New(1, 1, 1), png, strings.NewReader("png"))
+
+	if err != nil {
+		t.Fatalf("Failed to write tile, %v", err)
+	}
+
+	err = wr.Close(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to close writer, %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+// package writer provides interfaces and implementations for writing rendered map tiles to a destination.
+package writer
+
+import (
+	"context"
+	"github.com/go-spatial/geom/slippy"
+	"github.com/paulmach/orb/maptile"
+	"github.com/sfomuseum/go-whosonfirst-tiles/internal/registry"
+	"io"
+)
+
+// TileFormat is an interface describing the encoding of a rendered tile. It is satisfied by render.Renderer.
+type TileFormat interface {
+	// Extension returns the file extension (without a leading ".") for the tile.
+	Extension() string
+	// ContentType returns the content (mime) type for the tile.
+	ContentType() string
+}
+
+// EncodedTileFormat is an optional interface for TileFormat implementations whose tiles may be compressed, or otherwise
+// encoded. It is satisfied by render.EncodedRenderer.
+type EncodedTileFormat interface {
+	TileFormat
+	// ContentEncoding returns the content encoding (for example "gzip") for the tile or an empty string.
+	ContentEncoding() string
+}
+
+// ContentEncoding returns the content encoding for 'format' if it implements the EncodedTileFormat interface or an
+// empty string otherwise.
+func ContentEncoding(format TileFormat) string {
+
+	enc, ok := format.(EncodedTileFormat)
+
+	if !ok {
+		return ""
+	}
+
+	return enc.ContentEncoding()
+}
+
+// Writer is an interface for writing rendered map tiles to a destination.
+type Writer interface {
+	// WriteTile writes the body of tile 't', encoded as 'format', to the destination.
+	WriteTile(context.Context, maptile.Tile, TileFormat, io.Reader) error
+	// Close flushes any pending data and closes the destination.
+	Close(context.Context) error
+}
+
+// GridWriter is an optional interface for Writer implementations that can only store tiles for some tile grids.
+type GridWriter interface {
+	Writer
+	// SupportsGrid reports whether tiles in 'g' can be written. A nil grid is a web mercator (EPSG:3857) grid.
+	SupportsGrid(slippy.Grid) bool
+}
+
+// SupportsGrid reports whether 'wr' can write tiles in 'g'. Writers that do not implement the GridWriter interface
+// are assumed to support any grid.
+func SupportsGrid(wr Writer, g slippy.Grid) bool {
+
+	gw, ok := wr.(GridWriter)
+
+	if !ok {
+		return true
+	}
+
+	return gw.SupportsGrid(g)
+}
+
+// WriterInitializeFunc is a function used to initialize an implementation of the Writer interface.
+type WriterInitializeFunc func(context.Context, string) (Writer, error)
+
+var writers = registry.NewRegistry()
+
+// RegisterWriter registers 'scheme' as a key pointing to 'f' in an internal lookup table of writers.
+func RegisterWriter(ctx context.Context, scheme string, f WriterInitializeFunc) error {
+	return writers.Register(ctx, scheme, f)
+}
+
+// Schemes returns the list of schemes that have been registered with the RegisterWriter method.
+func Schemes() []string {
+	return writers.Schemes()
+}
+
+// NewWriter returns a new Writer instance for 'uri'. If the scheme of 'uri' matches a writer previously registered
+// with the RegisterWriter method then that writer is used. Otherwise 'uri' is assumed to be a gocloud.dev/blob bucket
+// URI and a new BlobWriter is returned.
+func NewWriter(ctx context.Context, uri string) (Writer, error) {
+
+	i, ok, err := writers.Lookup(ctx, uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return NewBlobWriter(ctx, uri)
+	}
+
+	f := i.(WriterInitializeFunc)
+	return f(ctx, uri)
+}